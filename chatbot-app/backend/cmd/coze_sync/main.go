@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+
+	"chatbot-app/backend/config"
+	"chatbot-app/backend/database"
+	"chatbot-app/backend/services"
+	"chatbot-app/backend/utils"
+)
+
+// 将Coze工作空间中已发布的智能体和工作流同步到ai_model表
+// 用法：go run ./cmd/coze_sync
+func main() {
+	cfg := config.GetConfig()
+
+	if err := utils.InitLogger(&cfg.Log); err != nil {
+		log.Fatalf("日志系统初始化失败: %v", err)
+	}
+	if err := database.InitMySQL(&cfg.Database); err != nil {
+		log.Fatalf("MySQL初始化失败: %v", err)
+	}
+	// Coze令牌缓存和模型变更通知都依赖Redis
+	if err := database.InitRedis(&cfg.Redis); err != nil {
+		log.Fatalf("Redis初始化失败: %v", err)
+	}
+
+	syncService := &services.CozeSyncService{}
+	result, err := syncService.Sync()
+	if err != nil {
+		log.Fatalf("同步Coze模型失败: %v", err)
+	}
+
+	log.Printf("同步完成：新增%d个，更新%d个，停用%d个，跳过%d个", len(result.Created), len(result.Updated), len(result.Disabled), len(result.Skipped))
+	for _, name := range result.Created {
+		log.Printf("新增: %s", name)
+	}
+	for _, name := range result.Updated {
+		log.Printf("更新: %s", name)
+	}
+	for _, name := range result.Disabled {
+		log.Printf("停用: %s", name)
+	}
+	for _, name := range result.Skipped {
+		log.Printf("跳过已删除的模型: %s", name)
+	}
+}
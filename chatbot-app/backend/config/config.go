@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"github.com/joho/godotenv"
 	"os"
 	"strconv"
@@ -21,6 +23,7 @@ type AIConfig struct {
 	ZhipuBaseURL  string
 	OpenAIAPIKey  string
 	OpenAIBaseURL string
+	TitleModel    string // 生成会话标题使用的模型名称，为空时使用默认对话模型
 }
 
 // CozeConfig Coze配置
@@ -32,6 +35,15 @@ type CozeConfig struct {
 	PublicKeyID        string
 	BotID              string
 	WorkFlowID         string
+	SpaceID            string // 工作空间Id，创建知识库等空间级操作使用
+
+	loadErr error // 加载配置时的错误，如私钥文件不存在
+}
+
+// UploadConfig 文件上传配置
+type UploadConfig struct {
+	Dir     string // 本地存储目录
+	MaxSize int64  // 单个文件大小上限(字节)
 }
 
 // ServerConfig 服务器配置
@@ -98,6 +110,7 @@ func GetConfig() *Config {
 		},
 		AI: AIConfig{
 			ZhipuAPIKey: getEnv("ZHIPU_API_KEY", ""),
+			TitleModel:  getEnv("AI_TITLE_MODEL", ""),
 		},
 	}
 }
@@ -131,22 +144,58 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 }
 
 // GetCozeConfig 获取Coze配置
+// 私钥优先读取COZE_PRIVATE_KEY，未设置时读取COZE_PRIVATE_KEY_FILE指向的文件
+// 配置缺失不会中断程序，可通过Validate获取具体原因；每次调用都会重新读取私钥文件，
+// 运行期间通过coze包缓存的配置使用，不要在请求路径上直接调用
 func GetCozeConfig() *CozeConfig {
-	//从本地文件读取privatekey
-	privateKeyBytes, err := os.ReadFile(getEnv("COZE_PRIVATE_KEY_FILE", ""))
-	if err != nil {
-		panic(err)
-	}
-	privateKey := string(privateKeyBytes)
-
-	//从环境变量读取
-	return &CozeConfig{
+	cozeConfig := &CozeConfig{
 		APIURL:             getEnv("COZE_API_URL", "https://api.coze.cn"),
 		ClientID:           getEnv("COZE_CLIENT_ID", ""),
-		PrivateKey:         privateKey,
+		PrivateKey:         getEnv("COZE_PRIVATE_KEY", ""),
 		PrivateKeyFilePath: getEnv("COZE_PRIVATE_KEY_FILE", ""),
 		PublicKeyID:        getEnv("COZE_PUBLIC_KEY_ID", ""),
 		BotID:              getEnv("COZE_BOT_ID", ""),
 		WorkFlowID:         getEnv("COZE_WORKFLOW_ID", ""),
+		SpaceID:            getEnv("COZE_SPACE_ID", ""),
+	}
+
+	//从本地文件读取privatekey
+	if cozeConfig.PrivateKey == "" && cozeConfig.PrivateKeyFilePath != "" {
+		privateKeyBytes, err := os.ReadFile(cozeConfig.PrivateKeyFilePath)
+		if err != nil {
+			cozeConfig.loadErr = fmt.Errorf("读取Coze私钥文件失败: %v", err)
+		} else {
+			cozeConfig.PrivateKey = string(privateKeyBytes)
+		}
+	}
+
+	return cozeConfig
+}
+
+// Validate 检查Coze配置是否完整，返回第一个缺失项
+func (c *CozeConfig) Validate() error {
+	if c.loadErr != nil {
+		return c.loadErr
+	}
+	if c.APIURL == "" {
+		return errors.New("未配置COZE_API_URL")
+	}
+	if c.ClientID == "" {
+		return errors.New("未配置COZE_CLIENT_ID")
+	}
+	if c.PublicKeyID == "" {
+		return errors.New("未配置COZE_PUBLIC_KEY_ID")
+	}
+	if c.PrivateKey == "" {
+		return errors.New("未配置Coze私钥，请设置COZE_PRIVATE_KEY或COZE_PRIVATE_KEY_FILE")
+	}
+	return nil
+}
+
+// GetUploadConfig 获取文件上传配置
+func GetUploadConfig() *UploadConfig {
+	return &UploadConfig{
+		Dir:     getEnv("UPLOAD_DIR", "uploads"),
+		MaxSize: int64(getEnvAsInt("UPLOAD_MAX_SIZE", 20)) << 20,
 	}
 }
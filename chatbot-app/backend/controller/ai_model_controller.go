@@ -1,7 +1,10 @@
 package controller
 
 import (
+	"errors"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -12,26 +15,37 @@ import (
 
 // AIModelController AI模型控制器
 type AIModelController struct {
-	aiService      *services.AiService
-	aiModelService *services.AIModelService
+	aiService       *services.AiService
+	aiModelService  *services.AIModelService
+	cozeSyncService *services.CozeSyncService
 }
 
 // NewAIModelController 创建AI模型控制器
 func NewAIModelController() *AIModelController {
 	return &AIModelController{
-		aiService:      services.NewAiService(),
-		aiModelService: &services.AIModelService{},
+		aiService:       services.NewAiService(),
+		aiModelService:  &services.AIModelService{},
+		cozeSyncService: &services.CozeSyncService{},
 	}
 }
 
 // GetAvailableModelList 获取可用模型列表
 // @Summary 获取可用模型列表
-// @Description 获取系统中所有可用的AI模型列表及当前使用的模型，可按类型过滤
+// @Description 获取系统中所有可用的AI模型列表及当前使用的模型，可按类型、能力过滤并排序
 // @Tags AI模型
 // @Accept json
 // @Produce json
 // @Security Bearer
 // @Param type query string false "模型类型" Enums(chat,image,video)
+// @Param provider query string false "提供商"
+// @Param min_context query integer false "最小上下文窗口(Token)"
+// @Param vision query boolean false "仅返回支持图片理解的模型"
+// @Param tools query boolean false "仅返回支持工具调用的模型"
+// @Param json_mode query boolean false "仅返回支持JSON输出模式的模型"
+// @Param streaming query boolean false "仅返回支持流式输出的模型"
+// @Param reasoning query boolean false "仅返回推理模型"
+// @Param sort query string false "排序字段" Enums(id,name,display_name,provider,context_window,input_price,output_price)
+// @Param order query string false "排序方向" Enums(asc,desc)
 // @Success 200 {object} utils.Response{data=object{models=array,current_model=string}} "模型列表"
 // @Failure 401 {object} utils.Response "未授权"
 // @Failure 500 {object} utils.Response "服务器错误"
@@ -40,15 +54,29 @@ func (controller *AIModelController) GetAvailableModelList(c *gin.Context) {
 	// 获取可选的type参数
 	chatType := c.DefaultQuery("type", "")
 
+	filter := &services.ModelListFilter{
+		Type:      chatType,
+		Provider:  c.Query("provider"),
+		Vision:    queryBool(c, "vision"),
+		Tools:     queryBool(c, "tools"),
+		JSONMode:  queryBool(c, "json_mode"),
+		Streaming: queryBool(c, "streaming"),
+		Reasoning: queryBool(c, "reasoning"),
+		SortBy:    c.Query("sort"),
+		Order:     c.Query("order"),
+	}
+	filter.MinContextWindow, _ = strconv.Atoi(c.Query("min_context"))
+
 	utils.LogInfo("获取模型列表请求", map[string]interface{}{
-		"type": chatType,
+		"type":   chatType,
+		"filter": filter,
 	})
 
 	var modelList []models.AIModel
 	var err error
 
 	// 获取模型
-	modelList, err = controller.aiModelService.GetAllModelList(chatType)
+	modelList, err = controller.aiModelService.GetModelList(filter)
 
 	if err != nil {
 		utils.LogError("获取模型列表失败", err, map[string]interface{}{
@@ -60,10 +88,18 @@ func (controller *AIModelController) GetAvailableModelList(c *gin.Context) {
 
 	defaultModel, _ := controller.aiModelService.GetDefaultModel(chatType)
 
-	if defaultModel == nil {
+	if defaultModel == nil && len(modelList) > 0 {
 		defaultModel = &modelList[0]
 	}
 
+	// API参数中可能配置了工作流凭据，不返回给普通用户
+	for i := range modelList {
+		modelList[i].ApiParameters = ""
+	}
+	if defaultModel != nil {
+		defaultModel.ApiParameters = ""
+	}
+
 	utils.Success(c, gin.H{
 		"models":        modelList,
 		"current_model": defaultModel,
@@ -71,19 +107,27 @@ func (controller *AIModelController) GetAvailableModelList(c *gin.Context) {
 	})
 }
 
+// queryBool 解析布尔类型的查询参数，无法解析时返回false
+func queryBool(c *gin.Context, key string) bool {
+	value, _ := strconv.ParseBool(c.Query(key))
+	return value
+}
+
 // GetModelUsageHandler 获取模型使用情况
 // @Summary 获取模型使用情况
-// @Description 获取当前用户的AI模型使用记录
+// @Description 获取当前用户的AI模型使用记录，按游标分页，total为记录总数。原page参数已改为cursor
 // @Tags AI模型
 // @Accept json
 // @Produce json
 // @Security Bearer
-// @Param page query integer false "页码" default(1)
-// @Param limit query integer false "每页数量" default(10)
-// @Success 200 {object} utils.Response{data=object{usage=array,total=integer}} "使用记录"
+// @Param cursor query string false "分页游标，取上次返回的next_cursor或prev_cursor"
+// @Param direction query string false "翻页方向" Enums(next,prev) default(next)
+// @Param limit query integer false "每页数量" default(20)
+// @Success 200 {object} utils.Response{data=object{usage=array,total=integer,limit=integer,next_cursor=string,prev_cursor=string,has_more=boolean}} "使用记录"
+// @Failure 400 {object} utils.Response "参数错误"
 // @Failure 401 {object} utils.Response "未授权"
 // @Failure 500 {object} utils.Response "服务器错误"
-// @Router /api/ai/usage [get]
+// @Router /api/ai/model_usage [get]
 func (controller *AIModelController) GetModelUsageHandler(c *gin.Context) {
 	// 从JWT中获取用户Id
 	claims, exists := c.Get("claims")
@@ -95,51 +139,233 @@ func (controller *AIModelController) GetModelUsageHandler(c *gin.Context) {
 	userClaims := claims.(*utils.Claims)
 	userId := userClaims.UserId
 
-	// 获取分页参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-
-	if page < 1 {
-		page = 1
-	}
-	if limit < 1 || limit > 100 {
-		limit = 10
-	}
+	page := cursorParams(c)
 
 	utils.LogInfo("获取模型使用记录请求", map[string]interface{}{
-		"user_id": userId,
-		"page":    page,
-		"limit":   limit,
+		"user_id":   userId,
+		"cursor":    page.Cursor,
+		"direction": page.Direction,
+		"limit":     page.Limit,
 	})
 
 	// 获取用户的模型使用记录
-	usageList, err := controller.aiModelService.GetModelUsageByUser(userId)
+	usageList, pageInfo, err := controller.aiModelService.GetModelUsageByUser(userId, page)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			utils.InvalidParams(c, err.Error())
+			return
+		}
 		utils.LogError("获取模型使用记录失败", err, map[string]interface{}{
 			"user_id": userId,
 		})
 		utils.Error(c, "获取使用记录失败: "+err.Error())
 		return
 	}
+	total, err := controller.aiModelService.CountModelUsageByUser(userId)
+	if err != nil {
+		utils.LogError("统计模型使用记录失败", err, map[string]interface{}{
+			"user_id": userId,
+		})
+		utils.Error(c, "获取使用记录失败: "+err.Error())
+		return
+	}
 
-	// 简单分页处理
-	total := len(usageList)
-	start := (page - 1) * limit
-	end := start + limit
+	utils.Success(c, gin.H{
+		"usage":       usageList,
+		"total":       total,
+		"limit":       page.Limit,
+		"next_cursor": pageInfo.NextCursor,
+		"prev_cursor": pageInfo.PrevCursor,
+		"has_more":    pageInfo.HasMore,
+	})
+}
 
-	if start >= total {
-		usageList = []models.AIModelUsage{}
-	} else {
-		if end > total {
-			end = total
-		}
-		usageList = usageList[start:end]
+// GetUserCostHandler 获取当前用户的费用汇总
+// @Summary 获取用户费用汇总
+// @Description 按模型和货币汇总当前用户的Token用量与费用
+// @Tags AI模型
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} utils.Response{data=object{summary=array,total=object}} "费用汇总"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/ai/cost [get]
+func (controller *AIModelController) GetUserCostHandler(c *gin.Context) {
+	userId := c.GetUint("userId")
+
+	summary, err := controller.aiModelService.GetUserCostSummary(userId)
+	if err != nil {
+		utils.LogError("获取用户费用汇总失败", err, map[string]interface{}{
+			"user_id": userId,
+		})
+		utils.Error(c, "获取费用汇总失败: "+err.Error())
+		return
 	}
 
 	utils.Success(c, gin.H{
-		"usage": usageList,
-		"total": total,
-		"page":  page,
-		"limit": limit,
+		"summary": summary,
+		"total":   services.SumCostByCurrency(summary),
 	})
 }
+
+// GetModelPriceHistory 获取模型价格历史
+// @Summary 获取模型价格历史
+// @Description 获取指定模型的价格变更历史（管理员）
+// @Tags AI模型
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "模型Id"
+// @Success 200 {object} utils.Response{data=object{prices=array}} "价格历史"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 403 {object} utils.Response "无权访问"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/ai/model/{id}/price [get]
+func (controller *AIModelController) GetModelPriceHistory(c *gin.Context) {
+	modelId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的模型Id")
+		return
+	}
+
+	prices, err := controller.aiModelService.GetModelPriceHistory(uint(modelId))
+	if err != nil {
+		utils.LogError("获取模型价格历史失败", err, map[string]interface{}{
+			"model_id": modelId,
+		})
+		utils.Error(c, "获取价格历史失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{"prices": prices})
+}
+
+// SetModelPrice 设置模型价格
+// @Summary 设置模型价格
+// @Description 设置模型每百万Token的输入/输出价格并写入价格历史（管理员），已产生的使用记录保留原价格
+// @Tags AI模型
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "模型Id"
+// @Param body body object{input_price=number,output_price=number,currency=string,effective_at=string} true "价格信息"
+// @Success 200 {object} utils.Response{data=object} "设置成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 403 {object} utils.Response "无权访问"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/ai/model/{id}/price [post]
+func (controller *AIModelController) SetModelPrice(c *gin.Context) {
+	modelId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的模型Id")
+		return
+	}
+
+	var req struct {
+		InputPrice  *float64  `json:"input_price" binding:"required,min=0" msg_required:"请输入输入价格" msg_min:"价格不能为负数"`
+		OutputPrice *float64  `json:"output_price" binding:"required,min=0" msg_required:"请输入输出价格" msg_min:"价格不能为负数"`
+		Currency    string    `json:"currency" binding:"omitempty,len=3" msg_len:"货币代码应为3位"`
+		EffectiveAt time.Time `json:"effective_at"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		validationError := utils.GetValidationErrorWithTagMessages(req, err)
+		utils.LogWarn("设置模型价格参数验证失败", map[string]interface{}{
+			"error": validationError,
+			"ip":    c.ClientIP(),
+		})
+		utils.InvalidParams(c, validationError)
+		return
+	}
+
+	price, err := controller.aiModelService.SetModelPrice(uint(modelId), *req.InputPrice, *req.OutputPrice, strings.ToUpper(req.Currency), req.EffectiveAt)
+	if err != nil {
+		utils.LogError("设置模型价格失败", err, map[string]interface{}{
+			"model_id": modelId,
+		})
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.LogInfo("模型价格已更新", map[string]interface{}{
+		"model_id":     modelId,
+		"input_price":  price.InputPrice,
+		"output_price": price.OutputPrice,
+		"currency":     price.Currency,
+		"effective_at": price.EffectiveAt,
+		"operator_id":  c.GetUint("userId"),
+	})
+
+	utils.SuccessWithMsg(c, "设置成功", price)
+}
+
+// UpdateModel 更新模型配置
+// @Summary 更新模型配置
+// @Description 启用/停用模型或修改模型参数（管理员），变更会在数秒内同步到所有实例
+// @Tags AI模型
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "模型Id"
+// @Param body body object true "需要更新的字段，如enabled、is_default、temperature、max_tokens等"
+// @Success 200 {object} utils.Response{data=object} "更新成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 403 {object} utils.Response "无权访问"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/ai/model/{id} [patch]
+func (controller *AIModelController) UpdateModel(c *gin.Context) {
+	modelId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的模型Id")
+		return
+	}
+
+	var updates map[string]interface{}
+	if err := c.ShouldBindJSON(&updates); err != nil {
+		utils.InvalidParams(c, "请求参数格式错误")
+		return
+	}
+
+	aiModel, err := controller.aiModelService.UpdateModel(uint(modelId), updates)
+	if err != nil {
+		utils.LogError("更新模型配置失败", err, map[string]interface{}{
+			"model_id": modelId,
+			"updates":  updates,
+		})
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.LogInfo("模型配置已更新", map[string]interface{}{
+		"model_id":    modelId,
+		"updates":     updates,
+		"operator_id": c.GetUint("userId"),
+	})
+
+	utils.SuccessWithMsg(c, "更新成功", aiModel)
+}
+
+// SyncCozeModels 同步Coze智能体和工作流
+// @Summary 同步Coze智能体和工作流
+// @Description 拉取Coze工作空间中已发布的智能体和工作流写入模型表（管理员）。新对象自动创建为启用模型，已有模型更新名称和描述，上游已删除的模型会被停用
+// @Tags AI模型
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} utils.Response{data=services.CozeSyncResult} "同步结果"
+// @Failure 403 {object} utils.Response "无权访问"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/ai/model/coze/sync [post]
+func (controller *AIModelController) SyncCozeModels(c *gin.Context) {
+	result, err := controller.cozeSyncService.Sync()
+	if err != nil {
+		utils.LogError("同步Coze模型失败", err, map[string]interface{}{
+			"operator_id": c.GetUint("userId"),
+		})
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMsg(c, "同步成功", result)
+}
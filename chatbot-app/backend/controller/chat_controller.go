@@ -2,29 +2,47 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"chatbot-app/backend/models"
 	"chatbot-app/backend/services"
 	"chatbot-app/backend/utils"
+	"chatbot-app/backend/utils/coze"
 )
 
 // ChatController 聊天控制器
 type ChatController struct {
-	chatService    services.ChatService
-	aiService      *services.AiService
-	aiModelService *services.AIModelService
+	chatService              services.ChatService
+	aiService                *services.AiService
+	aiModelService           *services.AIModelService
+	chatFileService          *services.ChatFileService
+	workflowInterruptService *services.WorkflowInterruptService
+	chatTitleService         *services.ChatTitleService
+	chatExportService        *services.ChatExportService
+	chatImportService        *services.ChatImportService
 }
 
 // NewChatController 创建聊天控制器
 func NewChatController() *ChatController {
+	aiService := services.NewAiService()
 	return &ChatController{
-		chatService:    services.ChatService{},
-		aiService:      services.NewAiService(),
-		aiModelService: &services.AIModelService{},
+		chatService:              services.ChatService{},
+		aiService:                aiService,
+		aiModelService:           &services.AIModelService{},
+		chatFileService:          &services.ChatFileService{},
+		workflowInterruptService: &services.WorkflowInterruptService{},
+		chatTitleService:         services.NewChatTitleService(aiService),
+		chatExportService:        &services.ChatExportService{},
+		chatImportService:        &services.ChatImportService{},
 	}
 }
 
@@ -35,7 +53,7 @@ func NewChatController() *ChatController {
 // @Accept json
 // @Produce json
 // @Security Bearer
-// @Param body body object{title=string,type=string} true "聊天会话标题"
+// @Param body body object{title=string,type=string} true "聊天会话标题与类型，未提供标题时首轮回复后自动生成"
 // @Success 200 {object} utils.Response{data=object} "创建成功"
 // @Failure 400 {object} utils.Response "参数错误"
 // @Failure 401 {object} utils.Response "未授权"
@@ -43,7 +61,7 @@ func NewChatController() *ChatController {
 // @Router /api/chat [post]
 func (controller *ChatController) CreateChat(c *gin.Context) {
 	var req struct {
-		Title string `json:"title" binding:"required"`
+		Title string `json:"title" binding:"max=100" msg_max:"标题不能超过100个字符"`
 		Type  string `json:"type" binding:"required" msg_required:"会话类型不能为空"`
 	}
 
@@ -95,12 +113,17 @@ func (controller *ChatController) CreateChat(c *gin.Context) {
 
 // GetUserChatList 获取用户聊天会话列表
 // @Summary 获取聊天会话列表
-// @Description 获取当前用户的所有聊天会话列表
+// @Description 获取当前用户的聊天会话列表，置顶的会话排在前面，默认不返回已归档的会话。limit和cursor都不传时不分页，返回全部会话
 // @Tags 聊天
 // @Accept json
 // @Produce json
 // @Security Bearer
-// @Success 200 {object} utils.Response{data=object{chats=array}} "聊天会话列表"
+// @Param archived query string false "归档过滤：false只返回未归档（默认），true只返回已归档，all返回全部" Enums(false,true,all)
+// @Param cursor query string false "分页游标，取上次返回的next_cursor或prev_cursor"
+// @Param direction query string false "翻页方向" Enums(next,prev) default(next)
+// @Param limit query integer false "每页数量，传cursor但不传limit时为20"
+// @Success 200 {object} utils.Response{data=object{chats=array,next_cursor=string,prev_cursor=string,has_more=boolean}} "聊天会话列表"
+// @Failure 400 {object} utils.Response "参数错误"
 // @Failure 401 {object} utils.Response "未授权"
 // @Failure 500 {object} utils.Response "服务器错误"
 // @Router /api/chat [get]
@@ -115,8 +138,23 @@ func (controller *ChatController) GetUserChatList(c *gin.Context) {
 	userClaims := claims.(*utils.Claims)
 	userId := userClaims.UserId
 
-	chats, err := controller.chatService.GetUserChatList(userId)
+	filter := &services.ChatListFilter{}
+	switch c.DefaultQuery("archived", "false") {
+	case "all":
+	case "true":
+		archived := true
+		filter.Archived = &archived
+	default:
+		archived := false
+		filter.Archived = &archived
+	}
+
+	chats, pageInfo, err := controller.chatService.GetUserChatList(userId, filter, optionalCursorParams(c))
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			utils.InvalidParams(c, err.Error())
+			return
+		}
 		utils.LogError("获取用户聊天列表失败", err, map[string]interface{}{
 			"user_id": userId,
 		})
@@ -124,18 +162,254 @@ func (controller *ChatController) GetUserChatList(c *gin.Context) {
 		return
 	}
 
+	utils.Success(c, gin.H{
+		"chats":       chats,
+		"next_cursor": pageInfo.NextCursor,
+		"prev_cursor": pageInfo.PrevCursor,
+		"has_more":    pageInfo.HasMore,
+	})
+}
+
+// SearchChats 搜索聊天记录
+// @Summary 搜索聊天记录
+// @Description 在当前用户的会话标题和消息内容中搜索关键词，多个关键词以空格分隔需全部匹配。返回的标题和摘要已转义HTML，关键词以<em>标签高亮
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param q query string true "搜索关键词"
+// @Param model_id query integer false "只搜索指定模型的回复"
+// @Param role query string false "只搜索指定角色的消息" Enums(user,assistant)
+// @Param start_date query string false "开始日期，格式2006-01-02"
+// @Param end_date query string false "结束日期（含当天），格式2006-01-02"
+// @Param page query integer false "页码" default(1)
+// @Param limit query integer false "每页数量" default(20)
+// @Success 200 {object} utils.Response{data=services.ChatSearchResult} "搜索结果"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/chat/search [get]
+func (controller *ChatController) SearchChats(c *gin.Context) {
+	userId := c.GetUint("userId")
+	page, limit := pageParams(c)
+
+	query := &services.ChatSearchQuery{
+		UserId:  userId,
+		Keyword: c.Query("q"),
+		Role:    c.Query("role"),
+		Page:    page,
+		Limit:   limit,
+	}
+	if modelId := c.Query("model_id"); modelId != "" {
+		id, err := strconv.ParseUint(modelId, 10, 64)
+		if err != nil {
+			utils.InvalidParams(c, "无效的模型Id")
+			return
+		}
+		query.ModelId = uint(id)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		start, err := time.ParseInLocation(time.DateOnly, startDate, time.Local)
+		if err != nil {
+			utils.InvalidParams(c, "开始日期格式错误")
+			return
+		}
+		query.StartTime = &start
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		end, err := time.ParseInLocation(time.DateOnly, endDate, time.Local)
+		if err != nil {
+			utils.InvalidParams(c, "结束日期格式错误")
+			return
+		}
+		end = end.Add(24*time.Hour - time.Nanosecond)
+		query.EndTime = &end
+	}
+
+	if err := services.ValidateChatSearchQuery(query); err != nil {
+		utils.InvalidParams(c, err.Error())
+		return
+	}
+
+	result, err := services.GetChatSearcher().Search(query)
+	if err != nil {
+		utils.LogError("搜索聊天记录失败", err, map[string]interface{}{
+			"user_id": userId,
+			"keyword": query.Keyword,
+		})
+		utils.Error(c, "搜索失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"chats":    result.Chats,
+		"messages": result.Messages,
+		"total":    result.Total,
+		"page":     page,
+		"limit":    limit,
+	})
+}
+
+// UpdateChat 修改聊天会话
+// @Summary 修改聊天会话
+// @Description 重命名、置顶或归档聊天会话，只修改请求中提供的字段
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "聊天会话Id"
+// @Param body body object{title=string,pinned=boolean,archived=boolean} true "需要修改的字段"
+// @Success 200 {object} utils.Response{data=object} "修改成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 404 {object} utils.Response "聊天会话不存在"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/chat/{id} [patch]
+func (controller *ChatController) UpdateChat(c *gin.Context) {
+	chatId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的聊天Id")
+		return
+	}
+
+	var req struct {
+		Title    *string `json:"title" binding:"omitempty,max=100" msg_max:"标题不能超过100个字符"`
+		Pinned   *bool   `json:"pinned"`
+		Archived *bool   `json:"archived"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.InvalidParams(c, utils.GetValidationErrorWithTagMessages(req, err))
+		return
+	}
+
+	userId := c.GetUint("userId")
+
+	if _, err := controller.chatService.GetChatById(uint(chatId), userId); err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	chat, err := controller.chatService.UpdateChat(uint(chatId), userId, &services.ChatUpdate{
+		Title:    req.Title,
+		Pinned:   req.Pinned,
+		Archived: req.Archived,
+	})
+	if err != nil {
+		utils.InvalidParams(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMsg(c, "修改成功", chat)
+}
+
+// DeleteChat 删除聊天会话
+// @Summary 删除聊天会话
+// @Description 删除聊天会话，删除后进入回收站，可通过恢复接口找回
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "聊天会话Id"
+// @Success 200 {object} utils.Response "删除成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 404 {object} utils.Response "聊天会话不存在"
+// @Router /api/chat/{id} [delete]
+func (controller *ChatController) DeleteChat(c *gin.Context) {
+	chatId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的聊天Id")
+		return
+	}
+
+	userId := c.GetUint("userId")
+
+	if err := controller.chatService.DeleteChat(uint(chatId), userId); err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.LogInfo("聊天会话已删除", map[string]interface{}{
+		"user_id": userId,
+		"chat_id": chatId,
+	})
+	utils.SuccessWithMsg(c, "删除成功", nil)
+}
+
+// GetDeletedChatList 获取回收站中的聊天会话
+// @Summary 获取回收站中的聊天会话
+// @Description 获取当前用户已删除的聊天会话，最近删除的排在前面
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} utils.Response{data=object{chats=array}} "已删除的聊天会话列表"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/chat/trash [get]
+func (controller *ChatController) GetDeletedChatList(c *gin.Context) {
+	userId := c.GetUint("userId")
+
+	chats, err := controller.chatService.GetDeletedChatList(userId)
+	if err != nil {
+		utils.LogError("获取回收站聊天列表失败", err, map[string]interface{}{
+			"user_id": userId,
+		})
+		utils.Error(c, err.Error())
+		return
+	}
+
 	utils.Success(c, gin.H{"chats": chats})
 }
 
+// RestoreChat 恢复已删除的聊天会话
+// @Summary 恢复已删除的聊天会话
+// @Description 将回收站中的聊天会话恢复到会话列表
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "聊天会话Id"
+// @Success 200 {object} utils.Response{data=object} "恢复成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 404 {object} utils.Response "回收站中没有该聊天会话"
+// @Router /api/chat/{id}/restore [post]
+func (controller *ChatController) RestoreChat(c *gin.Context) {
+	chatId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的聊天Id")
+		return
+	}
+
+	userId := c.GetUint("userId")
+
+	chat, err := controller.chatService.RestoreChat(uint(chatId), userId)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.LogInfo("聊天会话已恢复", map[string]interface{}{
+		"user_id": userId,
+		"chat_id": chatId,
+	})
+	utils.SuccessWithMsg(c, "恢复成功", chat)
+}
+
 // GetChatMessageList 获取聊天消息列表
 // @Summary 获取聊天消息列表
-// @Description 获取指定聊天会话的所有消息
+// @Description 分页获取指定聊天会话当前选中分支上的消息，第一页为最新的消息，按next_cursor向后翻页加载更早的消息，每页内按时间正序排列；有多个分支的消息附带sibling_ids。limit和cursor都不传时不分页，返回当前分支上的全部消息；view=tree时不分页，返回完整消息树
 // @Tags 聊天
 // @Accept json
 // @Produce json
 // @Security Bearer
 // @Param id path integer true "聊天会话Id"
-// @Success 200 {object} utils.Response{data=object{messages=array}} "消息列表"
+// @Param view query string false "返回形式，默认path" Enums(path,tree)
+// @Param cursor query string false "分页游标，取上次返回的next_cursor或prev_cursor"
+// @Param direction query string false "翻页方向，next加载更早的消息" Enums(next,prev) default(next)
+// @Param limit query integer false "每页数量，传cursor但不传limit时为20"
+// @Success 200 {object} utils.Response{data=object{messages=array,next_cursor=string,prev_cursor=string,has_more=boolean}} "消息列表"
 // @Failure 400 {object} utils.Response "参数错误"
 // @Failure 401 {object} utils.Response "未授权"
 // @Failure 404 {object} utils.Response "聊天会话不存在"
@@ -170,17 +444,307 @@ func (controller *ChatController) GetChatMessageList(c *gin.Context) {
 		return
 	}
 
-	messages, err := controller.chatService.GetChatMessages(uint(chatId))
+	if c.Query("view") == "tree" {
+		messages, err := controller.chatService.GetMessageTree(uint(chatId))
+		if err != nil {
+			utils.LogError("获取聊天消息失败", err, map[string]interface{}{
+				"chat_id": chatId,
+				"user_id": userId,
+			})
+			utils.Error(c, err.Error())
+			return
+		}
+		utils.Success(c, gin.H{"messages": messages})
+		return
+	}
+
+	messages, pageInfo, err := controller.chatService.GetActivePathPage(uint(chatId), optionalCursorParams(c))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			utils.InvalidParams(c, err.Error())
+			return
+		}
+		utils.LogError("获取聊天消息失败", err, map[string]interface{}{
+			"chat_id": chatId,
+			"user_id": userId,
+		})
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"messages":    messages,
+		"next_cursor": pageInfo.NextCursor,
+		"prev_cursor": pageInfo.PrevCursor,
+		"has_more":    pageInfo.HasMore,
+	})
+}
+
+// ExportChat 导出聊天会话
+// @Summary 导出聊天会话
+// @Description 导出聊天会话为文件下载，包含标题、时间、角色、模型名称和元数据（思考过程、推荐追问、过程信息）。md和html导出当前选中分支，json导出所有分支的完整记录，可用于导入
+// @Tags 聊天
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "聊天会话Id"
+// @Param format query string false "导出格式" Enums(md,html,json) default(md)
+// @Success 200 {file} file "导出文件"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 404 {object} utils.Response "聊天会话不存在"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/chat/{id}/export [get]
+func (controller *ChatController) ExportChat(c *gin.Context) {
+	chatId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的聊天Id")
+		return
+	}
+
+	format := c.DefaultQuery("format", "md")
+	if !services.IsChatExportFormat(format) {
+		utils.InvalidParams(c, "不支持的导出格式")
+		return
+	}
+
+	userId := c.GetUint("userId")
+
+	if _, err := controller.chatService.GetChatById(uint(chatId), userId); err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	fileName, data, err := controller.chatExportService.ExportChat(uint(chatId), userId, format)
+	if err != nil {
+		utils.LogError("导出聊天会话失败", err, map[string]interface{}{
+			"user_id": userId,
+			"chat_id": chatId,
+			"format":  format,
+		})
+		utils.Error(c, "导出失败: "+err.Error())
+		return
+	}
+
+	c.Header("Content-Disposition", attachmentDisposition(fmt.Sprintf("chat-%d.%s", chatId, format), fileName))
+	c.Data(http.StatusOK, services.ChatExportContentType(format), data)
+}
+
+// ExportAllChats 导出所有聊天会话
+// @Summary 导出所有聊天会话
+// @Description 将当前用户的所有聊天会话（含已归档，不含回收站）导出为zip压缩包，每个会话一个文件
+// @Tags 聊天
+// @Produce json
+// @Security Bearer
+// @Param format query string false "导出格式" Enums(md,html,json) default(md)
+// @Success 200 {file} file "zip压缩包"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/chat/export [get]
+func (controller *ChatController) ExportAllChats(c *gin.Context) {
+	format := c.DefaultQuery("format", "md")
+	if !services.IsChatExportFormat(format) {
+		utils.InvalidParams(c, "不支持的导出格式")
+		return
+	}
+
+	userId := c.GetUint("userId")
+
+	// 压缩包直接写入响应，开始写出后出错只能中断下载
+	fileName := fmt.Sprintf("chats-%s.zip", time.Now().Format("20060102"))
+	c.Header("Content-Disposition", attachmentDisposition(fileName, fileName))
+	c.Header("Content-Type", "application/zip")
+	if err := controller.chatExportService.ExportAllChats(userId, format, c.Writer); err != nil {
+		utils.LogError("导出全部聊天会话失败", err, map[string]interface{}{
+			"user_id": userId,
+			"format":  format,
+		})
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			c.Writer.Header().Del("Content-Type")
+			utils.Error(c, "导出失败: "+err.Error())
+			return
+		}
+		c.Abort()
+	}
+}
+
+// ImportChats 导入聊天记录
+// @Summary 导入聊天记录
+// @Description 上传其他平台导出的聊天记录创建会话，支持ChatGPT的conversations.json（或整个导出zip包）、OpenAI格式的消息数组（[{role,content}]或{title,messages}）以及本平台导出的JSON（或批量导出的zip包）。有多个分支时只导入当前选中的分支，只导入用户和AI的文本消息。一次最多导入5000个会话、20万条消息，zip包解压后的总大小不超过200MB
+// @Tags 聊天
+// @Accept multipart/form-data
+// @Produce json
+// @Security Bearer
+// @Param file formData file true "导入文件"
+// @Success 200 {object} utils.Response{data=object{chats=array,skipped=integer}} "导入成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/chat/import [post]
+func (controller *ChatController) ImportChats(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		utils.InvalidParams(c, "请选择要导入的文件")
+		return
+	}
+	if fileHeader.Size > services.CHAT_IMPORT_MAX_SIZE {
+		utils.InvalidParams(c, fmt.Sprintf("导入文件不能超过%dMB", services.CHAT_IMPORT_MAX_SIZE>>20))
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		utils.Error(c, "读取导入文件失败: "+err.Error())
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		utils.Error(c, "读取导入文件失败: "+err.Error())
+		return
+	}
+
+	userId := c.GetUint("userId")
+
+	result, err := controller.chatImportService.Import(userId, data)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidChatImport) {
+			utils.InvalidParams(c, err.Error())
+			return
+		}
+		utils.LogError("导入聊天记录失败", err, map[string]interface{}{
+			"user_id":   userId,
+			"file_name": fileHeader.Filename,
+		})
+		utils.Error(c, "导入失败: "+err.Error())
+		return
+	}
+
+	utils.LogInfo("聊天记录已导入", map[string]interface{}{
+		"user_id":   userId,
+		"file_name": fileHeader.Filename,
+		"chats":     len(result.Chats),
+		"skipped":   result.Skipped,
+	})
+	utils.SuccessWithMsg(c, "导入成功", result)
+}
+
+// attachmentDisposition 生成附件下载的Content-Disposition，fallback为不支持filename*的客户端使用的ASCII文件名
+func attachmentDisposition(fallback string, fileName string) string {
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, fallback, url.PathEscape(fileName))
+}
+
+// GetChatCost 获取聊天会话费用汇总
+// @Summary 获取聊天会话费用汇总
+// @Description 按模型和货币汇总指定聊天会话的Token用量与费用
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "聊天会话Id"
+// @Success 200 {object} utils.Response{data=object{summary=array,total=object}} "费用汇总"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 404 {object} utils.Response "聊天会话不存在"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/chat/{id}/cost [get]
+func (controller *ChatController) GetChatCost(c *gin.Context) {
+	chatId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的聊天Id")
+		return
+	}
+
+	userId := c.GetUint("userId")
+
+	// 验证聊天会话是否属于当前用户
+	if _, err := controller.chatService.GetChatById(uint(chatId), userId); err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	summary, err := controller.aiModelService.GetChatCostSummary(uint(chatId))
+	if err != nil {
+		utils.LogError("获取聊天费用汇总失败", err, map[string]interface{}{
+			"user_id": userId,
+			"chat_id": chatId,
+		})
+		utils.Error(c, "获取费用汇总失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"summary": summary,
+		"total":   services.SumCostByCurrency(summary),
+	})
+}
+
+// UploadChatFile 上传聊天附件
+// @Summary 上传聊天附件
+// @Description 上传文件到指定聊天会话，所选模型为Coze智能体时同步上传到Coze，返回的附件Id可在发送消息时通过file_ids引用
+// @Tags 聊天
+// @Accept multipart/form-data
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "聊天会话Id"
+// @Param file formData file true "附件文件"
+// @Param model_id formData integer false "当前选择的模型Id"
+// @Success 200 {object} utils.Response{data=models.ChatFile} "上传成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 404 {object} utils.Response "聊天会话不存在"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/chat/{id}/file [post]
+func (controller *ChatController) UploadChatFile(c *gin.Context) {
+	chatId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的聊天Id")
+		return
+	}
+
+	userId := c.GetUint("userId")
+
+	// 验证聊天会话是否属于当前用户
+	chat, err := controller.chatService.GetChatById(uint(chatId), userId)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		utils.InvalidParams(c, "请选择要上传的文件")
+		return
+	}
+
+	var selectedModel *models.AIModel
+	if modelId, _ := strconv.ParseUint(c.PostForm("model_id"), 10, 64); modelId > 0 {
+		selectedModel, err = controller.aiModelService.GetModelById(uint(modelId))
+		if err != nil {
+			utils.InvalidParams(c, "模型不存在，请重新选择")
+			return
+		}
+	}
+
+	chatFile, err := controller.chatFileService.SaveFile(chat, userId, selectedModel, fileHeader)
 	if err != nil {
-		utils.LogError("获取聊天消息失败", err, map[string]interface{}{
-			"chat_id": chatId,
-			"user_id": userId,
+		utils.LogError("上传聊天附件失败", err, map[string]interface{}{
+			"user_id":   userId,
+			"chat_id":   chatId,
+			"file_name": fileHeader.Filename,
 		})
 		utils.Error(c, err.Error())
 		return
 	}
 
-	utils.Success(c, gin.H{"messages": messages})
+	utils.LogInfo("聊天附件已上传", map[string]interface{}{
+		"user_id": userId,
+		"chat_id": chatId,
+		"file_id": chatFile.Id,
+		"size":    chatFile.Size,
+	})
+	utils.SuccessWithMsg(c, "上传成功", chatFile)
 }
 
 // SendMessage 发送消息（流式响应）
@@ -191,7 +755,7 @@ func (controller *ChatController) GetChatMessageList(c *gin.Context) {
 // @Produce text/event-stream
 // @Security Bearer
 // @Param id path integer true "聊天会话Id"
-// @Param body body object{content=string,model_id=integer} true "消息内容与可选模型Id"
+// @Param body body object{content=string,model_id=integer,inputs=object,file_ids=array,edit_message_id=integer,json_mode=boolean} true "消息内容、模型Id、工作流表单字段、附件Id、要编辑的用户消息Id与是否要求JSON输出"
 // @Success 200 {string} string "Server-Sent Events流式响应"
 // @Failure 400 {object} utils.Response "参数错误"
 // @Failure 401 {object} utils.Response "未授权"
@@ -207,9 +771,14 @@ func (controller *ChatController) SendMessage(c *gin.Context) {
 	}
 
 	var req struct {
-		Content string `json:"content" binding:"required" msg_required:"请输入内容"`
-		ModelId uint   `json:"model_id" binding:"required" msg_required:"请选择模型"` // 模型Id
-		Type    string `json:"type"`
+		Content  string                 `json:"content" binding:"required" msg_required:"请输入内容"`
+		ModelId  uint                   `json:"model_id" binding:"required" msg_required:"请选择模型"` // 模型Id
+		Type     string                 `json:"type"`
+		Inputs   map[string]interface{} `json:"inputs"`    // 工作流表单字段
+		FileIds  []uint                 `json:"file_ids"`  // 通过上传附件接口得到的附件Id
+		JSONMode bool                   `json:"json_mode"` // 要求模型以JSON格式输出，需模型支持JSON输出模式
+		// EditMessageId 编辑历史用户消息时传入该消息Id，新消息与其同级形成新分支；不传时接在当前分支最后
+		EditMessageId uint `json:"edit_message_id"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -226,6 +795,7 @@ func (controller *ChatController) SendMessage(c *gin.Context) {
 
 	if err != nil {
 		utils.Error(c, "模型不存在，请重新选择")
+		return
 	}
 
 	// 从JWT中获取用户Id
@@ -245,32 +815,432 @@ func (controller *ChatController) SendMessage(c *gin.Context) {
 		return
 	}
 
+	// 确定新消息所在的分支，以该分支上的历史消息作为上下文
+	parentId, fork, err := controller.chatService.ResolveParent(chat.Id, req.EditMessageId)
+	if err != nil {
+		utils.InvalidParams(c, err.Error())
+		return
+	}
+	messages, err := controller.chatService.GetBranchMessages(chat.Id, parentId)
+	if err != nil {
+		utils.Error(c, "获取聊天历史失败")
+		return
+	}
+
+	// 将消息转换为适合AI服务的格式
+	history, contextTokens := buildChatHistory(messages, req.Content)
+
+	// 检查附件，只有Coze智能体支持文件消息
+	var files []models.ChatFile
+	if len(req.FileIds) > 0 {
+		if !services.IsCozeBotModel(selectedModel) {
+			utils.InvalidParams(c, "当前模型不支持发送附件")
+			return
+		}
+		files, err = controller.chatFileService.GetUnsentFiles(uint(chatId), userId, req.FileIds)
+		if err != nil {
+			utils.InvalidParams(c, err.Error())
+			return
+		}
+	}
+
+	// 检查所选模型能否处理该请求，图片附件需要图片理解能力
+	requirement := &services.ModelRequirement{
+		Type:           chat.Type,
+		Streaming:      true,
+		Vision:         services.HasImageFiles(files),
+		JSONMode:       req.JSONMode,
+		ContextTokens:  contextTokens,
+		ResponseTokens: selectedModel.MaxTokens,
+	}
+	if err := controller.aiModelService.CheckModelCapability(selectedModel, requirement); err != nil {
+		utils.LogWarn("所选模型无法处理该请求", map[string]interface{}{
+			"user_id":  userId,
+			"chat_id":  chatId,
+			"model_id": selectedModel.Id,
+			"error":    err.Error(),
+		})
+		utils.InvalidParams(c, err.Error())
+		return
+	}
+
+	if len(files) > 0 {
+		if err := controller.chatFileService.EnsureCozeFiles(files, selectedModel); err != nil {
+			utils.LogError("上传附件到Coze失败", err, map[string]interface{}{
+				"user_id": userId,
+				"chat_id": chatId,
+			})
+			utils.Error(c, "上传附件失败: "+err.Error())
+			return
+		}
+	}
+
 	// 保存用户消息
-	userMessage, err := controller.chatService.AddMessage(chat, "user", req.Content)
+	userMessage, err := controller.chatService.AddMessage(chat, parentId, "user", req.Content)
 	if err != nil {
 		utils.Error(c, err.Error())
 		return
 	}
+	if err := controller.chatFileService.AttachToMessage(files, userMessage.Id); err != nil {
+		utils.LogError("关联消息附件失败", err, map[string]interface{}{
+			"chat_id":    chatId,
+			"message_id": userMessage.Id,
+		})
+	}
+	userMessage.Files = files
+
+	meta := &services.RequestMeta{
+		ClientIP:   c.ClientIP(),
+		FormFields: req.Inputs,
+		Files:      files,
+		Fork:       fork,
+		JSONMode:   req.JSONMode,
+	}
+	controller.streamAssistantReply(c, chat.Id, userId, selectedModel, userMessage, meta, func(callback func(chunk string, isEnd bool, err error) bool) error {
+		return controller.aiService.GenerateStreamResponse(selectedModel, req.Content, history, userId, uint(chatId), meta, callback)
+	})
+}
+
+// RegenerateMessage 重新生成AI回复（流式响应）
+// @Summary 重新生成AI回复（流式响应）
+// @Description 针对指定AI回复对应的用户消息重新生成回复，可更换模型。原回复保留为同级的旧版本（active=false），响应格式与发送消息相同
+// @Tags 聊天
+// @Accept json
+// @Produce text/event-stream
+// @Security Bearer
+// @Param id path integer true "聊天会话Id"
+// @Param messageId path integer true "要重新生成的AI消息Id"
+// @Param body body object{model_id=integer,json_mode=boolean} false "模型Id（不传时使用原回复的模型）与是否要求JSON输出"
+// @Success 200 {string} string "Server-Sent Events流式响应"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 404 {object} utils.Response "聊天会话或消息不存在"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/chat/{id}/message/{messageId}/regenerate [post]
+func (controller *ChatController) RegenerateMessage(c *gin.Context) {
+	chatId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的聊天Id")
+		return
+	}
+	messageId, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的消息Id")
+		return
+	}
+
+	var req struct {
+		ModelId  uint `json:"model_id"`  // 不传时使用原回复的模型
+		JSONMode bool `json:"json_mode"` // 要求模型以JSON格式输出
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.InvalidParams(c, "请求参数格式错误")
+			return
+		}
+	}
+
+	userId := c.GetUint("userId")
+
+	chat, err := controller.chatService.GetChatById(uint(chatId), userId)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	reply, err := controller.chatService.GetMessage(chat.Id, uint(messageId))
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+	userMessage, err := controller.chatService.GetRegenerateSource(reply)
+	if err != nil {
+		utils.InvalidParams(c, err.Error())
+		return
+	}
+
+	modelId := req.ModelId
+	if modelId == 0 {
+		modelId = reply.ModelId
+	}
+	selectedModel, err := controller.aiModelService.GetModelById(modelId)
+	if err != nil {
+		utils.Error(c, "模型不存在，请重新选择")
+		return
+	}
 
-	// 获取历史消息作为上下文
-	messages, err := controller.chatService.GetChatMessages(uint(chatId))
+	// 以该用户消息所在分支之前的对话作为上下文
+	messages, err := controller.chatService.GetBranchMessages(chat.Id, userMessage.ParentId)
+	if err != nil {
+		utils.Error(c, "获取聊天历史失败")
+		return
+	}
+	fork, err := controller.chatService.IsForked(chat.Id, userMessage.Id)
 	if err != nil {
 		utils.Error(c, "获取聊天历史失败")
 		return
 	}
+	history, contextTokens := buildChatHistory(messages, userMessage.Content)
 
-	// 将消息转换为适合AI服务的格式
+	requirement := &services.ModelRequirement{
+		Type:           chat.Type,
+		Streaming:      true,
+		Vision:         services.HasImageFiles(userMessage.Files),
+		JSONMode:       req.JSONMode,
+		ContextTokens:  contextTokens,
+		ResponseTokens: selectedModel.MaxTokens,
+	}
+	if err := controller.aiModelService.CheckModelCapability(selectedModel, requirement); err != nil {
+		utils.InvalidParams(c, err.Error())
+		return
+	}
+	if len(userMessage.Files) > 0 && !services.IsCozeBotModel(selectedModel) {
+		utils.InvalidParams(c, "当前模型不支持发送附件")
+		return
+	}
+
+	utils.LogInfo("重新生成回复请求", map[string]interface{}{
+		"user_id":    userId,
+		"chat_id":    chatId,
+		"message_id": messageId,
+		"model_id":   selectedModel.Id,
+	})
+
+	meta := &services.RequestMeta{
+		ClientIP: c.ClientIP(),
+		Files:    userMessage.Files,
+		Fork:     fork,
+		JSONMode: req.JSONMode,
+	}
+	controller.streamAssistantReply(c, chat.Id, userId, selectedModel, userMessage, meta, func(callback func(chunk string, isEnd bool, err error) bool) error {
+		return controller.aiService.GenerateStreamResponse(selectedModel, userMessage.Content, history, userId, chat.Id, meta, callback)
+	})
+}
+
+// SelectMessageBranch 切换消息分支
+// @Summary 切换消息分支
+// @Description 切换到包含指定消息的分支（如查看另一个回复版本或编辑前的消息），之后发送的消息接在该分支之后，返回切换后的消息列表
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "聊天会话Id"
+// @Param messageId path integer true "要切换到的消息Id"
+// @Success 200 {object} utils.Response{data=object{messages=array}} "切换后的消息列表"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 404 {object} utils.Response "聊天会话或消息不存在"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/chat/{id}/message/{messageId}/select [post]
+func (controller *ChatController) SelectMessageBranch(c *gin.Context) {
+	chatId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的聊天Id")
+		return
+	}
+	messageId, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的消息Id")
+		return
+	}
+
+	userId := c.GetUint("userId")
+
+	chat, err := controller.chatService.GetChatById(uint(chatId), userId)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	if err := controller.chatService.SelectBranch(chat.Id, uint(messageId)); err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	messages, err := controller.chatService.GetActivePath(chat.Id)
+	if err != nil {
+		utils.Error(c, err.Error())
+		return
+	}
+	utils.SuccessWithMsg(c, "切换成功", gin.H{"messages": messages})
+}
+
+// buildChatHistory 将上下文消息转换为AI服务需要的格式，并估算加上本轮消息后的上下文Token数
+func buildChatHistory(messages []models.Message, prompt string) ([]map[string]string, int) {
 	var history []map[string]string
+	contextTokens := services.EstimateTokens(prompt)
 	for _, msg := range messages {
-		if msg.Id == userMessage.Id {
-			continue // 跳过刚刚添加的用户消息
-		}
 		history = append(history, map[string]string{
 			"role":    msg.Role,
 			"content": msg.Content,
 		})
+		contextTokens += services.EstimateTokens(msg.Content)
+	}
+	return history, contextTokens
+}
+
+// StopMessage 停止生成回复
+// @Summary 停止生成回复
+// @Description 停止会话中正在进行的流式回复，已生成的内容会保存为AI消息
+// @Tags 聊天
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "聊天会话Id"
+// @Success 200 {object} utils.Response "已停止生成"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 404 {object} utils.Response "聊天会话不存在"
+// @Router /api/chat/{id}/stop [post]
+func (controller *ChatController) StopMessage(c *gin.Context) {
+	chatId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的聊天Id")
+		return
+	}
+
+	userId := c.GetUint("userId")
+	if _, err := controller.chatService.GetChatById(uint(chatId), userId); err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	services.GetChatStreamRegistry().Stop(uint(chatId))
+
+	utils.LogInfo("停止生成请求", map[string]interface{}{
+		"user_id": userId,
+		"chat_id": chatId,
+	})
+	utils.SuccessWithMsg(c, "已停止生成", nil)
+}
+
+// ResumeWorkflow 回答工作流的问题并恢复执行（流式响应）
+// @Summary 恢复中断的工作流（流式响应）
+// @Description 工作流通过workflow_interrupt事件等待用户输入时，提交回答以在同一会话中恢复执行，响应格式与发送消息相同
+// @Tags 聊天
+// @Accept json
+// @Produce text/event-stream
+// @Security Bearer
+// @Param id path integer true "聊天会话Id"
+// @Param body body object{content=string,interrupt_id=integer} true "回答内容与中断Id，不传中断Id时恢复最近一次中断"
+// @Success 200 {string} string "Server-Sent Events流式响应"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 404 {object} utils.Response "聊天会话不存在或没有等待回答的工作流"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/chat/{id}/workflow/resume [post]
+func (controller *ChatController) ResumeWorkflow(c *gin.Context) {
+	chatId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的聊天Id")
+		return
+	}
+
+	var req struct {
+		Content     string `json:"content" binding:"required" msg_required:"请输入回答内容"`
+		InterruptId uint   `json:"interrupt_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.InvalidParams(c, utils.GetValidationErrorWithTagMessages(req, err))
+		return
+	}
+
+	userId := c.GetUint("userId")
+
+	chat, err := controller.chatService.GetChatById(uint(chatId), userId)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	interrupt, err := controller.workflowInterruptService.GetPendingInterrupt(chat.Id, userId, req.InterruptId)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	selectedModel, err := controller.aiModelService.GetModelById(interrupt.ModelId)
+	if err != nil || !selectedModel.Enabled {
+		utils.InvalidParams(c, "工作流模型已不可用")
+		return
+	}
+
+	if err := controller.workflowInterruptService.ClaimInterrupt(interrupt.Id); err != nil {
+		utils.InvalidParams(c, err.Error())
+		return
+	}
+
+	// 保存用户的回答，接在提出问题的AI消息之后
+	userMessage, err := controller.chatService.AddMessage(chat, interrupt.MessageId, "user", req.Content)
+	if err != nil {
+		controller.workflowInterruptService.ReleaseInterrupt(interrupt.Id)
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.LogInfo("恢复工作流请求", map[string]interface{}{
+		"user_id":      userId,
+		"chat_id":      chatId,
+		"interrupt_id": interrupt.Id,
+	})
+
+	meta := &services.RequestMeta{
+		ClientIP: c.ClientIP(),
+	}
+	controller.streamAssistantReply(c, chat.Id, userId, selectedModel, userMessage, meta, func(callback func(chunk string, isEnd bool, err error) bool) error {
+		err := controller.aiService.ResumeWorkflowStream(selectedModel, interrupt, req.Content, userId, meta, callback)
+		if err != nil {
+			// 未能恢复时允许用户重新回答
+			controller.workflowInterruptService.ReleaseInterrupt(interrupt.Id)
+		}
+		return err
+	})
+}
+
+// CHAT_TITLE_WAIT_TIMEOUT 回复结束后等待标题生成并推送的最长时间，
+// 超时后标题仍会在后台生成并保存，不让客户端长时间等待流关闭
+const CHAT_TITLE_WAIT_TIMEOUT = 3 * time.Second
+
+// generateChatTitle 生成会话标题，结果写入result，失败或未保存时写入空字符串
+func (controller *ChatController) generateChatTitle(chatId uint, userId uint, question string, answer string, result chan<- string) {
+	title, err := controller.chatTitleService.GenerateTitle(chatId, userId, question, answer)
+	if err != nil {
+		utils.LogWarn("自动生成会话标题失败", map[string]interface{}{
+			"chat_id": chatId,
+			"error":   err.Error(),
+		})
+	} else if title != "" {
+		utils.LogInfo("会话标题已自动生成", map[string]interface{}{
+			"chat_id": chatId,
+			"title":   title,
+		})
 	}
+	result <- title
+}
+
+// assistantMetadata 流式回复中文本以外的内容，合并保存到AI消息的元数据中
+type assistantMetadata struct {
+	Reasoning string                 `json:"reasoning,omitempty"`  // 推理过程
+	FollowUps []string               `json:"follow_ups,omitempty"` // 推荐的追问
+	Verbose   []*models.MessageTrace `json:"verbose,omitempty"`    // 插件调用、知识库召回等过程信息
+}
+
+// JSON 序列化为元数据JSON，没有内容时返回空字符串
+func (m *assistantMetadata) JSON() string {
+	if m.Reasoning == "" && len(m.FollowUps) == 0 && len(m.Verbose) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
 
+// streamAssistantReply 以SSE推送AI回复并在结束时保存，generate负责调用AI服务并将回复写入回调
+// 工作流中断时保存中断记录并推送workflow_interrupt事件，用户回答后可恢复执行
+func (controller *ChatController) streamAssistantReply(c *gin.Context, chatId uint, userId uint, selectedModel *models.AIModel, userMessage *models.Message, meta *services.RequestMeta, generate func(callback func(chunk string, isEnd bool, err error) bool) error) {
 	// 设置流式响应头
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
@@ -294,9 +1264,50 @@ func (controller *ChatController) SendMessage(c *gin.Context) {
 	c.SSEvent("message", string(startData))
 	c.Writer.Flush()
 
+	// 客户端断开或用户停止生成时结束ctx，AI服务据此取消生成
+	ctx, done := services.GetChatStreamRegistry().Begin(c.Request.Context(), chatId)
+	defer done()
+	meta.Context = ctx
+
 	// 用于收集完整AI响应和相关数据
 	var fullResponse strings.Builder
 	var botMessage *models.Message
+	var pendingInterrupt *coze.WorkflowInterrupt
+	var titleResult chan string // 首轮回复后自动生成的标题
+	var replyMetadata assistantMetadata
+	var reasoning strings.Builder
+
+	// 工作流中断在回复结束时与AI消息一起保存；推理过程、推荐问题和过程信息实时推送，并保存到消息元数据
+	meta.OnEvent = func(eventType string, data interface{}) {
+		var eventData gin.H
+		switch value := data.(type) {
+		case *coze.WorkflowInterrupt:
+			if eventType == "workflow_interrupt" {
+				pendingInterrupt = value
+			}
+			return
+		case *models.MessageTrace:
+			replyMetadata.Verbose = append(replyMetadata.Verbose, value)
+			eventData = gin.H{"type": "verbose", "verbose_type": value.Type, "content": value.Content}
+		case string:
+			switch eventType {
+			case "reasoning":
+				reasoning.WriteString(value)
+				eventData = gin.H{"type": "reasoning_chunk", "text": value}
+			case "follow_up":
+				replyMetadata.FollowUps = append(replyMetadata.FollowUps, value)
+				eventData = gin.H{"type": "follow_up", "text": value}
+			default:
+				return
+			}
+		default:
+			return
+		}
+
+		eventJSON, _ := json.Marshal(eventData)
+		c.SSEvent("message", string(eventJSON))
+		c.Writer.Flush()
+	}
 
 	// 定义流式回调函数
 	streamCallback := func(chunk string, isEnd bool, err error) bool {
@@ -319,14 +1330,16 @@ func (controller *ChatController) SendMessage(c *gin.Context) {
 		if isEnd {
 			// 流式响应结束，保存完整回复
 			response := fullResponse.String()
+			replyMetadata.Reasoning = reasoning.String()
 
 			// 保存AI回复到数据库
 			savedBotMessage, saveErr := controller.chatService.AddMessageWithModelMetadata(
-				uint(chatId),
+				chatId,
 				"assistant",
 				response,
 				selectedModel.Id,
-				"", // 元数据稍后更新
+				userMessage.Id,
+				replyMetadata.JSON(),
 			)
 			if saveErr != nil {
 				utils.LogError("保存AI回复失败", saveErr, map[string]interface{}{
@@ -346,6 +1359,33 @@ func (controller *ChatController) SendMessage(c *gin.Context) {
 
 			botMessage = savedBotMessage
 
+			// 工作流等待用户输入，保存中断并通知客户端
+			if pendingInterrupt != nil {
+				interrupt, interruptErr := controller.workflowInterruptService.SaveInterrupt(chatId, userId, selectedModel.Id, pendingInterrupt, response, botMessage.Id)
+				if interruptErr != nil {
+					utils.LogError("保存工作流中断失败", interruptErr, map[string]interface{}{
+						"user_id": userId,
+						"chat_id": chatId,
+					})
+				} else {
+					interruptData, _ := json.Marshal(gin.H{
+						"type":         "workflow_interrupt",
+						"interrupt_id": interrupt.Id,
+						"question":     interrupt.Question,
+						"node_title":   interrupt.NodeTitle,
+						"message_id":   botMessage.Id,
+					})
+					c.SSEvent("message", string(interruptData))
+					c.Writer.Flush()
+				}
+			}
+
+			// 首轮回复后异步生成标题，不阻塞结束信号
+			if titleResult == nil && controller.chatTitleService.ShouldGenerate(chatId) {
+				titleResult = make(chan string, 1)
+				go controller.generateChatTitle(chatId, userId, userMessage.Content, response, titleResult)
+			}
+
 			// 发送流式结束信号
 			endData, _ := json.Marshal(gin.H{
 				"type":       "stream_end",
@@ -368,10 +1408,10 @@ func (controller *ChatController) SendMessage(c *gin.Context) {
 		c.SSEvent("message", string(chunkData))
 		c.Writer.Flush()
 
-		// 检查客户端是否断开连接
+		// 检查客户端是否断开连接或用户停止生成
 		select {
-		case <-c.Request.Context().Done():
-			utils.LogInfo("客户端断开连接，停止流式传输", map[string]interface{}{
+		case <-ctx.Done():
+			utils.LogInfo("客户端断开连接或停止生成，停止流式传输", map[string]interface{}{
 				"user_id": userId,
 				"chat_id": chatId,
 			})
@@ -382,8 +1422,7 @@ func (controller *ChatController) SendMessage(c *gin.Context) {
 	}
 
 	// 调用AI服务生成流式回复
-	err = controller.aiService.GenerateStreamResponse(selectedModel, req.Content, history, userId, streamCallback)
-	if err != nil {
+	if err := generate(streamCallback); err != nil {
 		utils.LogError("启动AI流式回复失败", err, map[string]interface{}{
 			"user_id": userId,
 			"chat_id": chatId,
@@ -399,6 +1438,24 @@ func (controller *ChatController) SendMessage(c *gin.Context) {
 		return
 	}
 
+	// 标题在等待时间内生成完成时推送给客户端，超时后仍会保存，客户端刷新列表即可看到
+	if titleResult != nil {
+		select {
+		case title := <-titleResult:
+			if title != "" {
+				titleData, _ := json.Marshal(gin.H{
+					"type":    "title_updated",
+					"chat_id": chatId,
+					"title":   title,
+				})
+				c.SSEvent("message", string(titleData))
+				c.Writer.Flush()
+			}
+		case <-time.After(CHAT_TITLE_WAIT_TIMEOUT):
+		case <-c.Request.Context().Done():
+		}
+	}
+
 	// 记录完成日志
 	utils.LogInfo("AI流式对话完成", map[string]interface{}{
 		"user_id": userId,
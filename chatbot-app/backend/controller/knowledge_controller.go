@@ -0,0 +1,282 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"chatbot-app/backend/services"
+	"chatbot-app/backend/utils"
+)
+
+// KnowledgeController Coze知识库管理控制器
+type KnowledgeController struct {
+	knowledgeService *services.KnowledgeService
+}
+
+// NewKnowledgeController 创建知识库管理控制器
+func NewKnowledgeController() *KnowledgeController {
+	return &KnowledgeController{
+		knowledgeService: &services.KnowledgeService{},
+	}
+}
+
+// CreateKnowledge 创建知识库
+// @Summary 创建知识库
+// @Description 在Coze工作空间中创建知识库（管理员）
+// @Tags 知识库
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param body body object{name=string,description=string,format_type=integer} true "知识库信息，format_type：0文本 1表格 2图片"
+// @Success 200 {object} utils.Response{data=object{id=string}} "创建成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 403 {object} utils.Response "无权访问"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/knowledge [post]
+func (controller *KnowledgeController) CreateKnowledge(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required,max=100" msg_required:"请输入知识库名称" msg_max:"知识库名称不能超过100个字符"`
+		Description string `json:"description" binding:"max=2000" msg_max:"知识库描述不能超过2000个字符"`
+		FormatType  int    `json:"format_type"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.InvalidParams(c, utils.GetValidationErrorWithTagMessages(req, err))
+		return
+	}
+
+	knowledgeID, err := controller.knowledgeService.CreateKnowledge(req.Name, req.Description, req.FormatType)
+	if err != nil {
+		utils.LogError("创建知识库失败", err, map[string]interface{}{
+			"name": req.Name,
+		})
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.LogInfo("知识库已创建", map[string]interface{}{
+		"knowledge_id": knowledgeID,
+		"name":         req.Name,
+		"operator_id":  c.GetUint("userId"),
+	})
+	utils.SuccessWithMsg(c, "创建成功", gin.H{"id": knowledgeID})
+}
+
+// GetKnowledgeList 获取知识库列表
+// @Summary 获取知识库列表
+// @Description 分页获取Coze工作空间中的知识库（管理员）
+// @Tags 知识库
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param name query string false "按名称搜索"
+// @Param page query integer false "页码" default(1)
+// @Param limit query integer false "每页数量" default(20)
+// @Success 200 {object} utils.Response{data=object{list=array,total=integer}} "知识库列表"
+// @Failure 403 {object} utils.Response "无权访问"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/knowledge [get]
+func (controller *KnowledgeController) GetKnowledgeList(c *gin.Context) {
+	page, limit := pageParams(c)
+
+	list, total, err := controller.knowledgeService.ListKnowledge(c.Query("name"), page, limit)
+	if err != nil {
+		utils.LogError("获取知识库列表失败", err)
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"list":  list,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// DeleteKnowledge 删除知识库
+// @Summary 删除知识库
+// @Description 删除知识库及其中的所有文档（管理员）
+// @Tags 知识库
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "知识库Id"
+// @Success 200 {object} utils.Response "删除成功"
+// @Failure 403 {object} utils.Response "无权访问"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/knowledge/{id} [delete]
+func (controller *KnowledgeController) DeleteKnowledge(c *gin.Context) {
+	knowledgeID := c.Param("id")
+
+	if err := controller.knowledgeService.DeleteKnowledge(knowledgeID); err != nil {
+		utils.LogError("删除知识库失败", err, map[string]interface{}{
+			"knowledge_id": knowledgeID,
+		})
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.LogInfo("知识库已删除", map[string]interface{}{
+		"knowledge_id": knowledgeID,
+		"operator_id":  c.GetUint("userId"),
+	})
+	utils.SuccessWithMsg(c, "删除成功", nil)
+}
+
+// UploadDocument 上传知识库文档
+// @Summary 上传知识库文档
+// @Description 上传文件到知识库，上传后Coze异步处理，可通过处理进度接口查询状态（管理员）
+// @Tags 知识库
+// @Accept multipart/form-data
+// @Produce json
+// @Security Bearer
+// @Param id path string true "知识库Id"
+// @Param file formData file true "文档文件，不超过20MB"
+// @Param format_type formData integer false "知识库类型：0文本 1表格 2图片" default(0)
+// @Success 200 {object} utils.Response{data=object} "上传成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 403 {object} utils.Response "无权访问"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/knowledge/{id}/document [post]
+func (controller *KnowledgeController) UploadDocument(c *gin.Context) {
+	knowledgeID := c.Param("id")
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		utils.InvalidParams(c, "请选择要上传的文件")
+		return
+	}
+	formatType, _ := strconv.Atoi(c.DefaultPostForm("format_type", "0"))
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		utils.Error(c, "读取上传文件失败")
+		return
+	}
+	defer file.Close()
+
+	document, err := controller.knowledgeService.UploadDocument(knowledgeID, formatType, fileHeader.Filename, fileHeader.Size, file)
+	if err != nil {
+		utils.LogError("上传知识库文档失败", err, map[string]interface{}{
+			"knowledge_id": knowledgeID,
+			"file_name":    fileHeader.Filename,
+		})
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMsg(c, "上传成功", document)
+}
+
+// GetDocumentList 获取知识库文档列表
+// @Summary 获取知识库文档列表
+// @Description 分页获取知识库中的文档（管理员）
+// @Tags 知识库
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "知识库Id"
+// @Param page query integer false "页码" default(1)
+// @Param limit query integer false "每页数量" default(20)
+// @Success 200 {object} utils.Response{data=object{list=array,total=integer}} "文档列表"
+// @Failure 403 {object} utils.Response "无权访问"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/knowledge/{id}/document [get]
+func (controller *KnowledgeController) GetDocumentList(c *gin.Context) {
+	knowledgeID := c.Param("id")
+	page, limit := pageParams(c)
+
+	list, total, err := controller.knowledgeService.ListDocuments(knowledgeID, page, limit)
+	if err != nil {
+		utils.LogError("获取知识库文档列表失败", err, map[string]interface{}{
+			"knowledge_id": knowledgeID,
+		})
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"list":  list,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetDocumentProgress 查询文档处理进度
+// @Summary 查询文档处理进度
+// @Description 查询知识库文档的处理状态和进度，status：0处理中 1处理完成 9处理失败（管理员）
+// @Tags 知识库
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "知识库Id"
+// @Param document_ids query string true "文档Id，多个用逗号分隔"
+// @Success 200 {object} utils.Response{data=array} "处理进度"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 403 {object} utils.Response "无权访问"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/knowledge/{id}/document/progress [get]
+func (controller *KnowledgeController) GetDocumentProgress(c *gin.Context) {
+	knowledgeID := c.Param("id")
+
+	var documentIDs []string
+	for _, documentID := range strings.Split(c.Query("document_ids"), ",") {
+		if documentID = strings.TrimSpace(documentID); documentID != "" {
+			documentIDs = append(documentIDs, documentID)
+		}
+	}
+	if len(documentIDs) == 0 {
+		utils.InvalidParams(c, "请指定文档Id")
+		return
+	}
+
+	progressList, err := controller.knowledgeService.GetDocumentProgress(knowledgeID, documentIDs)
+	if err != nil {
+		utils.LogError("查询文档处理进度失败", err, map[string]interface{}{
+			"knowledge_id": knowledgeID,
+			"document_ids": documentIDs,
+		})
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.Success(c, progressList)
+}
+
+// DeleteDocument 删除知识库文档
+// @Summary 删除知识库文档
+// @Description 从知识库中删除文档（管理员）
+// @Tags 知识库
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "知识库Id"
+// @Param documentId path string true "文档Id"
+// @Success 200 {object} utils.Response "删除成功"
+// @Failure 403 {object} utils.Response "无权访问"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/knowledge/{id}/document/{documentId} [delete]
+func (controller *KnowledgeController) DeleteDocument(c *gin.Context) {
+	knowledgeID := c.Param("id")
+	documentID := c.Param("documentId")
+
+	if err := controller.knowledgeService.DeleteDocuments([]string{documentID}); err != nil {
+		utils.LogError("删除知识库文档失败", err, map[string]interface{}{
+			"knowledge_id": knowledgeID,
+			"document_id":  documentID,
+		})
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.LogInfo("知识库文档已删除", map[string]interface{}{
+		"knowledge_id": knowledgeID,
+		"document_id":  documentID,
+		"operator_id":  c.GetUint("userId"),
+	})
+	utils.SuccessWithMsg(c, "删除成功", nil)
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"chatbot-app/backend/services"
+)
+
+// pageParams 解析分页参数
+func pageParams(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
+
+// cursorParams 解析游标分页参数
+func cursorParams(c *gin.Context) *services.CursorPagination {
+	_, limit := pageParams(c)
+	direction := services.CURSOR_DIRECTION_NEXT
+	if c.Query("direction") == services.CURSOR_DIRECTION_PREV {
+		direction = services.CURSOR_DIRECTION_PREV
+	}
+	return &services.CursorPagination{
+		Cursor:    c.Query("cursor"),
+		Limit:     limit,
+		Direction: direction,
+	}
+}
+
+// optionalCursorParams 解析游标分页参数，limit和cursor都未传时返回nil表示不分页，兼容一次加载全部数据的客户端
+func optionalCursorParams(c *gin.Context) *services.CursorPagination {
+	if c.Query("limit") == "" && c.Query("cursor") == "" {
+		return nil
+	}
+	return cursorParams(c)
+}
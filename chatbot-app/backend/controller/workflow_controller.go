@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"chatbot-app/backend/services"
+	"chatbot-app/backend/utils"
+)
+
+// WorkflowController 工作流异步执行控制器
+type WorkflowController struct {
+	chatService        services.ChatService
+	aiModelService     *services.AIModelService
+	workflowRunService *services.WorkflowRunService
+}
+
+// NewWorkflowController 创建工作流控制器
+func NewWorkflowController() *WorkflowController {
+	return &WorkflowController{
+		chatService:        services.ChatService{},
+		aiModelService:     &services.AIModelService{},
+		workflowRunService: &services.WorkflowRunService{},
+	}
+}
+
+// StartRun 异步执行工作流
+// @Summary 异步执行工作流
+// @Description 异步执行Coze工作流，适用于耗时较长的工作流，返回执行记录，结果通过查询接口或SSE获取
+// @Tags 工作流
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param body body object{model_id=integer,chat_id=integer,content=string,inputs=object} true "工作流模型Id、可选的聊天会话Id、消息内容与表单字段"
+// @Success 200 {object} utils.Response{data=models.WorkflowRun} "执行已开始"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/workflow/run [post]
+func (controller *WorkflowController) StartRun(c *gin.Context) {
+	var req struct {
+		ModelId uint                   `json:"model_id" binding:"required" msg_required:"请选择模型"`
+		ChatId  uint                   `json:"chat_id"`
+		Content string                 `json:"content"`
+		Inputs  map[string]interface{} `json:"inputs"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.InvalidParams(c, utils.GetValidationErrorWithTagMessages(req, err))
+		return
+	}
+
+	userId := c.GetUint("userId")
+
+	selectedModel, err := controller.aiModelService.GetModelById(req.ModelId)
+	if err != nil {
+		utils.InvalidParams(c, "模型不存在，请重新选择")
+		return
+	}
+	if selectedModel.Provider != "coze" || selectedModel.Class != "workflow" || !selectedModel.Enabled {
+		utils.InvalidParams(c, "所选模型不是可用的Coze工作流")
+		return
+	}
+
+	if req.ChatId != 0 {
+		if _, err := controller.chatService.GetChatById(req.ChatId, userId); err != nil {
+			utils.NotFound(c, err.Error())
+			return
+		}
+	}
+
+	meta := &services.RequestMeta{
+		ClientIP:   c.ClientIP(),
+		FormFields: req.Inputs,
+	}
+	run, err := controller.workflowRunService.StartRun(selectedModel, userId, req.ChatId, req.Content, meta)
+	if err != nil {
+		utils.LogError("异步执行工作流失败", err, map[string]interface{}{
+			"user_id":  userId,
+			"model_id": req.ModelId,
+		})
+		utils.Error(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMsg(c, "执行已开始", run)
+}
+
+// GetRunList 获取工作流执行记录列表
+// @Summary 获取工作流执行记录列表
+// @Description 分页获取当前用户的工作流异步执行记录
+// @Tags 工作流
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param page query integer false "页码" default(1)
+// @Param limit query integer false "每页数量" default(20)
+// @Success 200 {object} utils.Response{data=object{list=array,total=integer}} "执行记录"
+// @Failure 401 {object} utils.Response "未授权"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/workflow/run [get]
+func (controller *WorkflowController) GetRunList(c *gin.Context) {
+	userId := c.GetUint("userId")
+	page, limit := pageParams(c)
+
+	runs, total, err := controller.workflowRunService.GetUserRuns(userId, page, limit)
+	if err != nil {
+		utils.LogError("获取工作流执行记录失败", err, map[string]interface{}{
+			"user_id": userId,
+		})
+		utils.Error(c, "获取执行记录失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"list":  runs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetRun 获取工作流执行记录
+// @Summary 获取工作流执行记录
+// @Description 查询工作流异步执行的状态和结果，status：running、success、fail、timeout
+// @Tags 工作流
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "执行记录Id"
+// @Success 200 {object} utils.Response{data=models.WorkflowRun} "执行记录"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 404 {object} utils.Response "执行记录不存在"
+// @Router /api/workflow/run/{id} [get]
+func (controller *WorkflowController) GetRun(c *gin.Context) {
+	runId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的执行记录Id")
+		return
+	}
+
+	run, err := controller.workflowRunService.GetRun(uint(runId), c.GetUint("userId"))
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.Success(c, run)
+}
+
+// WatchRun 通过SSE等待工作流执行结束
+// @Summary 等待工作流执行结束
+// @Description 以Server-Sent Events推送工作流执行结果，执行结束后发送run_finished事件并关闭连接
+// @Tags 工作流
+// @Produce text/event-stream
+// @Security Bearer
+// @Param id path integer true "执行记录Id"
+// @Success 200 {string} string "Server-Sent Events流式响应"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 404 {object} utils.Response "执行记录不存在"
+// @Router /api/workflow/run/{id}/events [get]
+func (controller *WorkflowController) WatchRun(c *gin.Context) {
+	runId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.InvalidParams(c, "无效的执行记录Id")
+		return
+	}
+
+	userId := c.GetUint("userId")
+	if _, err := controller.workflowRunService.GetRun(uint(runId), userId); err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Access-Control-Allow-Headers", "Cache-Control")
+	c.Writer.Flush()
+
+	run, err := controller.workflowRunService.WaitRun(c.Request.Context(), uint(runId), userId)
+	if err != nil {
+		// 客户端断开连接
+		return
+	}
+
+	finishedData, _ := json.Marshal(gin.H{
+		"type": "run_finished",
+		"run":  run,
+	})
+	c.SSEvent("message", string(finishedData))
+	c.Writer.Flush()
+}
@@ -17,6 +17,11 @@ func InitTables() error {
 		&models.Message{},
 		&models.AIModel{},
 		&models.AIModelUsage{},
+		&models.AIModelPrice{},
+		&models.CozeConversation{},
+		&models.ChatFile{},
+		&models.WorkflowRun{},
+		&models.WorkflowInterrupt{},
 	); err != nil {
 		return err
 	}
@@ -98,8 +98,8 @@ func main() {
 			return true
 		}
 
-		// 调用流式响应
-		err = cozeService.GenerateStreamResponse(message, history, userID, streamCallback)
+		// 调用流式响应，聊天Id为0时不保存Coze会话映射
+		_, err = cozeService.GenerateStreamResponse(0, message, history, userID, nil, streamCallback)
 		if err != nil {
 			log.Printf("流式响应测试失败: %v", err)
 		}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
+
 	"chatbot-app/backend/config"
 	"chatbot-app/backend/database"
 	_ "chatbot-app/backend/docs" // 导入swagger文档
 	"chatbot-app/backend/middleware"
 	"chatbot-app/backend/router"
+	"chatbot-app/backend/services"
 	"chatbot-app/backend/utils"
+	"chatbot-app/backend/utils/coze"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -71,6 +75,19 @@ func main() {
 	}
 	utils.LogInfo("Redis连接成功")
 
+	// 加载模型注册表并订阅模型变更通知
+	services.GetModelRegistry().Start(context.Background())
+	utils.LogInfo("模型注册表加载完成")
+
+	// 启动Coze Token后台刷新，配置不完整时Coze模型不可用但不影响启动
+	coze.GetTokenManager().Start(context.Background())
+
+	// 启动工作流异步执行结果轮询
+	services.GetWorkflowRunWorker().Start(context.Background())
+
+	// 订阅停止生成通知
+	services.GetChatStreamRegistry().Start(context.Background())
+
 	// 创建Gin引擎
 	r := gin.New()
 	// default 默认包含Recovery、 Logger 中间件
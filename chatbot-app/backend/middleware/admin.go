@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"chatbot-app/backend/services"
+	"chatbot-app/backend/utils"
+)
+
+// AdminOnly 仅允许管理员访问，需在Auth中间件之后使用
+func AdminOnly() gin.HandlerFunc {
+	userService := services.UserService{}
+	return func(c *gin.Context) {
+		user, err := userService.GetUserById(c.GetUint("userId"))
+		if err != nil || user.Role != "admin" {
+			utils.LogWarn("非管理员访问管理接口", map[string]interface{}{
+				"user_id": c.GetUint("userId"),
+				"path":    c.Request.URL.Path,
+				"ip":      c.ClientIP(),
+			})
+			utils.Forbidden(c, "无权访问")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
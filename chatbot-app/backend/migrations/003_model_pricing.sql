@@ -0,0 +1,30 @@
+-- 使用数据库
+USE chatbot;
+
+-- AI模型价格字段（每百万Token）
+ALTER TABLE `ai_model`
+  ADD COLUMN `input_price` decimal(12,6) NOT NULL DEFAULT '0.000000' COMMENT '输入价格(每百万Token)',
+  ADD COLUMN `output_price` decimal(12,6) NOT NULL DEFAULT '0.000000' COMMENT '输出价格(每百万Token)',
+  ADD COLUMN `currency` varchar(10) COLLATE utf8mb4_general_ci NOT NULL DEFAULT 'CNY' COMMENT '计价货币';
+
+-- AI模型价格历史表
+CREATE TABLE IF NOT EXISTS ai_model_price (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    model_id INT UNSIGNED NOT NULL COMMENT 'AI模型Id',
+    input_price DECIMAL(12,6) NOT NULL DEFAULT 0 COMMENT '输入价格(每百万Token)',
+    output_price DECIMAL(12,6) NOT NULL DEFAULT 0 COMMENT '输出价格(每百万Token)',
+    currency VARCHAR(10) NOT NULL DEFAULT 'CNY' COMMENT '计价货币',
+    effective_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '生效时间',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_model_id (model_id),
+    INDEX idx_effective_at (effective_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- 使用记录保存计费时的价格快照，价格调整后历史费用不变
+ALTER TABLE ai_model_usage
+  ADD COLUMN chat_id INT UNSIGNED DEFAULT NULL COMMENT '聊天会话Id' AFTER model_id,
+  ADD COLUMN input_price DECIMAL(12,6) DEFAULT 0 COMMENT '计费时的输入价格(每百万Token)' AFTER error_msg,
+  ADD COLUMN output_price DECIMAL(12,6) DEFAULT 0 COMMENT '计费时的输出价格(每百万Token)' AFTER input_price,
+  ADD COLUMN currency VARCHAR(10) DEFAULT NULL COMMENT '计价货币' AFTER output_price,
+  MODIFY COLUMN cost DECIMAL(12,6) DEFAULT 0 COMMENT '计费金额',
+  ADD INDEX idx_chat_id (chat_id);
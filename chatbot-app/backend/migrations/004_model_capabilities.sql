@@ -0,0 +1,29 @@
+-- 使用数据库
+USE chatbot;
+
+-- AI模型能力字段
+ALTER TABLE `ai_model`
+  ADD COLUMN `context_window` int(11) NOT NULL DEFAULT '0' COMMENT '上下文窗口大小(Token)，0表示未知',
+  ADD COLUMN `supports_vision` tinyint(1) NOT NULL DEFAULT '0' COMMENT '是否支持图片理解',
+  ADD COLUMN `supports_tools` tinyint(1) NOT NULL DEFAULT '0' COMMENT '是否支持工具调用',
+  ADD COLUMN `supports_json_mode` tinyint(1) NOT NULL DEFAULT '0' COMMENT '是否支持JSON输出模式',
+  ADD COLUMN `supports_streaming` tinyint(1) NOT NULL DEFAULT '1' COMMENT '是否支持流式输出',
+  ADD COLUMN `supports_reasoning` tinyint(1) NOT NULL DEFAULT '0' COMMENT '是否为推理模型';
+
+-- 智谱文本模型
+UPDATE `ai_model` SET `context_window` = 128000, `supports_tools` = 1, `supports_json_mode` = 1
+WHERE `provider` = 'zhipu' AND `name` IN ('glm-4-plus', 'glm-4-air-250414', 'glm-4-flashx', 'glm-4-flash-250414');
+
+UPDATE `ai_model` SET `context_window` = 8000, `supports_tools` = 1, `supports_json_mode` = 1
+WHERE `provider` = 'zhipu' AND `name` = 'glm-4-airx';
+
+UPDATE `ai_model` SET `context_window` = 1000000, `supports_tools` = 1
+WHERE `provider` = 'zhipu' AND `name` = 'glm-4-long';
+
+-- 智谱推理模型
+UPDATE `ai_model` SET `context_window` = 32000, `supports_reasoning` = 1
+WHERE `provider` = 'zhipu' AND `name` IN ('glm-z1-air', 'glm-z1-airx', 'glm-z1-flash');
+
+-- 智谱视觉模型
+UPDATE `ai_model` SET `context_window` = 16000, `supports_vision` = 1
+WHERE `provider` = 'zhipu' AND `name` IN ('glm-4v-plus-0111', 'glm-4v-flash');
@@ -0,0 +1,13 @@
+-- 使用数据库
+USE chatbot;
+
+-- 聊天会话与Coze会话映射表
+CREATE TABLE IF NOT EXISTS coze_conversation (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    chat_id INT UNSIGNED NOT NULL COMMENT '聊天会话Id',
+    bot_id VARCHAR(25) NOT NULL COMMENT 'Coze智能体Id',
+    conversation_id VARCHAR(32) NOT NULL COMMENT 'Coze会话Id',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    UNIQUE KEY idx_chat_bot (chat_id, bot_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -0,0 +1,15 @@
+-- 使用数据库
+USE chatbot;
+
+-- 工作流输入参数改为按模型配置模板，原先写死在代码中的参数迁移到模型配置
+-- 支持的占位符: {{user_id}} {{client_ip}} {{chat_id}} {{message}} {{form.字段名}} {{env.变量名}}
+-- 工作流凭据不写入数据库，通过WORKFLOW_TOKEN环境变量传入
+UPDATE `ai_model`
+SET `api_parameters` = JSON_OBJECT(
+    'workflow_parameters', JSON_OBJECT(
+        'input', '{{message}}',
+        'ip', '{{client_ip}}',
+        'token', '{{env.WORKFLOW_TOKEN}}'
+    )
+)
+WHERE `provider` = 'coze' AND `class` = 'workflow' AND `class_id` = '7534632837212307495' AND `api_parameters` IS NULL;
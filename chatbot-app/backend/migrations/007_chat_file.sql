@@ -0,0 +1,18 @@
+-- 使用数据库
+USE chatbot;
+
+-- 聊天附件表
+CREATE TABLE IF NOT EXISTS chat_file (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    chat_id INT UNSIGNED NOT NULL COMMENT '聊天会话Id',
+    user_id INT UNSIGNED NOT NULL COMMENT '上传用户Id',
+    message_id INT UNSIGNED NOT NULL DEFAULT 0 COMMENT '关联的消息Id，0表示未使用',
+    file_name VARCHAR(255) NOT NULL COMMENT '原始文件名',
+    file_path VARCHAR(255) NOT NULL COMMENT '本地存储路径',
+    mime_type VARCHAR(100) COMMENT '文件类型',
+    size BIGINT NOT NULL DEFAULT 0 COMMENT '文件大小(字节)',
+    coze_file_id VARCHAR(32) COMMENT 'Coze文件Id',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    INDEX idx_chat_id (chat_id),
+    INDEX idx_message_id (message_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
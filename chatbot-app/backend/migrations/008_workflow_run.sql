@@ -0,0 +1,25 @@
+-- 使用数据库
+USE chatbot;
+
+-- Coze工作流异步执行记录表
+CREATE TABLE IF NOT EXISTS workflow_run (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id INT UNSIGNED NOT NULL COMMENT '用户Id',
+    chat_id INT UNSIGNED NOT NULL DEFAULT 0 COMMENT '聊天会话Id',
+    model_id INT UNSIGNED NOT NULL COMMENT '模型Id',
+    workflow_id VARCHAR(25) NOT NULL COMMENT 'Coze工作流Id',
+    execute_id VARCHAR(32) NOT NULL COMMENT 'Coze执行Id',
+    status VARCHAR(20) NOT NULL COMMENT '状态：running、success、fail、timeout',
+    inputs JSON COMMENT '输入参数',
+    output LONGTEXT COMMENT '工作流输出',
+    error_message TEXT COMMENT '错误信息',
+    debug_url VARCHAR(500) COMMENT '调试地址',
+    token_count INT NOT NULL DEFAULT 0 COMMENT '消耗Token数',
+    finished_at TIMESTAMP NULL COMMENT '完成时间',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    UNIQUE KEY idx_execute_id (execute_id),
+    INDEX idx_user_id (user_id),
+    INDEX idx_chat_id (chat_id),
+    INDEX idx_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
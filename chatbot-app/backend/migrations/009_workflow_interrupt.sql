@@ -0,0 +1,21 @@
+-- 使用数据库
+USE chatbot;
+
+-- Coze工作流中断记录表
+CREATE TABLE IF NOT EXISTS workflow_interrupt (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    chat_id INT UNSIGNED NOT NULL COMMENT '聊天会话Id',
+    user_id INT UNSIGNED NOT NULL COMMENT '用户Id',
+    model_id INT UNSIGNED NOT NULL COMMENT '模型Id',
+    workflow_id VARCHAR(25) NOT NULL COMMENT 'Coze工作流Id',
+    event_id VARCHAR(64) NOT NULL COMMENT 'Coze中断事件Id',
+    interrupt_type INT NOT NULL DEFAULT 0 COMMENT 'Coze中断类型',
+    node_title VARCHAR(100) COMMENT '中断节点名称',
+    question TEXT COMMENT '工作流提出的问题',
+    message_id INT UNSIGNED NOT NULL DEFAULT 0 COMMENT '问题对应的AI消息Id',
+    status VARCHAR(20) NOT NULL COMMENT '状态：pending、resumed',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    INDEX idx_chat_id (chat_id),
+    INDEX idx_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
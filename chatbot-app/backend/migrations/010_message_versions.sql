@@ -0,0 +1,8 @@
+-- 使用数据库
+USE chatbot;
+
+-- 消息回复版本字段，重新生成的AI回复共享reply_to_id，旧版本active为0
+ALTER TABLE `message`
+  ADD COLUMN `reply_to_id` int(10) unsigned NOT NULL DEFAULT '0' COMMENT 'AI回复对应的用户消息Id',
+  ADD COLUMN `active` tinyint(1) NOT NULL DEFAULT '1' COMMENT '是否为当前采用的回复版本',
+  ADD INDEX `idx_message_reply_to_id` (`reply_to_id`);
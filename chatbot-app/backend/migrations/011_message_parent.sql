@@ -0,0 +1,17 @@
+-- 使用数据库
+USE chatbot;
+
+-- 消息通过parent_id组成树，编辑历史消息或重新生成回复时形成新的分支
+ALTER TABLE `message`
+  CHANGE COLUMN `reply_to_id` `parent_id` int(10) unsigned NOT NULL DEFAULT '0' COMMENT '父消息Id，0表示第一条消息',
+  RENAME INDEX `idx_message_reply_to_id` TO `idx_message_parent_id`;
+
+-- 已有消息按时间顺序串成一条分支，重新生成的回复已记录对应的用户消息
+UPDATE `message` m
+JOIN (
+  SELECT `id`, LAG(`id`) OVER (PARTITION BY `chat_id` ORDER BY `id`) AS `prev_id`
+  FROM `message`
+  WHERE `active` = 1
+) p ON m.`id` = p.`id`
+SET m.`parent_id` = IFNULL(p.`prev_id`, 0)
+WHERE m.`parent_id` = 0;
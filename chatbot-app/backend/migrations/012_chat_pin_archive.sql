@@ -0,0 +1,7 @@
+-- 使用数据库
+USE chatbot;
+
+-- 聊天会话置顶与归档
+ALTER TABLE `chat`
+  ADD COLUMN `pinned` tinyint(1) NOT NULL DEFAULT '0' COMMENT '是否置顶',
+  ADD COLUMN `archived` tinyint(1) NOT NULL DEFAULT '0' COMMENT '是否归档';
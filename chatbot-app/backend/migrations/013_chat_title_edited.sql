@@ -0,0 +1,6 @@
+-- 使用数据库
+USE chatbot;
+
+-- 记录用户是否修改过会话标题，修改后不再自动生成
+ALTER TABLE `chat`
+  ADD COLUMN `title_edited` tinyint(1) NOT NULL DEFAULT '0' COMMENT '用户是否修改过标题';
@@ -0,0 +1,9 @@
+-- 使用数据库
+USE chatbot;
+
+-- 聊天搜索使用的全文索引，ngram解析器支持中文分词（需MySQL 5.7.6+，ngram_token_size默认为2）
+ALTER TABLE `message`
+  ADD FULLTEXT INDEX `ft_message_content` (`content`) WITH PARSER ngram;
+
+ALTER TABLE `chat`
+  ADD FULLTEXT INDEX `ft_chat_title` (`title`) WITH PARSER ngram;
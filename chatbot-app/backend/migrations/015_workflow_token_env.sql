@@ -0,0 +1,8 @@
+-- 使用数据库
+USE chatbot;
+
+-- 已执行过006的数据库中，工作流token为写死的凭据，改为从WORKFLOW_TOKEN环境变量读取
+UPDATE `ai_model`
+SET `api_parameters` = JSON_SET(`api_parameters`, '$.workflow_parameters.token', '{{env.WORKFLOW_TOKEN}}')
+WHERE `provider` = 'coze' AND `class` = 'workflow' AND `class_id` = '7534632837212307495'
+  AND JSON_UNQUOTE(JSON_EXTRACT(`api_parameters`, '$.workflow_parameters.token')) LIKE 'user:%';
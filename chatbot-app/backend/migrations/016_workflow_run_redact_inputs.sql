@@ -0,0 +1,8 @@
+-- 使用数据库
+USE chatbot;
+
+-- 历史执行记录中保存了工作流token原值，执行记录会返回给用户，统一隐藏
+UPDATE `workflow_run`
+SET `inputs` = JSON_SET(`inputs`, '$.token', '******')
+WHERE JSON_EXTRACT(`inputs`, '$.token') IS NOT NULL
+  AND JSON_UNQUOTE(JSON_EXTRACT(`inputs`, '$.token')) <> '******';
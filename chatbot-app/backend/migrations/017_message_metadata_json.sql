@@ -0,0 +1,12 @@
+-- 使用数据库
+USE chatbot;
+
+-- 消息元数据中保存了思考过程、推荐追问和插件调用等过程信息，VARCHAR(255)放不下，改为JSON类型；
+-- 修改类型前先清空被截断或不是合法JSON的旧数据
+UPDATE `message`
+SET `metadata` = NULL
+WHERE `metadata` IS NOT NULL
+  AND JSON_VALID(`metadata`) = 0;
+
+ALTER TABLE `message`
+  MODIFY COLUMN `metadata` JSON NULL COMMENT '元数据，如模型Id、思考过程、推荐追问等';
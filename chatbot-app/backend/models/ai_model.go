@@ -8,26 +8,35 @@ import (
 
 // AIModel AI模型配置
 type AIModel struct {
-	Id               uint           `json:"id" gorm:"primaryKey"`
-	Name             string         `json:"name" gorm:"size:50;not null;uniqueIndex"` // 模型名称，如zhipu-glm-4
-	DisplayName      string         `json:"display_name" gorm:"size:100;not null"`    // 显示名称，如智谱GLM-4
-	Provider         string         `json:"provider" gorm:"size:50;not null"`         // 提供商，如zhipu、openai
-	Type             string         `json:"type" gorm:"size:20;not null"`             // 类型，如chat、image
-	URL              string         `json:"url" gorm:"size:255"`                      // API请求URL
-	MaxTokens        int            `json:"max_tokens" gorm:"default:2048"`           // 最大Token数
-	Temperature      float64        `json:"temperature" gorm:"default:0.7"`           // 温度参数
-	TopP             float64        `json:"top_p" gorm:"default:0.9"`                 // Top-P参数
-	PresencePenalty  float64        `json:"presence_penalty" gorm:"default:0"`        // 重复惩罚
-	FrequencyPenalty float64        `json:"frequency_penalty" gorm:"default:0"`       // 频率惩罚
-	Enabled          bool           `json:"enabled" gorm:"default:true"`              // 是否启用
-	IsDefault        bool           `json:"is_default" gorm:"default:false"`          // 是否为默认模型
-	ApiParameters    string         `json:"api_parameters" gorm:"type:json"`          // API参数(JSON格式)
-	Description      string         `json:"description" gorm:"type:text"`             // 模型描述
-	Class            string         `json:"class" gorm:"size:10"`                     // 大分类 workflow、bot、bigmodal
-	ClassId          string         `json:"class_id" gorm:"size:25"`                  // coze大分类的id,对应workflow_id,bot_id等
-	CreatedAt        time.Time      `json:"created_at"`
-	UpdatedAt        time.Time      `json:"updated_at"`
-	DeletedAt        gorm.DeletedAt `json:"-"`
+	Id                uint           `json:"id" gorm:"primaryKey"`
+	Name              string         `json:"name" gorm:"size:50;not null;uniqueIndex"`         // 模型名称，如zhipu-glm-4
+	DisplayName       string         `json:"display_name" gorm:"size:100;not null"`            // 显示名称，如智谱GLM-4
+	Provider          string         `json:"provider" gorm:"size:50;not null"`                 // 提供商，如zhipu、openai
+	Type              string         `json:"type" gorm:"size:20;not null"`                     // 类型，如chat、image
+	URL               string         `json:"url" gorm:"size:255"`                              // API请求URL
+	MaxTokens         int            `json:"max_tokens" gorm:"default:2048"`                   // 最大Token数
+	Temperature       float64        `json:"temperature" gorm:"default:0.7"`                   // 温度参数
+	TopP              float64        `json:"top_p" gorm:"default:0.9"`                         // Top-P参数
+	PresencePenalty   float64        `json:"presence_penalty" gorm:"default:0"`                // 重复惩罚
+	FrequencyPenalty  float64        `json:"frequency_penalty" gorm:"default:0"`               // 频率惩罚
+	Enabled           bool           `json:"enabled" gorm:"default:true"`                      // 是否启用
+	IsDefault         bool           `json:"is_default" gorm:"default:false"`                  // 是否为默认模型
+	ApiParameters     string         `json:"api_parameters,omitempty" gorm:"type:json"`        // API参数(JSON格式)，可能包含凭据，不对普通用户返回
+	Description       string         `json:"description" gorm:"type:text"`                     // 模型描述
+	Class             string         `json:"class" gorm:"size:10"`                             // 大分类 workflow、bot、bigmodal
+	ClassId           string         `json:"class_id" gorm:"size:25"`                          // coze大分类的id,对应workflow_id,bot_id等
+	InputPrice        float64        `json:"input_price" gorm:"type:decimal(12,6);default:0"`  // 输入价格(每百万Token)
+	OutputPrice       float64        `json:"output_price" gorm:"type:decimal(12,6);default:0"` // 输出价格(每百万Token)
+	Currency          string         `json:"currency" gorm:"size:10;default:'CNY'"`            // 计价货币
+	ContextWindow     int            `json:"context_window" gorm:"default:0"`                  // 上下文窗口大小(Token)，0表示未知
+	SupportsVision    bool           `json:"supports_vision" gorm:"default:false"`             // 是否支持图片理解
+	SupportsTools     bool           `json:"supports_tools" gorm:"default:false"`              // 是否支持工具调用
+	SupportsJSONMode  bool           `json:"supports_json_mode" gorm:"default:false"`          // 是否支持JSON输出模式
+	SupportsStreaming bool           `json:"supports_streaming" gorm:"default:true"`           // 是否支持流式输出
+	SupportsReasoning bool           `json:"supports_reasoning" gorm:"default:false"`          // 是否为推理模型
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-"`
 }
 
 // AIModelUsage AI模型使用记录
@@ -35,6 +44,7 @@ type AIModelUsage struct {
 	Id               uint           `json:"id" gorm:"primaryKey"`
 	UserId           uint           `json:"user_id" gorm:"not null;index"`
 	ModelId          uint           `json:"model_id" gorm:"not null;index"`
+	ChatId           uint           `json:"chat_id" gorm:"index"`
 	MessageId        uint           `json:"message_id" gorm:"index"`
 	Prompt           string         `json:"prompt" gorm:"type:text"`
 	Response         string         `json:"response" gorm:"type:text"`
@@ -44,11 +54,25 @@ type AIModelUsage struct {
 	Duration         int            `json:"duration" gorm:"default:0"`      // 耗时(毫秒)
 	Status           string         `json:"status" gorm:"size:20;not null"` // 状态: success, error
 	ErrorMsg         string         `json:"error_msg" gorm:"type:text"`
-	Cost             float64        `json:"cost" gorm:"default:0"` // 计费金额
+	InputPrice       float64        `json:"input_price" gorm:"type:decimal(12,6);default:0"`  // 计费时的输入价格(每百万Token)
+	OutputPrice      float64        `json:"output_price" gorm:"type:decimal(12,6);default:0"` // 计费时的输出价格(每百万Token)
+	Currency         string         `json:"currency" gorm:"size:10"`                          // 计价货币
+	Cost             float64        `json:"cost" gorm:"type:decimal(12,6);default:0"`         // 计费金额
 	CreatedAt        time.Time      `json:"created_at"`
 	DeletedAt        gorm.DeletedAt `json:"-"`
 }
 
+// AIModelPrice AI模型价格历史
+type AIModelPrice struct {
+	Id          uint      `json:"id" gorm:"primaryKey"`
+	ModelId     uint      `json:"model_id" gorm:"not null;index"`
+	InputPrice  float64   `json:"input_price" gorm:"type:decimal(12,6);default:0"`  // 输入价格(每百万Token)
+	OutputPrice float64   `json:"output_price" gorm:"type:decimal(12,6);default:0"` // 输出价格(每百万Token)
+	Currency    string    `json:"currency" gorm:"size:10;not null"`                 // 计价货币
+	EffectiveAt time.Time `json:"effective_at" gorm:"not null;index"`               // 生效时间
+	CreatedAt   time.Time `json:"created_at"`
+}
+
 // TableName 定义表名
 func (AIModel) TableName() string {
 	return "ai_model"
@@ -58,3 +82,8 @@ func (AIModel) TableName() string {
 func (AIModelUsage) TableName() string {
 	return "ai_model_usage"
 }
+
+// TableName 定义表名
+func (AIModelPrice) TableName() string {
+	return "ai_model_price"
+}
@@ -8,14 +8,17 @@ import (
 
 // Chat 聊天会话模型
 type Chat struct {
-	Id        uint           `json:"id" gorm:"primaryKey"`
-	Type      string         `json:"type" gorm:"not null" `
-	UserId    uint           `json:"user_id" gorm:"not null;index"`
-	Title     string         `json:"title" gorm:"size:100"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-"`
-	Messages  []Message      `json:"messages"`
+	Id          uint           `json:"id" gorm:"primaryKey"`
+	Type        string         `json:"type" gorm:"not null" `
+	UserId      uint           `json:"user_id" gorm:"not null;index"`
+	Title       string         `json:"title" gorm:"size:100"`
+	Pinned      bool           `json:"pinned" gorm:"default:false"`       // 是否置顶
+	Archived    bool           `json:"archived" gorm:"default:false"`     // 是否归档，归档的会话默认不在列表中显示
+	TitleEdited bool           `json:"title_edited" gorm:"default:false"` // 用户是否修改过标题，修改后不再自动生成
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-"`
+	Messages    []Message      `json:"messages"`
 }
 
 // Message 聊天消息模型
@@ -24,12 +27,35 @@ type Message struct {
 	ChatId    uint           `json:"chat_id" gorm:"not null;index"`
 	Role      string         `json:"role" gorm:"size:10;not null"` // user 或 assistant
 	Content   string         `json:"content" gorm:"type:text;not null"`
-	ModelId   uint           `json:"model_id" gorm:"index"`     // AI模型Id
-	Tokens    int            `json:"tokens" gorm:"default:0"`   // 消息的token数量
-	Metadata  string         `json:"metadata" gorm:"type:json"` // 存储JSON格式的元数据
+	ModelId   uint           `json:"model_id" gorm:"index"`            // AI模型Id
+	Tokens    int            `json:"tokens" gorm:"default:0"`          // 消息的token数量
+	Metadata  string         `json:"metadata" gorm:"type:json"`        // 存储JSON格式的元数据
+	ParentId  uint           `json:"parent_id" gorm:"index;default:0"` // 父消息Id，0表示第一条消息；同一父消息下的多条消息为不同分支或回复版本
+	Active    bool           `json:"active" gorm:"default:true"`       // 是否为同级消息中当前选中的分支
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-"`
+	Files     []ChatFile     `json:"files,omitempty" gorm:"foreignKey:MessageId"` // 消息附件
+}
+
+// MessageTrace 智能体回复过程中的插件调用、知识库召回等过程信息
+type MessageTrace struct {
+	Type    string `json:"type"`    // 过程类型，如function_call、tool_response、knowledge_recall
+	Content string `json:"content"` // 过程内容，通常为JSON
+}
+
+// ChatFile 聊天附件
+type ChatFile struct {
+	Id         uint      `json:"id" gorm:"primaryKey"`
+	ChatId     uint      `json:"chat_id" gorm:"not null;index"`
+	UserId     uint      `json:"user_id" gorm:"not null"`
+	MessageId  uint      `json:"message_id" gorm:"index;default:0"` // 发送消息后关联的消息Id，0表示未使用
+	FileName   string    `json:"file_name" gorm:"size:255;not null"`
+	FilePath   string    `json:"-" gorm:"size:255;not null"` // 本地存储路径
+	MimeType   string    `json:"mime_type" gorm:"size:100"`
+	Size       int64     `json:"size"`
+	CozeFileId string    `json:"coze_file_id" gorm:"size:32"` // 上传到Coze后的文件Id
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 // TableName 定义表名
@@ -41,3 +67,8 @@ func (Chat) TableName() string {
 func (Message) TableName() string {
 	return "message"
 }
+
+// TableName 定义表名
+func (ChatFile) TableName() string {
+	return "chat_file"
+}
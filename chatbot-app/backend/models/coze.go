@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// CozeConversation 聊天会话与Coze会话的映射
+type CozeConversation struct {
+	Id             uint      `json:"id" gorm:"primaryKey"`
+	ChatId         uint      `json:"chat_id" gorm:"not null;uniqueIndex:idx_chat_bot"`
+	BotId          string    `json:"bot_id" gorm:"size:25;not null;uniqueIndex:idx_chat_bot"` // Coze智能体Id
+	ConversationId string    `json:"conversation_id" gorm:"size:32;not null"`                 // Coze会话Id
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TableName 定义表名
+func (CozeConversation) TableName() string {
+	return "coze_conversation"
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// WorkflowInterrupt Coze工作流中断记录，工作流等待用户输入时保存，用户回答后恢复执行
+type WorkflowInterrupt struct {
+	Id            uint      `json:"id" gorm:"primaryKey"`
+	ChatId        uint      `json:"chat_id" gorm:"not null;index"`
+	UserId        uint      `json:"user_id" gorm:"not null"`
+	ModelId       uint      `json:"model_id" gorm:"not null"`
+	WorkflowId    string    `json:"workflow_id" gorm:"size:25;not null"`
+	EventId       string    `json:"-" gorm:"size:64;not null"` // Coze中断事件Id，恢复时回传
+	InterruptType int       `json:"-" gorm:"default:0"`        // Coze中断类型，恢复时回传
+	NodeTitle     string    `json:"node_title" gorm:"size:100"`
+	Question      string    `json:"question" gorm:"type:text"`            // 工作流向用户提出的问题
+	MessageId     uint      `json:"message_id" gorm:"default:0"`          // 问题对应的AI消息Id
+	Status        string    `json:"status" gorm:"size:20;not null;index"` // pending、resumed
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TableName 定义表名
+func (WorkflowInterrupt) TableName() string {
+	return "workflow_interrupt"
+}
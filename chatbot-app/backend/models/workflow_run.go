@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// WorkflowRun Coze工作流异步执行记录
+type WorkflowRun struct {
+	Id           uint       `json:"id" gorm:"primaryKey"`
+	UserId       uint       `json:"user_id" gorm:"not null;index"`
+	ChatId       uint       `json:"chat_id" gorm:"index;default:0"`
+	ModelId      uint       `json:"model_id" gorm:"not null"`
+	WorkflowId   string     `json:"workflow_id" gorm:"size:25;not null"`
+	ExecuteId    string     `json:"execute_id" gorm:"size:32;not null;uniqueIndex"`
+	Status       string     `json:"status" gorm:"size:20;not null;index"` // running、success、fail、timeout
+	Inputs       string     `json:"inputs" gorm:"type:json"`              // 工作流输入参数(JSON)
+	Output       string     `json:"output" gorm:"type:longtext"`          // 工作流输出
+	ErrorMessage string     `json:"error_message" gorm:"type:text"`
+	DebugUrl     string     `json:"debug_url" gorm:"size:500"`
+	TokenCount   int        `json:"token_count" gorm:"default:0"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableName 定义表名
+func (WorkflowRun) TableName() string {
+	return "workflow_run"
+}
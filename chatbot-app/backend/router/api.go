@@ -3,6 +3,7 @@ package router
 import (
 	"chatbot-app/backend/controller"
 	"chatbot-app/backend/middleware"
+	"chatbot-app/backend/services"
 
 	"github.com/gin-gonic/gin"
 
@@ -13,7 +14,7 @@ import (
 func SetupRouter(r *gin.Engine) {
 	// 健康检查路由
 	// @Summary 健康检查
-	// @Description 检查API服务是否正常运行
+	// @Description 检查API服务是否正常运行，providers返回各模型提供商是否可用，不可用的原因记录在服务日志中
 	// @Tags 系统
 	// @Accept json
 	// @Produce json
@@ -40,8 +41,22 @@ func SetupRouter(r *gin.Engine) {
 		{
 			chat.POST("", chatController.CreateChat)
 			chat.GET("", chatController.GetUserChatList)
+			chat.GET("/trash", chatController.GetDeletedChatList)
+			chat.GET("/search", chatController.SearchChats)
+			chat.GET("/export", chatController.ExportAllChats)
+			chat.POST("/import", chatController.ImportChats)
+			chat.PATCH("/:id", chatController.UpdateChat)
+			chat.DELETE("/:id", chatController.DeleteChat)
+			chat.POST("/:id/restore", chatController.RestoreChat)
 			chat.GET("/:id/message", chatController.GetChatMessageList)
 			chat.POST("/:id/message", chatController.SendMessage)
+			chat.POST("/:id/message/:messageId/regenerate", chatController.RegenerateMessage)
+			chat.POST("/:id/message/:messageId/select", chatController.SelectMessageBranch)
+			chat.GET("/:id/cost", chatController.GetChatCost)
+			chat.GET("/:id/export", chatController.ExportChat)
+			chat.POST("/:id/file", chatController.UploadChatFile)
+			chat.POST("/:id/workflow/resume", chatController.ResumeWorkflow)
+			chat.POST("/:id/stop", chatController.StopMessage)
 		}
 		// AI模型相关路由
 		ai := api.Group("/ai")
@@ -49,6 +64,32 @@ func SetupRouter(r *gin.Engine) {
 		{
 			ai.GET("/model", aiModelController.GetAvailableModelList)
 			ai.GET("/model_usage", aiModelController.GetModelUsageHandler)
+			ai.GET("/cost", aiModelController.GetUserCostHandler)
+			ai.POST("/model/coze/sync", middleware.AdminOnly(), aiModelController.SyncCozeModels)
+			ai.PATCH("/model/:id", middleware.AdminOnly(), aiModelController.UpdateModel)
+			ai.GET("/model/:id/price", middleware.AdminOnly(), aiModelController.GetModelPriceHistory)
+			ai.POST("/model/:id/price", middleware.AdminOnly(), aiModelController.SetModelPrice)
+		}
+		// 工作流异步执行路由
+		workflow := api.Group("/workflow")
+		workflowController := controller.NewWorkflowController()
+		{
+			workflow.POST("/run", workflowController.StartRun)
+			workflow.GET("/run", workflowController.GetRunList)
+			workflow.GET("/run/:id", workflowController.GetRun)
+			workflow.GET("/run/:id/events", workflowController.WatchRun)
+		}
+		// 知识库管理路由（管理员）
+		knowledge := api.Group("/knowledge", middleware.AdminOnly())
+		knowledgeController := controller.NewKnowledgeController()
+		{
+			knowledge.POST("", knowledgeController.CreateKnowledge)
+			knowledge.GET("", knowledgeController.GetKnowledgeList)
+			knowledge.DELETE("/:id", knowledgeController.DeleteKnowledge)
+			knowledge.POST("/:id/document", knowledgeController.UploadDocument)
+			knowledge.GET("/:id/document", knowledgeController.GetDocumentList)
+			knowledge.GET("/:id/document/progress", knowledgeController.GetDocumentProgress)
+			knowledge.DELETE("/:id/document/:documentId", knowledgeController.DeleteDocument)
 		}
 	}
 }
@@ -63,6 +104,7 @@ func SetupRouter(r *gin.Engine) {
 // @Router /health [get]
 func healthCheckHandler(c *gin.Context) {
 	utils.Success(c, gin.H{
-		"status": "ok",
+		"status":    "ok",
+		"providers": services.GetProviderStatus(),
 	})
 }
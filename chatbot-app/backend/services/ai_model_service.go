@@ -1,40 +1,239 @@
 package services
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
 
 	"chatbot-app/backend/database"
 	"chatbot-app/backend/models"
+	"chatbot-app/backend/utils"
+	"chatbot-app/backend/utils/coze"
+)
+
+const (
+	// DefaultCurrency 默认计价货币
+	DefaultCurrency = "CNY"
+	// tokensPerPriceUnit 价格对应的Token数量（每百万Token）
+	tokensPerPriceUnit = 1000000
 )
 
 // AIModelService AI模型服务
 type AIModelService struct{}
 
+// ModelListFilter 模型列表过滤与排序条件
+type ModelListFilter struct {
+	Type             string // 模型类型，如chat、image
+	Provider         string // 提供商
+	MinContextWindow int    // 最小上下文窗口
+	Vision           bool   // 需要图片理解
+	Tools            bool   // 需要工具调用
+	JSONMode         bool   // 需要JSON输出模式
+	Streaming        bool   // 需要流式输出
+	Reasoning        bool   // 需要推理能力
+	SortBy           string // 排序字段
+	Order            string // 排序方向 asc、desc
+}
+
+// modelSortColumns 允许排序的字段
+var modelSortColumns = map[string]string{
+	"id":             "id",
+	"name":           "name",
+	"display_name":   "display_name",
+	"provider":       "provider",
+	"context_window": "context_window",
+	"input_price":    "input_price",
+	"output_price":   "output_price",
+}
+
 // GetAllModelList 获取所有启用的AI模型
 func (s *AIModelService) GetAllModelList(chatType string) ([]models.AIModel, error) {
+	return s.GetModelList(&ModelListFilter{Type: chatType})
+}
+
+// GetModelList 按能力过滤并排序获取启用的AI模型
+func (s *AIModelService) GetModelList(filter *ModelListFilter) ([]models.AIModel, error) {
+	if filter == nil {
+		filter = &ModelListFilter{}
+	}
+
 	var aiModelList []models.AIModel
 	query := database.DB.Where("enabled = ?", true)
-	if chatType != "" {
-		query = query.Where("type = ?", chatType)
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Provider != "" {
+		query = query.Where("provider = ?", filter.Provider)
+	}
+	if filter.MinContextWindow > 0 {
+		query = query.Where("context_window >= ?", filter.MinContextWindow)
+	}
+	if filter.Vision {
+		query = query.Where("supports_vision = ?", true)
+	}
+	if filter.Tools {
+		query = query.Where("supports_tools = ?", true)
+	}
+	if filter.JSONMode {
+		query = query.Where("supports_json_mode = ?", true)
 	}
+	if filter.Streaming {
+		query = query.Where("supports_streaming = ?", true)
+	}
+	if filter.Reasoning {
+		query = query.Where("supports_reasoning = ?", true)
+	}
+
+	// 排序字段使用白名单，防止SQL注入
+	column, ok := modelSortColumns[filter.SortBy]
+	if !ok {
+		column = "id"
+	}
+	direction := "ASC"
+	if strings.EqualFold(filter.Order, "desc") {
+		direction = "DESC"
+	}
+	query = query.Order(column + " " + direction)
+	if column != "id" {
+		query = query.Order("id ASC")
+	}
+
 	if err := query.Find(&aiModelList).Error; err != nil {
 		return nil, err
 	}
 	return aiModelList, nil
 }
 
-// GetModelById 根据Id获取AI模型
+// ModelRequirement 一次请求对模型能力的要求
+type ModelRequirement struct {
+	Type           string // 会话类型
+	Streaming      bool   // 需要流式输出
+	Vision         bool   // 需要图片理解
+	Tools          bool   // 需要工具调用
+	JSONMode       bool   // 需要JSON输出模式
+	ContextTokens  int    // 预估的上下文Token数
+	ResponseTokens int    // 预留的回复Token数
+}
+
+// CheckProviderAvailable 检查模型提供商是否可用，配置不完整的提供商视为停用
+func CheckProviderAvailable(provider string) error {
+	switch provider {
+	case "coze":
+		return coze.CheckEnabled()
+	}
+	return nil
+}
+
+// GetProviderStatus 获取各模型提供商是否可用，不可用的原因可能包含私钥路径等配置信息，只写入日志
+func GetProviderStatus() map[string]bool {
+	status := make(map[string]bool)
+	for _, provider := range []string{"coze"} {
+		err := CheckProviderAvailable(provider)
+		if err != nil {
+			utils.LogWarn("模型提供商不可用", map[string]interface{}{
+				"provider": provider,
+				"reason":   err.Error(),
+			})
+		}
+		status[provider] = err == nil
+	}
+	return status
+}
+
+// CheckModelCapability 检查模型是否能够处理该请求
+func (s *AIModelService) CheckModelCapability(aiModel *models.AIModel, req *ModelRequirement) error {
+	if aiModel == nil {
+		return errors.New("模型不存在")
+	}
+	if !aiModel.Enabled {
+		return fmt.Errorf("模型%s已停用", aiModel.DisplayName)
+	}
+	if err := CheckProviderAvailable(aiModel.Provider); err != nil {
+		utils.LogWarn("模型提供商不可用", map[string]interface{}{
+			"provider": aiModel.Provider,
+			"model_id": aiModel.Id,
+			"reason":   err.Error(),
+		})
+		return fmt.Errorf("模型%s暂不可用", aiModel.DisplayName)
+	}
+	if req == nil {
+		return nil
+	}
+	if req.Type != "" && aiModel.Type != "" && req.Type != aiModel.Type {
+		return fmt.Errorf("模型%s不支持%s类型的会话", aiModel.DisplayName, req.Type)
+	}
+	if req.Streaming && !aiModel.SupportsStreaming {
+		return fmt.Errorf("模型%s不支持流式输出", aiModel.DisplayName)
+	}
+	if req.Vision && !aiModel.SupportsVision {
+		return fmt.Errorf("模型%s不支持图片理解", aiModel.DisplayName)
+	}
+	if req.Tools && !aiModel.SupportsTools {
+		return fmt.Errorf("模型%s不支持工具调用", aiModel.DisplayName)
+	}
+	if req.JSONMode && !aiModel.SupportsJSONMode {
+		return fmt.Errorf("模型%s不支持JSON输出模式", aiModel.DisplayName)
+	}
+	// 上下文窗口为0表示未知，不做限制
+	if aiModel.ContextWindow > 0 && req.ContextTokens+req.ResponseTokens > aiModel.ContextWindow {
+		return fmt.Errorf("对话内容过长，超出模型%s的上下文窗口(%d Token)", aiModel.DisplayName, aiModel.ContextWindow)
+	}
+	return nil
+}
+
+// EstimateTokens 粗略估算文本的Token数，用于检查上下文窗口和没有返回用量时的使用记录。
+// 这是启发式估算而不是真实的分词结果：中日韩文字按每个字约1个Token计算，
+// 其他文本按约4个字节1个Token计算
+func EstimateTokens(text string) int {
+	cjkRunes, otherBytes := 0, 0
+	for _, r := range text {
+		if isCJKRune(r) {
+			cjkRunes++
+			continue
+		}
+		otherBytes += utf8.RuneLen(r)
+	}
+	return cjkRunes + (otherBytes+3)/4
+}
+
+// isCJKRune 是否为中日韩文字，包括汉字、假名和韩文
+func isCJKRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// GetModelById 根据Id获取AI模型，优先读取模型注册表
 func (s *AIModelService) GetModelById(id uint) (*models.AIModel, error) {
+	if aiModel, err := GetModelRegistry().Get(id); err == nil {
+		return aiModel, nil
+	}
+
+	// 注册表未命中时回源数据库，可能是其他实例刚新增的模型，直接加入注册表，
+	// 不重新加载整个注册表，以免读到尚未失效的Redis缓存
 	var aiModel models.AIModel
 	if err := database.DB.First(&aiModel, id).Error; err != nil {
 		return nil, errors.New("模型不存在")
 	}
+	GetModelRegistry().put(aiModel)
 	return &aiModel, nil
 }
 
 // GetModelByName 根据名称获取AI模型
 func (s *AIModelService) GetModelByName(name string) (*models.AIModel, error) {
+	if modelList, err := GetModelRegistry().List(); err == nil {
+		for i := range modelList {
+			if modelList[i].Name == name {
+				return &modelList[i], nil
+			}
+		}
+	}
+
 	var aiModel models.AIModel
 	if err := database.DB.Where("name = ?", name).First(&aiModel).Error; err != nil {
 		return nil, errors.New("模型不存在")
@@ -44,6 +243,16 @@ func (s *AIModelService) GetModelByName(name string) (*models.AIModel, error) {
 
 // GetDefaultModel 获取默认AI模型
 func (s *AIModelService) GetDefaultModel(chatType string) (*models.AIModel, error) {
+	if modelList, err := GetModelRegistry().List(); err == nil {
+		for i := range modelList {
+			aiModel := &modelList[i]
+			if aiModel.IsDefault && aiModel.Enabled && (chatType == "" || aiModel.Type == chatType) {
+				return aiModel, nil
+			}
+		}
+		return nil, errors.New("未找到默认模型")
+	}
+
 	var aiModel models.AIModel
 	query := database.DB.Where("is_default = ? AND enabled = ?", true, true)
 	if chatType != "" {
@@ -55,24 +264,106 @@ func (s *AIModelService) GetDefaultModel(chatType string) (*models.AIModel, erro
 	return &aiModel, nil
 }
 
+// modelUpdatableColumns 允许通过管理接口修改的模型字段
+var modelUpdatableColumns = map[string]bool{
+	"display_name":       true,
+	"url":                true,
+	"max_tokens":         true,
+	"temperature":        true,
+	"top_p":              true,
+	"presence_penalty":   true,
+	"frequency_penalty":  true,
+	"enabled":            true,
+	"is_default":         true,
+	"api_parameters":     true,
+	"description":        true,
+	"context_window":     true,
+	"supports_vision":    true,
+	"supports_tools":     true,
+	"supports_json_mode": true,
+	"supports_streaming": true,
+	"supports_reasoning": true,
+}
+
+// UpdateModel 更新模型配置，并通知所有实例刷新模型注册表
+func (s *AIModelService) UpdateModel(id uint, updates map[string]interface{}) (*models.AIModel, error) {
+	for column := range updates {
+		if !modelUpdatableColumns[column] {
+			return nil, fmt.Errorf("不支持修改字段: %s", column)
+		}
+	}
+	if len(updates) == 0 {
+		return nil, errors.New("没有需要更新的字段")
+	}
+
+	// API参数允许直接提交JSON对象，保存前统一转换为字符串并校验格式
+	if apiParameters, ok := updates["api_parameters"]; ok && apiParameters != nil {
+		apiParametersJSON, isString := apiParameters.(string)
+		if !isString {
+			data, err := json.Marshal(apiParameters)
+			if err != nil {
+				return nil, fmt.Errorf("模型API参数格式错误: %v", err)
+			}
+			apiParametersJSON = string(data)
+		}
+		if _, err := ParseModelApiParameters(&models.AIModel{ApiParameters: apiParametersJSON}); err != nil {
+			return nil, err
+		}
+		updates["api_parameters"] = apiParametersJSON
+	}
+
+	var aiModel models.AIModel
+	if err := database.DB.First(&aiModel, id).Error; err != nil {
+		return nil, errors.New("模型不存在")
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 同一类型只保留一个默认模型
+		if isDefault, ok := updates["is_default"].(bool); ok && isDefault {
+			if err := tx.Model(&models.AIModel{}).
+				Where("type = ? AND id <> ?", aiModel.Type, aiModel.Id).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&aiModel).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	GetModelRegistry().Invalidate(aiModel.Id)
+
+	return s.GetModelById(aiModel.Id)
+}
+
 // RecordModelUsage 记录模型使用情况
 func (s *AIModelService) RecordModelUsage(usage *models.AIModelUsage) error {
 	return database.DB.Create(usage).Error
 }
 
-// GetModelUsageByUser 获取用户的模型使用记录
-func (s *AIModelService) GetModelUsageByUser(userId uint) ([]models.AIModelUsage, error) {
-	var usages []models.AIModelUsage
-	if err := database.DB.Where("user_id = ?", userId).Order("created_at DESC").Find(&usages).Error; err != nil {
-		return nil, err
-	}
-	return usages, nil
+// GetModelUsageByUser 分页获取用户的模型使用记录，最新的排在前面
+func (s *AIModelService) GetModelUsageByUser(userId uint, page *CursorPagination) ([]models.AIModelUsage, *CursorPageInfo, error) {
+	query := database.DB.Model(&models.AIModelUsage{}).Where("user_id = ?", userId)
+	return paginateByCursor(query, page, []cursorKey{
+		{Column: "id", Desc: true},
+	}, func(usage *models.AIModelUsage) []int64 {
+		return []int64{int64(usage.Id)}
+	})
+}
+
+// CountModelUsageByUser 统计用户的模型使用记录总数
+func (s *AIModelService) CountModelUsageByUser(userId uint) (int64, error) {
+	var total int64
+	err := database.DB.Model(&models.AIModelUsage{}).Where("user_id = ?", userId).Count(&total).Error
+	return total, err
 }
 
-// CreateModelUsageFromResponse 从响应创建使用记录
+// CreateModelUsageFromResponse 从响应创建使用记录，按调用时生效的价格计算费用
 func (s *AIModelService) CreateModelUsageFromResponse(
 	userId uint,
 	modelId uint,
+	chatId uint,
 	messageId uint,
 	prompt string,
 	response string,
@@ -80,9 +371,11 @@ func (s *AIModelService) CreateModelUsageFromResponse(
 	completionTokens int,
 	duration int,
 ) *models.AIModelUsage {
-	return &models.AIModelUsage{
+	now := time.Now()
+	usage := &models.AIModelUsage{
 		UserId:           userId,
 		ModelId:          modelId,
+		ChatId:           chatId,
 		MessageId:        messageId,
 		Prompt:           prompt,
 		Response:         response,
@@ -91,23 +384,237 @@ func (s *AIModelService) CreateModelUsageFromResponse(
 		TotalTokens:      promptTokens + completionTokens,
 		Duration:         duration,
 		Status:           "success",
-		CreatedAt:        time.Now(),
+		CreatedAt:        now,
 	}
+
+	// 价格获取失败时仍记录使用情况，费用记为0
+	if price, err := s.GetEffectivePrice(modelId, now); err == nil {
+		usage.InputPrice = price.InputPrice
+		usage.OutputPrice = price.OutputPrice
+		usage.Currency = price.Currency
+		usage.Cost = CalculateCost(price, promptTokens, completionTokens)
+	}
+
+	return usage
 }
 
 // CreateModelUsageError 创建错误使用记录
 func (s *AIModelService) CreateModelUsageError(
 	userId uint,
 	modelId uint,
+	chatId uint,
 	prompt string,
 	errorMsg string,
 ) *models.AIModelUsage {
 	return &models.AIModelUsage{
 		UserId:    userId,
 		ModelId:   modelId,
+		ChatId:    chatId,
 		Prompt:    prompt,
 		Status:    "error",
 		ErrorMsg:  errorMsg,
 		CreatedAt: time.Now(),
 	}
 }
+
+// GetEffectivePrice 获取模型在指定时间生效的价格
+// 优先使用价格历史表，没有历史记录时使用模型表中的当前价格
+func (s *AIModelService) GetEffectivePrice(modelId uint, at time.Time) (*models.AIModelPrice, error) {
+	var price models.AIModelPrice
+	err := database.DB.Where("model_id = ? AND effective_at <= ?", modelId, at).
+		Order("effective_at DESC").
+		First(&price).Error
+	if err == nil {
+		return &price, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	aiModel, err := s.GetModelById(modelId)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AIModelPrice{
+		ModelId:     aiModel.Id,
+		InputPrice:  aiModel.InputPrice,
+		OutputPrice: aiModel.OutputPrice,
+		Currency:    aiModel.Currency,
+		EffectiveAt: aiModel.CreatedAt,
+	}, nil
+}
+
+// SetModelPrice 设置模型价格，写入价格历史
+// 已经生效的价格同步更新到模型表，未来生效的价格到期后由模型注册表的定时刷新通过syncEffectivePrices同步；历史使用记录保留原有计费价格
+func (s *AIModelService) SetModelPrice(modelId uint, inputPrice, outputPrice float64, currency string, effectiveAt time.Time) (*models.AIModelPrice, error) {
+	if inputPrice < 0 || outputPrice < 0 {
+		return nil, errors.New("价格不能为负数")
+	}
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	if effectiveAt.IsZero() {
+		effectiveAt = time.Now()
+	}
+
+	aiModel, err := s.GetModelById(modelId)
+	if err != nil {
+		return nil, err
+	}
+
+	price := &models.AIModelPrice{
+		ModelId:     aiModel.Id,
+		InputPrice:  inputPrice,
+		OutputPrice: outputPrice,
+		Currency:    currency,
+		EffectiveAt: effectiveAt,
+		CreatedAt:   time.Now(),
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(price).Error; err != nil {
+			return err
+		}
+		if effectiveAt.After(time.Now()) {
+			return nil
+		}
+		return tx.Model(aiModel).Updates(map[string]interface{}{
+			"input_price":  inputPrice,
+			"output_price": outputPrice,
+			"currency":     currency,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	GetModelRegistry().Invalidate(aiModel.Id)
+
+	return price, nil
+}
+
+// syncEffectivePrices 将价格历史中已到生效时间的最新价格同步到模型表，有变化时刷新模型注册表
+func (s *AIModelService) syncEffectivePrices() error {
+	var prices []models.AIModelPrice
+	if err := database.DB.Raw(`SELECT p.* FROM ai_model_price AS p
+		JOIN (SELECT model_id, MAX(effective_at) AS effective_at FROM ai_model_price
+			WHERE effective_at <= ? GROUP BY model_id) AS latest
+		ON p.model_id = latest.model_id AND p.effective_at = latest.effective_at`, time.Now()).
+		Scan(&prices).Error; err != nil {
+		return err
+	}
+	if len(prices) == 0 {
+		return nil
+	}
+
+	// 同一时间生效的多条价格以最后设置的为准
+	current := make(map[uint]*models.AIModelPrice, len(prices))
+	modelIds := make([]uint, 0, len(prices))
+	for i := range prices {
+		price := &prices[i]
+		if existing, ok := current[price.ModelId]; !ok || price.Id > existing.Id {
+			if !ok {
+				modelIds = append(modelIds, price.ModelId)
+			}
+			current[price.ModelId] = price
+		}
+	}
+
+	var aiModels []models.AIModel
+	if err := database.DB.Select("id", "input_price", "output_price", "currency").
+		Where("id IN ?", modelIds).
+		Find(&aiModels).Error; err != nil {
+		return err
+	}
+
+	changed := false
+	for _, aiModel := range aiModels {
+		price := current[aiModel.Id]
+		if aiModel.InputPrice == price.InputPrice && aiModel.OutputPrice == price.OutputPrice && aiModel.Currency == price.Currency {
+			continue
+		}
+		if err := database.DB.Model(&models.AIModel{}).Where("id = ?", aiModel.Id).Updates(map[string]interface{}{
+			"input_price":  price.InputPrice,
+			"output_price": price.OutputPrice,
+			"currency":     price.Currency,
+		}).Error; err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	if changed {
+		GetModelRegistry().Invalidate(0)
+	}
+	return nil
+}
+
+// GetModelPriceHistory 获取模型的价格历史
+func (s *AIModelService) GetModelPriceHistory(modelId uint) ([]models.AIModelPrice, error) {
+	var prices []models.AIModelPrice
+	if err := database.DB.Where("model_id = ?", modelId).Order("effective_at DESC").Find(&prices).Error; err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+// CalculateCost 根据每百万Token价格计算费用
+func CalculateCost(price *models.AIModelPrice, promptTokens, completionTokens int) float64 {
+	if price == nil {
+		return 0
+	}
+	cost := float64(promptTokens)*price.InputPrice/tokensPerPriceUnit +
+		float64(completionTokens)*price.OutputPrice/tokensPerPriceUnit
+	// 保留6位小数，与数据库精度一致
+	return math.Round(cost*1e6) / 1e6
+}
+
+// UsageCostSummary 费用汇总
+type UsageCostSummary struct {
+	ModelId          uint    `json:"model_id"`
+	Currency         string  `json:"currency"`
+	Count            int64   `json:"count"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// GetUserCostSummary 获取用户按模型和货币汇总的费用
+func (s *AIModelService) GetUserCostSummary(userId uint) ([]UsageCostSummary, error) {
+	return s.getCostSummary(database.DB.Where("user_id = ?", userId))
+}
+
+// GetChatCostSummary 获取聊天会话按模型和货币汇总的费用
+func (s *AIModelService) GetChatCostSummary(chatId uint) ([]UsageCostSummary, error) {
+	return s.getCostSummary(database.DB.Where("chat_id = ?", chatId))
+}
+
+// getCostSummary 按模型和货币分组汇总成功的使用记录
+func (s *AIModelService) getCostSummary(query *gorm.DB) ([]UsageCostSummary, error) {
+	var summaries []UsageCostSummary
+	err := query.Model(&models.AIModelUsage{}).
+		Select("model_id, currency, COUNT(*) AS count, "+
+			"SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens, "+
+			"SUM(total_tokens) AS total_tokens, SUM(cost) AS cost").
+		Where("status = ?", "success").
+		Group("model_id, currency").
+		Scan(&summaries).Error
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// SumCostByCurrency 将汇总结果按货币合计
+func SumCostByCurrency(summaries []UsageCostSummary) map[string]float64 {
+	totals := make(map[string]float64)
+	for _, summary := range summaries {
+		currency := summary.Currency
+		if currency == "" {
+			currency = DefaultCurrency
+		}
+		totals[currency] = math.Round((totals[currency]+summary.Cost)*1e6) / 1e6
+	}
+	return totals
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		tokens int
+	}{
+		{name: "空文本", text: "", tokens: 0},
+		{name: "英文", text: "hello world!", tokens: 3},
+		{name: "不足4字节向上取整", text: "hi", tokens: 1},
+		{name: "中文按字计算", text: "你好世界", tokens: 4},
+		{name: "中文标点按字节计算", text: "你好，世界。", tokens: 4 + 2},
+		{name: "中英混合", text: "使用Go语言", tokens: 4 + 1},
+		{name: "日文和韩文", text: "こんにちは안녕", tokens: 7},
+		{name: "长中文", text: strings.Repeat("测试", 1000), tokens: 2000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tokens := EstimateTokens(tt.text); tokens != tt.tokens {
+				t.Errorf("EstimateTokens(%q) = %d, 期望 %d", tt.name, tokens, tt.tokens)
+			}
+		})
+	}
+}
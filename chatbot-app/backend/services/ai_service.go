@@ -9,6 +9,7 @@ import (
 
 	"chatbot-app/backend/models"
 	"chatbot-app/backend/utils"
+	"chatbot-app/backend/utils/coze"
 )
 
 // ModelOption 模型选项
@@ -49,15 +50,16 @@ func NewAiService() *AiService {
 		modelService:  modelService,
 	}
 
-	// 从数据库加载默认模型
+	// 加载默认模型，模型配置变更时重新加载
 	service.loadDefaultModelFromDB()
+	GetModelRegistry().OnChange(service.loadDefaultModelFromDB)
 
 	return service
 }
 
-// loadDefaultModelFromDB 从数据库加载默认模型
+// loadDefaultModelFromDB 从模型注册表加载默认模型
 func (s *AiService) loadDefaultModelFromDB() {
-	// 从数据库获取默认模型
+	// 获取默认模型
 	defaultModel, err := s.modelService.GetDefaultModel("chat")
 	if err == nil {
 		s.mu.Lock()
@@ -81,7 +83,7 @@ func (s *AiService) loadDefaultModelFromDB() {
 }
 
 // GenerateResponse 生成AI回复
-func (s *AiService) GenerateResponse(aiModel *models.AIModel, prompt string, history []map[string]string, userId uint) (string, *models.AIModelUsage, error) {
+func (s *AiService) GenerateResponse(aiModel *models.AIModel, prompt string, history []map[string]string, userId uint, chatId uint) (string, *models.AIModelUsage, error) {
 	if strings.TrimSpace(prompt) == "" {
 		return "", nil, errors.New("提问内容不能为空")
 	}
@@ -89,14 +91,11 @@ func (s *AiService) GenerateResponse(aiModel *models.AIModel, prompt string, his
 	// 开始计时
 	startTime := time.Now()
 
-	// 转换历史消息格式
-	aiHistory := utils.ConvertHistoryMessages(history)
-
 	// 获取AI客户端
 	client, err := s.clientFactory.CreateClient(aiModel)
 	if err != nil {
 		// 创建错误记录
-		errorUsage := s.modelService.CreateModelUsageError(userId, aiModel.Id, prompt, "获取AI客户端失败: "+err.Error())
+		errorUsage := s.modelService.CreateModelUsageError(userId, aiModel.Id, chatId, prompt, "获取AI客户端失败: "+err.Error())
 		if recordErr := s.modelService.RecordModelUsage(errorUsage); recordErr != nil {
 			// 记录日志
 		}
@@ -104,44 +103,24 @@ func (s *AiService) GenerateResponse(aiModel *models.AIModel, prompt string, his
 	}
 
 	// 调用AI生成回复
-	response, err := client.GenerateResponse(prompt, aiHistory)
+	response, tokenUsage, err := client.GenerateResponse(newGenerateRequest(prompt, history, userId, chatId, nil))
 	if err != nil {
 		// 创建错误记录
-		errorUsage := s.modelService.CreateModelUsageError(userId, aiModel.Id, prompt, "AI生成回复失败: "+err.Error())
+		errorUsage := s.modelService.CreateModelUsageError(userId, aiModel.Id, chatId, prompt, "AI生成回复失败: "+err.Error())
 		if recordErr := s.modelService.RecordModelUsage(errorUsage); recordErr != nil {
 			// 记录日志
 		}
 		return "", errorUsage, errors.New("AI生成回复失败: " + err.Error())
 	}
 
-	// 计算耗时
-	duration := int(time.Since(startTime).Milliseconds())
-
-	// 创建使用记录
-	// 这里的Token计算是简化的，实际项目中应该从API响应中获取
-	promptTokens := len(prompt) / 4       // 简化的Token估算
-	completionTokens := len(response) / 4 // 简化的Token估算
-	usage := s.modelService.CreateModelUsageFromResponse(
-		userId,
-		aiModel.Id,
-		0, // 消息Id后续设置
-		prompt,
-		response,
-		promptTokens,
-		completionTokens,
-		duration,
-	)
-
 	// 记录使用情况
-	if err := s.modelService.RecordModelUsage(usage); err != nil {
-		// 记录日志，但不影响返回结果
-	}
+	usage := s.recordUsage(aiModel, prompt, response, tokenUsage, userId, chatId, startTime)
 
 	return response, usage, nil
 }
 
 // GenerateStreamResponse 生成流式AI回复
-func (s *AiService) GenerateStreamResponse(aiModel *models.AIModel, prompt string, history []map[string]string, userId uint, callback func(chunk string, isEnd bool, err error) bool) error {
+func (s *AiService) GenerateStreamResponse(aiModel *models.AIModel, prompt string, history []map[string]string, userId uint, chatId uint, meta *RequestMeta, callback func(chunk string, isEnd bool, err error) bool) error {
 	// 检查输入
 	if strings.TrimSpace(prompt) == "" {
 		return errors.New("提问内容不能为空")
@@ -156,153 +135,84 @@ func (s *AiService) GenerateStreamResponse(aiModel *models.AIModel, prompt strin
 		aiModel = defaultModel
 	}
 
-	// 开始计时
-	startTime := time.Now()
-
-	// 检查是否为Coze提供商，使用专门的服务
-	if aiModel.Provider == "coze" {
-		return s.handleCozeStreamResponse(aiModel, prompt, history, userId, callback, startTime)
-	}
-
-	// 转换历史消息格式
-	aiHistory := utils.ConvertHistoryMessages(history)
-
 	// 获取AI客户端
 	client, err := s.clientFactory.CreateClient(aiModel)
 	if err != nil {
 		// 创建错误记录
-		errorUsage := s.modelService.CreateModelUsageError(userId, aiModel.Id, prompt, "获取AI客户端失败: "+err.Error())
+		errorUsage := s.modelService.CreateModelUsageError(userId, aiModel.Id, chatId, prompt, "获取AI客户端失败: "+err.Error())
 		if recordErr := s.modelService.RecordModelUsage(errorUsage); recordErr != nil {
 			// 记录日志
 		}
 		return errors.New("获取AI客户端失败: " + err.Error())
 	}
 
-	// 用于收集完整响应以记录使用情况
-	var fullResponse strings.Builder
-	var hasError bool
-
-	// 定义内部回调函数，包装用户回调并处理使用记录
-	internalCallback := func(chunk string, isEnd bool, err error) bool {
-		if err != nil {
-			hasError = true
-			// 创建错误记录
-			errorUsage := s.modelService.CreateModelUsageError(userId, aiModel.Id, prompt, "AI流式生成回复失败: "+err.Error())
-			if recordErr := s.modelService.RecordModelUsage(errorUsage); recordErr != nil {
-				// 记录日志
-			}
-			return callback("", false, err)
-		}
-
-		if isEnd {
-			// 流式响应结束，记录使用情况（如果没有错误）
-			if !hasError {
-				duration := int(time.Since(startTime).Milliseconds())
-				response := fullResponse.String()
-
-				// 创建使用记录（简化的Token计算）
-				promptTokens := len(prompt) / 4       // 简化的Token估算
-				completionTokens := len(response) / 4 // 简化的Token估算
-				usage := s.modelService.CreateModelUsageFromResponse(
-					userId,
-					aiModel.Id,
-					0, // 消息Id后续设置
-					prompt,
-					response,
-					promptTokens,
-					completionTokens,
-					duration,
-				)
-
-				// 记录使用情况
-				if err := s.modelService.RecordModelUsage(usage); err != nil {
-					// 记录日志，但不影响返回结果
-				}
-			}
-
-			return callback("", true, nil) // 通知用户回调流式响应结束
-		}
-
-		// 收集响应内容
-		fullResponse.WriteString(chunk)
+	req := newGenerateRequest(prompt, history, userId, chatId, meta)
+	return s.streamWithUsage(aiModel, prompt, userId, chatId, callback, func(internalCallback func(chunk string, isEnd bool, err error) bool) (*utils.TokenUsage, error) {
+		return client.GenerateStreamResponse(req, internalCallback)
+	})
+}
 
-		// 调用用户回调
-		return callback(chunk, false, nil)
+// ResumeWorkflowStream 以用户的回答恢复中断的Coze工作流，流式返回后续回复
+func (s *AiService) ResumeWorkflowStream(aiModel *models.AIModel, interrupt *models.WorkflowInterrupt, answer string, userId uint, meta *RequestMeta, callback func(chunk string, isEnd bool, err error) bool) error {
+	if strings.TrimSpace(answer) == "" {
+		return errors.New("回答内容不能为空")
 	}
 
-	// 调用AI客户端的流式生成回复
-	return client.GenerateStreamResponse(prompt, aiHistory, internalCallback)
-}
-
-// handleCozeStreamResponse 处理Coze流式响应
-func (s *AiService) handleCozeStreamResponse(aiModel *models.AIModel, prompt string, history []map[string]string, userId uint, callback func(chunk string, isEnd bool, err error) bool, startTime time.Time) error {
-	// 创建Coze服务，传入模型配置
 	cozeService, err := NewCozeService(aiModel)
 	if err != nil {
-		// 创建错误记录
-		errorUsage := s.modelService.CreateModelUsageError(userId, aiModel.Id, prompt, "创建Coze服务失败: "+err.Error())
+		errorUsage := s.modelService.CreateModelUsageError(userId, aiModel.Id, interrupt.ChatId, answer, "创建Coze服务失败: "+err.Error())
 		if recordErr := s.modelService.RecordModelUsage(errorUsage); recordErr != nil {
 			// 记录日志
 		}
 		return fmt.Errorf("创建Coze服务失败: %v", err)
 	}
 
-	// 转换历史消息格式为Coze格式
-	cozeHistory := make([]*models.Message, 0, len(history))
-	for _, msg := range history {
-		cozeHistory = append(cozeHistory, &models.Message{
-			Role:    msg["role"],
-			Content: msg["content"],
-		})
+	workflowInterrupt := &coze.WorkflowInterrupt{
+		WorkflowID:    interrupt.WorkflowId,
+		EventID:       interrupt.EventId,
+		InterruptType: interrupt.InterruptType,
+		NodeTitle:     interrupt.NodeTitle,
 	}
+	return s.streamWithUsage(aiModel, answer, userId, interrupt.ChatId, callback, func(internalCallback func(chunk string, isEnd bool, err error) bool) (*utils.TokenUsage, error) {
+		usage, err := cozeService.ResumeWorkflowStream(workflowInterrupt, answer, meta, internalCallback)
+		return toTokenUsage(usage), err
+	})
+}
+
+// streamWithUsage 执行流式生成并统一记录使用情况
+// run负责调用客户端并将回复写入传入的回调，正常结束时按客户端返回的用量记录，出错时只记录一次错误
+func (s *AiService) streamWithUsage(aiModel *models.AIModel, prompt string, userId uint, chatId uint, callback func(chunk string, isEnd bool, err error) bool, run func(internalCallback func(chunk string, isEnd bool, err error) bool) (*utils.TokenUsage, error)) error {
+	// 开始计时
+	startTime := time.Now()
 
 	// 用于收集完整响应以记录使用情况
 	var fullResponse strings.Builder
 	var hasError bool
-	var usageRecorded bool // 添加标志防止重复记录
+	var ended bool
 
-	// 定义内部回调函数，包装用户回调并处理使用记录
+	recordError := func(err error) {
+		if hasError {
+			return
+		}
+		hasError = true
+		errorUsage := s.modelService.CreateModelUsageError(userId, aiModel.Id, chatId, prompt, "AI流式生成回复失败: "+err.Error())
+		if recordErr := s.modelService.RecordModelUsage(errorUsage); recordErr != nil {
+			// 记录日志
+		}
+	}
+
+	// 定义内部回调函数，包装用户回调并收集回复内容
 	internalCallback := func(chunk string, isEnd bool, err error) bool {
 		if err != nil {
-			hasError = true
-			// 创建错误记录（只记录一次）
-			if !usageRecorded {
-				errorUsage := s.modelService.CreateModelUsageError(userId, aiModel.Id, prompt, "Coze流式生成回复失败: "+err.Error())
-				if recordErr := s.modelService.RecordModelUsage(errorUsage); recordErr != nil {
-					// 记录日志
-				}
-				usageRecorded = true
-			}
+			recordError(err)
 			return callback("", false, err)
 		}
 
 		if isEnd {
-			// 流式响应结束，记录使用情况（如果没有错误且未记录过）
-			if !hasError && !usageRecorded {
-				duration := int(time.Since(startTime).Milliseconds())
-				response := fullResponse.String()
-
-				// 创建使用记录（简化的Token计算）
-				promptTokens := len(prompt) / 4       // 简化的Token估算
-				completionTokens := len(response) / 4 // 简化的Token估算
-				usage := s.modelService.CreateModelUsageFromResponse(
-					userId,
-					aiModel.Id,
-					0, // 消息Id后续设置
-					prompt,
-					response,
-					promptTokens,
-					completionTokens,
-					duration,
-				)
-
-				// 记录使用情况
-				if err := s.modelService.RecordModelUsage(usage); err != nil {
-					// 记录日志，但不影响返回结果
-				}
-				usageRecorded = true
+			if ended {
+				return true
 			}
-
+			ended = true
 			return callback("", true, nil) // 通知用户回调流式响应结束
 		}
 
@@ -313,6 +223,65 @@ func (s *AiService) handleCozeStreamResponse(aiModel *models.AIModel, prompt str
 		return callback(chunk, false, nil)
 	}
 
-	// 调用Coze服务的流式生成回复
-	return cozeService.GenerateStreamResponse(prompt, cozeHistory, userId, internalCallback)
+	tokenUsage, err := run(internalCallback)
+	if err != nil {
+		recordError(err)
+		return err
+	}
+
+	// 流式响应正常结束，记录使用情况
+	if ended && !hasError {
+		s.recordUsage(aiModel, prompt, fullResponse.String(), tokenUsage, userId, chatId, startTime)
+	}
+	return nil
+}
+
+// recordUsage 记录一次成功请求的使用情况，客户端未返回用量时按文本长度估算
+func (s *AiService) recordUsage(aiModel *models.AIModel, prompt string, response string, tokenUsage *utils.TokenUsage, userId uint, chatId uint, startTime time.Time) *models.AIModelUsage {
+	// 计算耗时
+	duration := int(time.Since(startTime).Milliseconds())
+
+	promptTokens := EstimateTokens(prompt)
+	completionTokens := EstimateTokens(response)
+	if tokenUsage != nil {
+		promptTokens, completionTokens = tokenUsage.PromptTokens, tokenUsage.CompletionTokens
+	}
+
+	usage := s.modelService.CreateModelUsageFromResponse(
+		userId,
+		aiModel.Id,
+		chatId,
+		0, // 消息Id后续设置
+		prompt,
+		response,
+		promptTokens,
+		completionTokens,
+		duration,
+	)
+
+	// 记录使用情况
+	if err := s.modelService.RecordModelUsage(usage); err != nil {
+		// 记录日志，但不影响返回结果
+	}
+	return usage
+}
+
+// newGenerateRequest 根据对话信息构造生成请求
+func newGenerateRequest(prompt string, history []map[string]string, userId uint, chatId uint, meta *RequestMeta) *utils.GenerateRequest {
+	req := &utils.GenerateRequest{
+		Prompt:  prompt,
+		History: utils.ConvertHistoryMessages(history),
+		UserId:  userId,
+		ChatId:  chatId,
+	}
+	if meta != nil {
+		req.Context = meta.Context
+		req.ClientIP = meta.ClientIP
+		req.FormFields = meta.FormFields
+		req.Files = meta.Files
+		req.OnEvent = meta.OnEvent
+		req.Fork = meta.Fork
+		req.JSONMode = meta.JSONMode
+	}
+	return req
 }
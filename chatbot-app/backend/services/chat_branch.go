@@ -0,0 +1,276 @@
+package services
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"chatbot-app/backend/database"
+	"chatbot-app/backend/models"
+)
+
+// MessageNode 消息树节点
+type MessageNode struct {
+	*models.Message
+	SiblingIds []uint         `json:"sibling_ids,omitempty"` // 同一父消息下的所有分支Id（含自身），按创建顺序，只有一个分支时为空
+	Children   []*MessageNode `json:"children,omitempty"`    // 子消息，仅完整消息树返回
+}
+
+// messageTree 聊天会话的消息树，消息通过parent_id连接
+type messageTree struct {
+	messages map[uint]*models.Message
+	children map[uint][]*models.Message // 父消息Id -> 子消息，按创建顺序
+}
+
+// loadMessageTree 加载聊天会话的消息树
+func (s *ChatService) loadMessageTree(chatId uint) (*messageTree, error) {
+	messages, err := s.GetChatMessages(chatId)
+	if err != nil {
+		return nil, err
+	}
+	return newMessageTree(messages), nil
+}
+
+// newMessageTree 由按创建顺序排列的消息构造消息树
+func newMessageTree(messages []models.Message) *messageTree {
+	tree := &messageTree{
+		messages: make(map[uint]*models.Message, len(messages)),
+		children: make(map[uint][]*models.Message),
+	}
+	for i := range messages {
+		message := &messages[i]
+		tree.messages[message.Id] = message
+		tree.children[message.ParentId] = append(tree.children[message.ParentId], message)
+	}
+	return tree
+}
+
+// activeChild 返回父消息下选中的分支，没有标记选中时取最新的分支
+func (t *messageTree) activeChild(parentId uint) *models.Message {
+	children := t.children[parentId]
+	if len(children) == 0 {
+		return nil
+	}
+	for i := len(children) - 1; i >= 0; i-- {
+		if children[i].Active {
+			return children[i]
+		}
+	}
+	return children[len(children)-1]
+}
+
+// activePath 从第一条消息开始沿选中的分支向下，返回当前分支上的所有消息
+func (t *messageTree) activePath() []*models.Message {
+	var path []*models.Message
+	for message := t.activeChild(0); message != nil; message = t.activeChild(message.Id) {
+		path = append(path, message)
+	}
+	return path
+}
+
+// pathTo 返回从第一条消息到指定消息的分支（含该消息）
+func (t *messageTree) pathTo(messageId uint) []*models.Message {
+	var path []*models.Message
+	for message := t.messages[messageId]; message != nil; message = t.messages[message.ParentId] {
+		path = append([]*models.Message{message}, path...)
+		// 防止异常数据形成环
+		if len(path) > len(t.messages) {
+			break
+		}
+	}
+	return path
+}
+
+// node 构造消息节点，附带同级分支Id
+func (t *messageTree) node(message *models.Message) *MessageNode {
+	node := &MessageNode{Message: message}
+	if siblings := t.children[message.ParentId]; len(siblings) > 1 {
+		node.SiblingIds = make([]uint, 0, len(siblings))
+		for _, sibling := range siblings {
+			node.SiblingIds = append(node.SiblingIds, sibling.Id)
+		}
+	}
+	return node
+}
+
+// subtree 递归构造以指定消息为根的子树
+func (t *messageTree) subtree(message *models.Message) *MessageNode {
+	node := t.node(message)
+	for _, child := range t.children[message.Id] {
+		node.Children = append(node.Children, t.subtree(child))
+	}
+	return node
+}
+
+// GetActivePath 获取聊天会话当前选中分支上的消息
+func (s *ChatService) GetActivePath(chatId uint) ([]*MessageNode, error) {
+	tree, err := s.loadMessageTree(chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	path := tree.activePath()
+	nodes := make([]*MessageNode, 0, len(path))
+	for _, message := range path {
+		nodes = append(nodes, tree.node(message))
+	}
+	return nodes, nil
+}
+
+// GetActivePathPage 分页获取当前选中分支上的消息，第一页为最新的消息，next方向加载更早的消息，每页内按创建顺序排列
+// 确定分支时只加载消息Id和父子关系，消息内容按页查询
+func (s *ChatService) GetActivePathPage(chatId uint, page *CursorPagination) ([]*MessageNode, *CursorPageInfo, error) {
+	var skeleton []models.Message
+	if err := database.DB.Select("id", "parent_id", "active").
+		Where("chat_id = ?", chatId).
+		Order("id ASC").
+		Find(&skeleton).Error; err != nil {
+		return nil, nil, err
+	}
+
+	tree := newMessageTree(skeleton)
+	path := tree.activePath()
+	if len(path) == 0 {
+		return []*MessageNode{}, &CursorPageInfo{}, nil
+	}
+	pathIds := make([]uint, 0, len(path))
+	for _, message := range path {
+		pathIds = append(pathIds, message.Id)
+	}
+
+	query := database.DB.Preload("Files").Where("chat_id = ? AND id IN ?", chatId, pathIds)
+	messages, info, err := paginateByCursor(query, page, []cursorKey{
+		{Column: "id", Desc: true},
+	}, func(message *models.Message) []int64 {
+		return []int64{int64(message.Id)}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes := make([]*MessageNode, 0, len(messages))
+	for i := len(messages) - 1; i >= 0; i-- {
+		nodes = append(nodes, tree.node(&messages[i]))
+	}
+	return nodes, info, nil
+}
+
+// GetMessageTree 获取聊天会话的完整消息树，返回所有第一条消息的分支
+func (s *ChatService) GetMessageTree(chatId uint) ([]*MessageNode, error) {
+	tree, err := s.loadMessageTree(chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := make([]*MessageNode, 0, len(tree.children[0]))
+	for _, message := range tree.children[0] {
+		roots = append(roots, tree.subtree(message))
+	}
+	return roots, nil
+}
+
+// GetBranchMessages 获取从第一条消息到指定消息的分支（含该消息），作为对话上下文；messageId为0时返回空
+func (s *ChatService) GetBranchMessages(chatId uint, messageId uint) ([]models.Message, error) {
+	if messageId == 0 {
+		return nil, nil
+	}
+
+	tree, err := s.loadMessageTree(chatId)
+	if err != nil {
+		return nil, err
+	}
+	if tree.messages[messageId] == nil {
+		return nil, errors.New("消息不存在")
+	}
+
+	path := tree.pathTo(messageId)
+	messages := make([]models.Message, 0, len(path))
+	for _, message := range path {
+		messages = append(messages, *message)
+	}
+	return messages, nil
+}
+
+// ResolveParent 确定新用户消息的父消息
+// editMessageId大于0时表示编辑该用户消息，新消息与其同级形成新分支；否则接在当前分支的最后一条消息之后。
+// fork表示父消息不是会话中最新的消息，外部平台（如Coze）保存的会话上下文已与该分支不一致
+func (s *ChatService) ResolveParent(chatId uint, editMessageId uint) (parentId uint, fork bool, err error) {
+	if editMessageId > 0 {
+		edited, err := s.GetMessage(chatId, editMessageId)
+		if err != nil {
+			return 0, false, err
+		}
+		if edited.Role != "user" {
+			return 0, false, errors.New("只能编辑用户消息")
+		}
+		parentId = edited.ParentId
+	} else {
+		tree, err := s.loadMessageTree(chatId)
+		if err != nil {
+			return 0, false, err
+		}
+		if path := tree.activePath(); len(path) > 0 {
+			parentId = path[len(path)-1].Id
+		}
+	}
+
+	fork, err = s.IsForked(chatId, parentId)
+	return parentId, fork, err
+}
+
+// IsForked 判断接在指定消息之后是否会偏离会话中最新的消息
+func (s *ChatService) IsForked(chatId uint, parentId uint) (bool, error) {
+	var latestId uint
+	if err := database.DB.Model(&models.Message{}).
+		Where("chat_id = ?", chatId).
+		Select("COALESCE(MAX(id), 0)").
+		Scan(&latestId).Error; err != nil {
+		return false, err
+	}
+	return parentId != latestId, nil
+}
+
+// SelectBranch 切换到包含指定消息的分支，该消息及其所有上级消息成为同级中选中的分支
+func (s *ChatService) SelectBranch(chatId uint, messageId uint) error {
+	tree, err := s.loadMessageTree(chatId)
+	if err != nil {
+		return err
+	}
+	if tree.messages[messageId] == nil {
+		return errors.New("消息不存在")
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, message := range tree.pathTo(messageId) {
+			if err := activateMessage(tx, message); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// createBranchMessage 保存消息并设为同级中选中的分支
+func (s *ChatService) createBranchMessage(message *models.Message) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deactivateSiblings(tx, message.ChatId, message.ParentId, 0); err != nil {
+			return err
+		}
+		return tx.Create(message).Error
+	})
+}
+
+// activateMessage 将消息设为同级中选中的分支
+func activateMessage(tx *gorm.DB, message *models.Message) error {
+	if err := deactivateSiblings(tx, message.ChatId, message.ParentId, message.Id); err != nil {
+		return err
+	}
+	return tx.Model(&models.Message{}).Where("id = ?", message.Id).Update("active", true).Error
+}
+
+// deactivateSiblings 取消同一父消息下其他分支的选中状态
+func deactivateSiblings(tx *gorm.DB, chatId uint, parentId uint, exceptId uint) error {
+	return tx.Model(&models.Message{}).
+		Where("chat_id = ? AND parent_id = ? AND id <> ? AND active = ?", chatId, parentId, exceptId, true).
+		Update("active", false).Error
+}
@@ -0,0 +1,451 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatbot-app/backend/database"
+	"chatbot-app/backend/models"
+)
+
+const (
+	// CHAT_EXPORT_FORMAT JSON导出文件的格式标识，导入时据此识别
+	CHAT_EXPORT_FORMAT = "chatbot-app/chat-export"
+	// CHAT_EXPORT_VERSION JSON导出文件的格式版本
+	CHAT_EXPORT_VERSION = 1
+	// CHAT_EXPORT_BATCH_SIZE 批量导出时每批加载的会话数量
+	CHAT_EXPORT_BATCH_SIZE = 50
+	// chatExportFileNameMaxLen 导出文件名中标题的最大字符数
+	chatExportFileNameMaxLen = 50
+)
+
+// chatExportContentTypes 支持的导出格式及其Content-Type
+var chatExportContentTypes = map[string]string{
+	"md":   "text/markdown; charset=utf-8",
+	"html": "text/html; charset=utf-8",
+	"json": "application/json; charset=utf-8",
+}
+
+// ChatExport 聊天会话导出内容，JSON格式导出时原样输出
+type ChatExport struct {
+	Format     string               `json:"format"`
+	Version    int                  `json:"version"`
+	ExportedAt time.Time            `json:"exported_at"`
+	Chat       ChatExportChat       `json:"chat"`
+	Messages   []*ChatExportMessage `json:"messages"` // 所有分支的消息，按创建顺序排列
+
+	path []*ChatExportMessage // 当前选中分支上的消息，Markdown和HTML只导出该分支
+}
+
+// ChatExportChat 导出的会话信息
+type ChatExportChat struct {
+	Id        uint      `json:"id"`
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Pinned    bool      `json:"pinned"`
+	Archived  bool      `json:"archived"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ChatExportMessage 导出的消息
+type ChatExportMessage struct {
+	Id        uint               `json:"id"`
+	ParentId  uint               `json:"parent_id"`
+	Active    bool               `json:"active"`
+	Role      string             `json:"role"`
+	Content   string             `json:"content"`
+	ModelId   uint               `json:"model_id,omitempty"`
+	ModelName string             `json:"model_name,omitempty"` // 导出时模型的显示名称
+	Tokens    int                `json:"tokens,omitempty"`
+	Metadata  json.RawMessage    `json:"metadata,omitempty"`
+	Files     []ChatExportFile   `json:"files,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	meta      chatExportMetadata // 解析后的元数据，用于Markdown和HTML渲染
+}
+
+// ChatExportFile 导出的附件信息，不包含文件内容
+type ChatExportFile struct {
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+}
+
+// chatExportMetadata 导出时展示的AI消息元数据
+type chatExportMetadata struct {
+	Reasoning string                 `json:"reasoning"`
+	FollowUps []string               `json:"follow_ups"`
+	Verbose   []*models.MessageTrace `json:"verbose"`
+}
+
+// ChatExportService 聊天记录导出服务
+type ChatExportService struct {
+	chatService ChatService
+}
+
+// IsChatExportFormat 判断是否为支持的导出格式
+func IsChatExportFormat(format string) bool {
+	_, ok := chatExportContentTypes[format]
+	return ok
+}
+
+// ChatExportContentType 获取导出格式对应的Content-Type
+func ChatExportContentType(format string) string {
+	return chatExportContentTypes[format]
+}
+
+// ExportChat 导出单个聊天会话，返回文件名和文件内容
+func (s *ChatExportService) ExportChat(chatId uint, userId uint, format string) (string, []byte, error) {
+	if !IsChatExportFormat(format) {
+		return "", nil, errors.New("不支持的导出格式")
+	}
+	chat, err := s.chatService.GetChatById(chatId, userId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	export, err := s.buildExport(chat)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := renderChatExport(export, format)
+	if err != nil {
+		return "", nil, err
+	}
+	return ChatExportFileName(chat, format), data, nil
+}
+
+// ExportAllChats 将用户的所有聊天会话（含已归档）导出为zip压缩包写入w，每个会话一个文件
+// 会话分批加载，每批的消息和模型名称各用一次查询获取，压缩包边生成边写出，不在内存中缓存整个文件
+func (s *ChatExportService) ExportAllChats(userId uint, format string, w io.Writer) error {
+	if !IsChatExportFormat(format) {
+		return errors.New("不支持的导出格式")
+	}
+
+	archive := zip.NewWriter(w)
+	var chats []models.Chat
+	result := database.DB.Where("user_id = ?", userId).FindInBatches(&chats, CHAT_EXPORT_BATCH_SIZE, func(tx *gorm.DB, batch int) error {
+		chatIds := make([]uint, 0, len(chats))
+		for _, chat := range chats {
+			chatIds = append(chatIds, chat.Id)
+		}
+
+		var messages []models.Message
+		if err := database.DB.Preload("Files").Where("chat_id IN ?", chatIds).Order("id ASC").Find(&messages).Error; err != nil {
+			return err
+		}
+		modelNames, err := chatExportModelNames(messages)
+		if err != nil {
+			return err
+		}
+		chatMessages := make(map[uint][]models.Message, len(chats))
+		for _, message := range messages {
+			chatMessages[message.ChatId] = append(chatMessages[message.ChatId], message)
+		}
+
+		for i := range chats {
+			data, err := renderChatExport(newChatExport(&chats[i], chatMessages[chats[i].Id], modelNames), format)
+			if err != nil {
+				return err
+			}
+			writer, err := archive.CreateHeader(&zip.FileHeader{
+				Name:     ChatExportFileName(&chats[i], format),
+				Method:   zip.Deflate,
+				Modified: chats[i].UpdatedAt,
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := writer.Write(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	return archive.Close()
+}
+
+// ChatExportFileName 生成导出文件名：会话Id-标题.扩展名，去掉文件名中不允许的字符
+func ChatExportFileName(chat *models.Chat, format string) string {
+	title := strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(chat.Title))
+	title = truncateRunes(title, chatExportFileNameMaxLen)
+	if title == "" {
+		return fmt.Sprintf("%d.%s", chat.Id, format)
+	}
+	return fmt.Sprintf("%d-%s.%s", chat.Id, title, format)
+}
+
+// buildExport 加载会话的所有消息和模型名称
+func (s *ChatExportService) buildExport(chat *models.Chat) (*ChatExport, error) {
+	messages, err := s.chatService.GetChatMessages(chat.Id)
+	if err != nil {
+		return nil, err
+	}
+	modelNames, err := chatExportModelNames(messages)
+	if err != nil {
+		return nil, err
+	}
+	return newChatExport(chat, messages, modelNames), nil
+}
+
+// newChatExport 根据会话的所有消息（按Id正序）生成导出内容，modelNames为模型Id对应的名称
+func newChatExport(chat *models.Chat, messages []models.Message, modelNames map[uint]string) *ChatExport {
+	export := &ChatExport{
+		Format:     CHAT_EXPORT_FORMAT,
+		Version:    CHAT_EXPORT_VERSION,
+		ExportedAt: time.Now(),
+		Chat: ChatExportChat{
+			Id:        chat.Id,
+			Type:      chat.Type,
+			Title:     chat.Title,
+			Pinned:    chat.Pinned,
+			Archived:  chat.Archived,
+			CreatedAt: chat.CreatedAt,
+			UpdatedAt: chat.UpdatedAt,
+		},
+		Messages: make([]*ChatExportMessage, 0, len(messages)),
+	}
+
+	exported := make(map[uint]*ChatExportMessage, len(messages))
+	for i := range messages {
+		message := &messages[i]
+		item := &ChatExportMessage{
+			Id:        message.Id,
+			ParentId:  message.ParentId,
+			Active:    message.Active,
+			Role:      message.Role,
+			Content:   message.Content,
+			ModelId:   message.ModelId,
+			ModelName: modelNames[message.ModelId],
+			Tokens:    message.Tokens,
+			CreatedAt: message.CreatedAt,
+		}
+		if message.Metadata != "" && json.Valid([]byte(message.Metadata)) {
+			item.Metadata = json.RawMessage(message.Metadata)
+			_ = json.Unmarshal(item.Metadata, &item.meta)
+		}
+		for _, file := range message.Files {
+			item.Files = append(item.Files, ChatExportFile{
+				FileName: file.FileName,
+				MimeType: file.MimeType,
+				Size:     file.Size,
+			})
+		}
+		export.Messages = append(export.Messages, item)
+		exported[message.Id] = item
+	}
+
+	for _, message := range newMessageTree(messages).activePath() {
+		export.path = append(export.path, exported[message.Id])
+	}
+	return export
+}
+
+// chatExportModelNames 查询消息使用的模型名称，包括已删除的模型，优先使用显示名称
+func chatExportModelNames(messages []models.Message) (map[uint]string, error) {
+	names := make(map[uint]string)
+	var modelIds []uint
+	for _, message := range messages {
+		if message.ModelId > 0 {
+			modelIds = append(modelIds, message.ModelId)
+		}
+	}
+	if len(modelIds) == 0 {
+		return names, nil
+	}
+
+	var aiModels []models.AIModel
+	if err := database.DB.Unscoped().Select("id", "name", "display_name").
+		Where("id IN ?", modelIds).
+		Find(&aiModels).Error; err != nil {
+		return nil, err
+	}
+	for _, aiModel := range aiModels {
+		names[aiModel.Id] = aiModel.DisplayName
+		if names[aiModel.Id] == "" {
+			names[aiModel.Id] = aiModel.Name
+		}
+	}
+	return names, nil
+}
+
+// renderChatExport 按格式渲染导出内容
+func renderChatExport(export *ChatExport, format string) ([]byte, error) {
+	switch format {
+	case "md":
+		return renderChatMarkdown(export), nil
+	case "html":
+		return renderChatHTML(export)
+	case "json":
+		return json.MarshalIndent(export, "", "  ")
+	}
+	return nil, errors.New("不支持的导出格式")
+}
+
+// chatRoleLabel 消息角色的显示名称
+func chatRoleLabel(role string) string {
+	switch role {
+	case "user":
+		return "用户"
+	case "assistant":
+		return "助手"
+	case "system":
+		return "系统"
+	}
+	return role
+}
+
+// chatMessageHeading 消息标题：角色（模型名称）
+func chatMessageHeading(message *ChatExportMessage) string {
+	if message.Role == "assistant" && message.ModelName != "" {
+		return fmt.Sprintf("%s（%s）", chatRoleLabel(message.Role), message.ModelName)
+	}
+	return chatRoleLabel(message.Role)
+}
+
+// formatExportTime 导出内容中的时间格式
+func formatExportTime(t time.Time) string {
+	return t.Local().Format(time.DateTime)
+}
+
+// renderChatMarkdown 渲染为Markdown，消息内容原样输出，思考过程以引用块展示
+func renderChatMarkdown(export *ChatExport) []byte {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# %s\n\n", export.Chat.Title)
+	fmt.Fprintf(&builder, "- 创建时间：%s\n", formatExportTime(export.Chat.CreatedAt))
+	fmt.Fprintf(&builder, "- 导出时间：%s\n", formatExportTime(export.ExportedAt))
+
+	for _, message := range export.path {
+		fmt.Fprintf(&builder, "\n---\n\n### %s · %s\n\n", chatMessageHeading(message), formatExportTime(message.CreatedAt))
+
+		if message.meta.Reasoning != "" {
+			builder.WriteString("> **思考过程**\n>\n")
+			for _, line := range strings.Split(strings.TrimSpace(message.meta.Reasoning), "\n") {
+				builder.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+			}
+			builder.WriteString("\n")
+		}
+
+		builder.WriteString(strings.TrimSpace(message.Content))
+		builder.WriteString("\n")
+
+		if len(message.Files) > 0 {
+			builder.WriteString("\n**附件**\n\n")
+			for _, file := range message.Files {
+				fmt.Fprintf(&builder, "- %s\n", file.FileName)
+			}
+		}
+		if len(message.meta.FollowUps) > 0 {
+			builder.WriteString("\n**推荐追问**\n\n")
+			for _, question := range message.meta.FollowUps {
+				fmt.Fprintf(&builder, "- %s\n", question)
+			}
+		}
+		if len(message.meta.Verbose) > 0 {
+			fmt.Fprintf(&builder, "\n<details>\n<summary>过程信息（%d）</summary>\n\n", len(message.meta.Verbose))
+			for _, trace := range message.meta.Verbose {
+				fence := markdownFence(trace.Content)
+				fmt.Fprintf(&builder, "%s\n%s\n%s\n%s\n\n", trace.Type, fence, trace.Content, fence)
+			}
+			builder.WriteString("</details>\n")
+		}
+	}
+	return []byte(builder.String())
+}
+
+// markdownFence 返回比内容中最长的连续反引号更长的代码块围栏
+func markdownFence(content string) string {
+	longest, current := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			current++
+			if current > longest {
+				longest = current
+			}
+			continue
+		}
+		current = 0
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// chatExportHTMLTemplate 独立HTML页面，消息内容保留原始换行，不解析Markdown
+var chatExportHTMLTemplate = template.Must(template.New("chat").Funcs(template.FuncMap{
+	"time":    formatExportTime,
+	"heading": chatMessageHeading,
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Chat.Title}}</title>
+<style>
+body { max-width: 860px; margin: 40px auto; padding: 0 16px; font-family: -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; line-height: 1.6; color: #222; }
+.meta { color: #888; font-size: 13px; }
+.message { border-top: 1px solid #eee; padding: 16px 0; }
+.message h3 { margin: 0 0 8px; font-size: 15px; }
+.message.user h3 { color: #1677ff; }
+.message.assistant h3 { color: #389e0d; }
+.content, pre { white-space: pre-wrap; word-break: break-word; }
+pre { background: #f6f8fa; padding: 8px; border-radius: 4px; font-size: 13px; }
+.reasoning { color: #666; border-left: 3px solid #ddd; padding-left: 12px; margin-bottom: 8px; }
+.section { margin-top: 8px; font-size: 14px; }
+</style>
+</head>
+<body>
+<h1>{{.Chat.Title}}</h1>
+<p class="meta">创建时间：{{time .Chat.CreatedAt}} · 导出时间：{{time .ExportedAt}}</p>
+{{range .Path}}<div class="message {{.Role}}">
+<h3>{{heading .ChatExportMessage}} <span class="meta">{{time .CreatedAt}}</span></h3>
+{{if .Meta.Reasoning}}<details class="reasoning"><summary>思考过程</summary><div class="content">{{.Meta.Reasoning}}</div></details>
+{{end}}<div class="content">{{.Content}}</div>
+{{if .Files}}<div class="section">附件：{{range $i, $file := .Files}}{{if $i}}、{{end}}{{$file.FileName}}{{end}}</div>
+{{end}}{{if .Meta.FollowUps}}<div class="section">推荐追问：<ul>{{range .Meta.FollowUps}}<li>{{.}}</li>{{end}}</ul></div>
+{{end}}{{if .Meta.Verbose}}<details class="section"><summary>过程信息（{{len .Meta.Verbose}}）</summary>{{range .Meta.Verbose}}<div>{{.Type}}</div><pre>{{.Content}}</pre>{{end}}</details>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
+
+// chatExportHTMLMessage HTML模板中的消息
+type chatExportHTMLMessage struct {
+	*ChatExportMessage
+	Meta chatExportMetadata
+}
+
+// renderChatHTML 渲染为独立的HTML页面，所有内容均经过转义
+func renderChatHTML(export *ChatExport) ([]byte, error) {
+	path := make([]chatExportHTMLMessage, 0, len(export.path))
+	for _, message := range export.path {
+		path = append(path, chatExportHTMLMessage{ChatExportMessage: message, Meta: message.meta})
+	}
+
+	var buffer bytes.Buffer
+	if err := chatExportHTMLTemplate.Execute(&buffer, map[string]interface{}{
+		"Chat":       export.Chat,
+		"ExportedAt": export.ExportedAt,
+		"Path":       path,
+	}); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
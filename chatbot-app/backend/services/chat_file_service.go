@@ -0,0 +1,176 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"chatbot-app/backend/config"
+	"chatbot-app/backend/database"
+	"chatbot-app/backend/models"
+	"chatbot-app/backend/utils"
+)
+
+// MAX_MESSAGE_FILES 单条消息最多携带的附件数量
+const MAX_MESSAGE_FILES = 10
+
+// ChatFileService 聊天附件服务
+type ChatFileService struct{}
+
+// IsCozeBotModel 判断模型是否为Coze智能体，只有智能体对话支持文件消息
+func IsCozeBotModel(aiModel *models.AIModel) bool {
+	return aiModel != nil && aiModel.Provider == "coze" && aiModel.Class == "bot"
+}
+
+// HasImageFiles 判断附件中是否有图片，有图片时需要模型支持图片理解
+func HasImageFiles(files []models.ChatFile) bool {
+	for _, file := range files {
+		if strings.HasPrefix(file.MimeType, "image/") {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveFile 保存上传的附件，所选模型为Coze智能体时同时上传到Coze
+func (s *ChatFileService) SaveFile(chat *models.Chat, userId uint, aiModel *models.AIModel, fileHeader *multipart.FileHeader) (*models.ChatFile, error) {
+	uploadConfig := config.GetUploadConfig()
+	if fileHeader.Size > uploadConfig.MaxSize {
+		return nil, fmt.Errorf("文件大小不能超过%dMB", uploadConfig.MaxSize>>20)
+	}
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("读取上传文件失败: %v", err)
+	}
+	defer src.Close()
+
+	// 按会话分目录存储，文件名随机生成避免冲突
+	dir := filepath.Join(uploadConfig.Dir, "chat", strconv.FormatUint(uint64(chat.Id), 10))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建存储目录失败: %v", err)
+	}
+	filePath := filepath.Join(dir, randomFileName()+filepath.Ext(fileHeader.Filename))
+
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("保存文件失败: %v", err)
+	}
+	size, err := io.Copy(dst, src)
+	dst.Close()
+	if err != nil {
+		os.Remove(filePath)
+		return nil, fmt.Errorf("保存文件失败: %v", err)
+	}
+
+	chatFile := &models.ChatFile{
+		ChatId:    chat.Id,
+		UserId:    userId,
+		FileName:  fileHeader.Filename,
+		FilePath:  filePath,
+		MimeType:  fileHeader.Header.Get("Content-Type"),
+		Size:      size,
+		CreatedAt: time.Now(),
+	}
+
+	if IsCozeBotModel(aiModel) {
+		if err := s.uploadToCoze(chatFile, aiModel); err != nil {
+			os.Remove(filePath)
+			return nil, err
+		}
+	}
+
+	if err := database.DB.Create(chatFile).Error; err != nil {
+		os.Remove(filePath)
+		return nil, err
+	}
+	return chatFile, nil
+}
+
+// GetUnsentFiles 获取会话中待发送的附件，已随其他消息发送或不属于该会话的附件会报错
+func (s *ChatFileService) GetUnsentFiles(chatId uint, userId uint, fileIds []uint) ([]models.ChatFile, error) {
+	if len(fileIds) == 0 {
+		return nil, nil
+	}
+	if len(fileIds) > MAX_MESSAGE_FILES {
+		return nil, fmt.Errorf("单条消息最多携带%d个附件", MAX_MESSAGE_FILES)
+	}
+
+	var files []models.ChatFile
+	if err := database.DB.Where("id IN ? AND chat_id = ? AND user_id = ? AND message_id = 0", fileIds, chatId, userId).
+		Order("id ASC").Find(&files).Error; err != nil {
+		return nil, err
+	}
+	if len(files) != len(fileIds) {
+		return nil, errors.New("附件不存在或已被使用")
+	}
+	return files, nil
+}
+
+// EnsureCozeFiles 确保附件已上传到Coze，上传时未选择Coze智能体的附件在发送时补传
+func (s *ChatFileService) EnsureCozeFiles(files []models.ChatFile, aiModel *models.AIModel) error {
+	for i := range files {
+		if files[i].CozeFileId != "" {
+			continue
+		}
+		if err := s.uploadToCoze(&files[i], aiModel); err != nil {
+			return err
+		}
+		if err := database.DB.Model(&models.ChatFile{}).Where("id = ?", files[i].Id).
+			Update("coze_file_id", files[i].CozeFileId).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AttachToMessage 将附件关联到消息
+func (s *ChatFileService) AttachToMessage(files []models.ChatFile, messageId uint) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	fileIds := make([]uint, 0, len(files))
+	for _, file := range files {
+		fileIds = append(fileIds, file.Id)
+	}
+	return database.DB.Model(&models.ChatFile{}).Where("id IN ?", fileIds).Update("message_id", messageId).Error
+}
+
+// uploadToCoze 将本地文件上传到Coze并记录文件Id
+func (s *ChatFileService) uploadToCoze(chatFile *models.ChatFile, aiModel *models.AIModel) error {
+	cozeService, err := NewCozeService(aiModel)
+	if err != nil {
+		return err
+	}
+
+	fileId, err := cozeService.UploadFile(chatFile.FilePath, chatFile.FileName)
+	if err != nil {
+		return err
+	}
+
+	utils.LogInfo("附件已上传到Coze", map[string]interface{}{
+		"chat_id":      chatFile.ChatId,
+		"file_name":    chatFile.FileName,
+		"coze_file_id": fileId,
+	})
+	chatFile.CozeFileId = fileId
+	return nil
+}
+
+// randomFileName 生成随机文件名
+func randomFileName() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,702 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chatbot-app/backend/database"
+	"chatbot-app/backend/models"
+)
+
+const (
+	// CHAT_IMPORT_MAX_SIZE 导入文件的最大大小，ChatGPT导出的conversations.json可能较大；
+	// 同时也是zip压缩包解压后的总大小上限
+	CHAT_IMPORT_MAX_SIZE = 200 << 20
+	// CHAT_IMPORT_MAX_ZIP_ENTRIES zip压缩包中的最大文件数量，ChatGPT的导出包中还有图片等文件
+	CHAT_IMPORT_MAX_ZIP_ENTRIES = 10000
+	// CHAT_IMPORT_MAX_CHATS 一次最多导入的会话数量
+	CHAT_IMPORT_MAX_CHATS = 5000
+	// CHAT_IMPORT_MAX_MESSAGES 一次最多导入的消息总数
+	CHAT_IMPORT_MAX_MESSAGES = 200000
+	// CHAT_IMPORT_BATCH_SIZE 每个事务保存的会话数量，避免大文件导入时长时间占用一个事务
+	CHAT_IMPORT_BATCH_SIZE = 50
+	// CHAT_IMPORT_METADATA_MAX_SIZE 导入消息元数据的最大字节数，超过时丢弃较大的字段，避免一条消息导致整批失败
+	CHAT_IMPORT_METADATA_MAX_SIZE = 64 << 10
+	// chatImportChatType 导入的会话类型
+	chatImportChatType = "chat"
+	// chatImportTitleMaxLen 会话标题的最大字符数，与chat.title字段长度一致
+	chatImportTitleMaxLen = 100
+)
+
+// 导入来源，记录在消息元数据的imported_from中
+const (
+	chatImportSourceChatGPT = "chatgpt"
+	chatImportSourceOpenAI  = "openai"
+	chatImportSourceExport  = "chatbot-app"
+)
+
+// ErrInvalidChatImport 导入文件格式无法识别或内容有误
+var ErrInvalidChatImport = errors.New("无法识别的导入文件")
+
+// ChatImportResult 导入结果
+type ChatImportResult struct {
+	Chats   []*ChatImportItem `json:"chats"`   // 导入成功的会话
+	Skipped int               `json:"skipped"` // 没有可导入的消息而跳过的会话数量
+}
+
+// ChatImportItem 导入成功的会话
+type ChatImportItem struct {
+	ChatId   uint   `json:"chat_id"`
+	Title    string `json:"title"`
+	Messages int    `json:"messages"` // 导入的消息数量
+}
+
+// importedChat 解析后待保存的会话，消息已展开为单一分支
+type importedChat struct {
+	Source    string
+	Title     string
+	CreatedAt time.Time
+	Messages  []*importedMessage
+}
+
+// importedMessage 解析后待保存的消息
+type importedMessage struct {
+	Role      string
+	Content   string
+	ModelName string          // 来源平台的模型名称，与本地模型匹配时关联模型Id
+	Metadata  json.RawMessage // 本平台导出文件中的原始元数据
+	CreatedAt time.Time
+}
+
+// ChatImportService 聊天记录导入服务
+type ChatImportService struct{}
+
+// Import 导入聊天记录，支持ChatGPT导出的conversations.json（或其zip压缩包）、OpenAI格式的消息数组，
+// 以及本平台导出的JSON（单个文件或批量导出的zip压缩包）。有多个分支时只导入当前选中的分支。
+// 会话分批在各自的事务中保存，中途失败时已保存的批次会保留
+func (s *ChatImportService) Import(userId uint, data []byte) (*ChatImportResult, error) {
+	chats, err := parseChatImport(data)
+	if err != nil {
+		return nil, err
+	}
+
+	modelIds, err := chatImportModelIds()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ChatImportResult{Chats: []*ChatImportItem{}}
+	for start := 0; start < len(chats); start += CHAT_IMPORT_BATCH_SIZE {
+		end := start + CHAT_IMPORT_BATCH_SIZE
+		if end > len(chats) {
+			end = len(chats)
+		}
+
+		var items []*ChatImportItem
+		skipped := 0
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			for _, imported := range chats[start:end] {
+				messages := normalizeImportedMessages(imported.Messages)
+				if len(messages) == 0 {
+					skipped++
+					continue
+				}
+				item, err := saveImportedChat(tx, userId, imported, messages, modelIds)
+				if err != nil {
+					return err
+				}
+				items = append(items, item)
+			}
+			return nil
+		})
+		if err != nil {
+			if len(result.Chats) > 0 {
+				return nil, fmt.Errorf("已导入%d个会话后失败: %w", len(result.Chats), err)
+			}
+			return nil, err
+		}
+		result.Chats = append(result.Chats, items...)
+		result.Skipped += skipped
+	}
+	return result, nil
+}
+
+// saveImportedChat 保存会话及其消息，消息依次作为上一条消息的子消息
+func saveImportedChat(tx *gorm.DB, userId uint, imported *importedChat, messages []*importedMessage, modelIds map[string]uint) (*ChatImportItem, error) {
+	now := time.Now()
+	createdAt := imported.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = importTimeOr(messages[0].CreatedAt, now)
+	}
+
+	chat := &models.Chat{
+		Type:        chatImportChatType,
+		UserId:      userId,
+		Title:       importedChatTitle(imported.Title, messages),
+		TitleEdited: true,
+		CreatedAt:   createdAt,
+		UpdatedAt:   importTimeOr(messages[len(messages)-1].CreatedAt, createdAt),
+	}
+	if err := tx.Create(chat).Error; err != nil {
+		return nil, err
+	}
+
+	var parentId uint
+	for _, item := range messages {
+		modelId := modelIds[strings.ToLower(item.ModelName)]
+		metadata, err := importedMessageMetadata(item, modelId, imported.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		message := &models.Message{
+			ChatId:    chat.Id,
+			Role:      item.Role,
+			Content:   item.Content,
+			ModelId:   modelId,
+			Metadata:  metadata,
+			ParentId:  parentId,
+			Active:    true,
+			CreatedAt: importTimeOr(item.CreatedAt, chat.CreatedAt),
+			UpdatedAt: now,
+		}
+		if err := tx.Create(message).Error; err != nil {
+			return nil, err
+		}
+		parentId = message.Id
+	}
+
+	return &ChatImportItem{
+		ChatId:   chat.Id,
+		Title:    chat.Title,
+		Messages: len(messages),
+	}, nil
+}
+
+// importedMessageMetadata 生成导入消息的元数据：保留本平台导出的原始元数据，
+// 记录导入来源和来源平台的模型名称，模型Id替换为本地匹配到的模型
+func importedMessageMetadata(message *importedMessage, modelId uint, source string) (string, error) {
+	metadata := map[string]interface{}{}
+	if message.Metadata != nil {
+		// 元数据不是JSON对象时忽略
+		_ = json.Unmarshal(message.Metadata, &metadata)
+	}
+	delete(metadata, "model_id")
+	if modelId > 0 {
+		metadata["model_id"] = modelId
+	}
+	if message.ModelName != "" {
+		metadata["source_model"] = message.ModelName
+	}
+	metadata["imported_from"] = source
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > CHAT_IMPORT_METADATA_MAX_SIZE {
+		return trimImportedMetadata(metadata)
+	}
+	return string(data), nil
+}
+
+// trimImportedMetadata 元数据过大时从最大的字段开始丢弃（模型和导入来源除外），直到不超过上限
+func trimImportedMetadata(metadata map[string]interface{}) (string, error) {
+	sizes := make(map[string]int, len(metadata))
+	var keys []string
+	for key, value := range metadata {
+		if key == "model_id" || key == "source_model" || key == "imported_from" {
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		sizes[key] = len(data)
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if sizes[keys[i]] != sizes[keys[j]] {
+			return sizes[keys[i]] > sizes[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, key := range keys {
+		delete(metadata, key)
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			return "", err
+		}
+		if len(data) <= CHAT_IMPORT_METADATA_MAX_SIZE {
+			return string(data), nil
+		}
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// chatImportModelIds 按模型名称和显示名称（不区分大小写）索引本地模型
+func chatImportModelIds() (map[string]uint, error) {
+	var aiModels []models.AIModel
+	if err := database.DB.Select("id", "name", "display_name").Find(&aiModels).Error; err != nil {
+		return nil, err
+	}
+	ids := make(map[string]uint, len(aiModels)*2)
+	for _, aiModel := range aiModels {
+		if aiModel.DisplayName != "" {
+			ids[strings.ToLower(aiModel.DisplayName)] = aiModel.Id
+		}
+		ids[strings.ToLower(aiModel.Name)] = aiModel.Id
+	}
+	// 空名称不匹配任何模型
+	delete(ids, "")
+	return ids, nil
+}
+
+// normalizeImportedMessages 只保留用户和AI消息，去掉空消息并合并连续的同角色消息，
+// 保证用户消息与AI回复交替出现，以便继续对话和重新生成
+func normalizeImportedMessages(messages []*importedMessage) []*importedMessage {
+	var normalized []*importedMessage
+	for _, message := range messages {
+		message.Content = strings.TrimSpace(message.Content)
+		if message.Content == "" || (message.Role != "user" && message.Role != "assistant") {
+			continue
+		}
+		if last := len(normalized) - 1; last >= 0 && normalized[last].Role == message.Role {
+			normalized[last].Content += "\n\n" + message.Content
+			if normalized[last].ModelName == "" {
+				normalized[last].ModelName = message.ModelName
+			}
+			continue
+		}
+		normalized = append(normalized, message)
+	}
+	return normalized
+}
+
+// importedChatTitle 会话标题，没有标题时使用第一条用户消息
+func importedChatTitle(title string, messages []*importedMessage) string {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		for _, message := range messages {
+			if message.Role == "user" {
+				title = cleanChatTitle(message.Content)
+				break
+			}
+		}
+	}
+	if title == "" {
+		return CHAT_DEFAULT_TITLE
+	}
+	return truncateRunes(title, chatImportTitleMaxLen)
+}
+
+// importTimeOr 时间为空时使用默认值
+func importTimeOr(t time.Time, fallback time.Time) time.Time {
+	if t.IsZero() {
+		return fallback
+	}
+	return t
+}
+
+// parseChatImport 解析导入文件，zip压缩包中只导入能识别的JSON文件
+func parseChatImport(data []byte) ([]*importedChat, error) {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		chats, err := parseChatImportJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkChatImportLimits(chats, 0, 0); err != nil {
+			return nil, err
+		}
+		return chats, nil
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChatImport, err)
+	}
+	if len(reader.File) > CHAT_IMPORT_MAX_ZIP_ENTRIES {
+		return nil, fmt.Errorf("%w: 压缩包中的文件不能超过%d个", ErrInvalidChatImport, CHAT_IMPORT_MAX_ZIP_ENTRIES)
+	}
+
+	var (
+		chats        []*importedChat
+		messageCount int
+	)
+	recognized := false
+	remaining := int64(CHAT_IMPORT_MAX_SIZE)
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() || !strings.EqualFold(path.Ext(file.Name), ".json") {
+			continue
+		}
+		content, err := readZipFile(file, remaining)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidChatImport, err)
+		}
+		remaining -= int64(len(content))
+
+		// ChatGPT的导出包中还有user.json等其他文件，无法识别的文件直接跳过
+		fileChats, err := parseChatImportJSON(content)
+		if err != nil {
+			continue
+		}
+		if err := checkChatImportLimits(fileChats, len(chats), messageCount); err != nil {
+			return nil, err
+		}
+		recognized = true
+		chats = append(chats, fileChats...)
+		messageCount += countImportedMessages(fileChats)
+	}
+	if !recognized {
+		return nil, fmt.Errorf("%w: 压缩包中没有可导入的聊天记录", ErrInvalidChatImport)
+	}
+	return chats, nil
+}
+
+// readZipFile 读取压缩包中的文件，解压后的大小不能超过剩余的总大小
+func readZipFile(file *zip.File, remaining int64) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	content, err := io.ReadAll(io.LimitReader(src, remaining+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > remaining {
+		return nil, fmt.Errorf("压缩包解压后超过%dMB", CHAT_IMPORT_MAX_SIZE>>20)
+	}
+	return content, nil
+}
+
+// checkChatImportLimits 检查加上新解析的会话后是否超过会话数量和消息总数的上限，
+// chatCount和messageCount为此前已解析的数量
+func checkChatImportLimits(chats []*importedChat, chatCount int, messageCount int) error {
+	if chatCount+len(chats) > CHAT_IMPORT_MAX_CHATS {
+		return fmt.Errorf("%w: 一次最多导入%d个会话", ErrInvalidChatImport, CHAT_IMPORT_MAX_CHATS)
+	}
+	if messageCount+countImportedMessages(chats) > CHAT_IMPORT_MAX_MESSAGES {
+		return fmt.Errorf("%w: 一次最多导入%d条消息", ErrInvalidChatImport, CHAT_IMPORT_MAX_MESSAGES)
+	}
+	return nil
+}
+
+// countImportedMessages 统计会话中解析出的消息数量
+func countImportedMessages(chats []*importedChat) int {
+	count := 0
+	for _, chat := range chats {
+		count += len(chat.Messages)
+	}
+	return count
+}
+
+// chatImportProbe 用于识别导入文件格式的字段
+type chatImportProbe struct {
+	Format   string          `json:"format"`
+	Mapping  json.RawMessage `json:"mapping"`
+	Messages json.RawMessage `json:"messages"`
+	Role     string          `json:"role"`
+}
+
+// parseChatImportJSON 识别JSON格式并解析：
+// 对象可以是本平台导出的会话、ChatGPT的单个会话或{"title", "messages"}形式的OpenAI消息；
+// 数组可以是上述会话的列表（如conversations.json），或OpenAI格式的消息数组（作为一个会话）
+func parseChatImportJSON(data []byte) ([]*importedChat, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: 文件内容为空", ErrInvalidChatImport)
+	}
+
+	if data[0] == '{' {
+		chat, err := parseChatImportObject(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*importedChat{chat}, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChatImport, err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: 没有聊天记录", ErrInvalidChatImport)
+	}
+
+	var first chatImportProbe
+	if err := json.Unmarshal(items[0], &first); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChatImport, err)
+	}
+	if first.Role != "" {
+		chat, err := parseOpenAIMessages("", items)
+		if err != nil {
+			return nil, err
+		}
+		return []*importedChat{chat}, nil
+	}
+
+	chats := make([]*importedChat, 0, len(items))
+	for i, item := range items {
+		chat, err := parseChatImportObject(item)
+		if err != nil {
+			return nil, fmt.Errorf("第%d个会话: %w", i+1, err)
+		}
+		chats = append(chats, chat)
+	}
+	return chats, nil
+}
+
+// parseChatImportObject 解析单个会话对象
+func parseChatImportObject(data []byte) (*importedChat, error) {
+	var probe chatImportProbe
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChatImport, err)
+	}
+
+	switch {
+	case probe.Format == CHAT_EXPORT_FORMAT:
+		return parseChatExportImport(data)
+	case probe.Mapping != nil:
+		return parseChatGPTConversation(data)
+	case probe.Messages != nil:
+		var conversation struct {
+			Title    string            `json:"title"`
+			Messages []json.RawMessage `json:"messages"`
+		}
+		if err := json.Unmarshal(data, &conversation); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidChatImport, err)
+		}
+		return parseOpenAIMessages(conversation.Title, conversation.Messages)
+	}
+	return nil, ErrInvalidChatImport
+}
+
+// parseChatExportImport 解析本平台导出的JSON，只导入当前选中的分支
+func parseChatExportImport(data []byte) (*importedChat, error) {
+	var export ChatExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChatImport, err)
+	}
+	if export.Version > CHAT_EXPORT_VERSION {
+		return nil, fmt.Errorf("%w: 不支持的导出文件版本%d", ErrInvalidChatImport, export.Version)
+	}
+
+	// 按导出时的父子关系和选中状态确定分支
+	messages := make([]models.Message, 0, len(export.Messages))
+	exported := make(map[uint]*ChatExportMessage, len(export.Messages))
+	for _, message := range export.Messages {
+		messages = append(messages, models.Message{Id: message.Id, ParentId: message.ParentId, Active: message.Active})
+		exported[message.Id] = message
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Id < messages[j].Id })
+
+	chat := &importedChat{
+		Source:    chatImportSourceExport,
+		Title:     export.Chat.Title,
+		CreatedAt: export.Chat.CreatedAt,
+	}
+	for _, message := range newMessageTree(messages).activePath() {
+		item := exported[message.Id]
+		metadata := item.Metadata
+		if metadata == nil {
+			metadata = json.RawMessage("{}")
+		}
+		chat.Messages = append(chat.Messages, &importedMessage{
+			Role:      item.Role,
+			Content:   item.Content,
+			ModelName: item.ModelName,
+			Metadata:  metadata,
+			CreatedAt: item.CreatedAt,
+		})
+	}
+	return chat, nil
+}
+
+// chatGPTConversation ChatGPT导出的会话，消息以树的形式保存在mapping中
+type chatGPTConversation struct {
+	Title       string                  `json:"title"`
+	CreateTime  float64                 `json:"create_time"`
+	CurrentNode string                  `json:"current_node"` // 当前选中分支的最后一个节点
+	Mapping     map[string]*chatGPTNode `json:"mapping"`
+}
+
+// chatGPTNode ChatGPT会话中的节点
+type chatGPTNode struct {
+	Id      string          `json:"id"`
+	Message *chatGPTMessage `json:"message"`
+	Parent  string          `json:"parent"`
+}
+
+// chatGPTMessage ChatGPT会话中的消息
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime float64 `json:"create_time"`
+	Content    struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+	} `json:"content"`
+	Recipient string `json:"recipient"`
+	Metadata  struct {
+		ModelSlug       string `json:"model_slug"`
+		IsHidden        bool   `json:"is_visually_hidden_from_conversation"`
+		IsUserSystemMsg bool   `json:"is_user_system_message"`
+	} `json:"metadata"`
+}
+
+// parseChatGPTConversation 解析ChatGPT的会话，从current_node沿parent回溯得到当前分支；
+// 只导入文本内容，图片等非文本部分、插件调用和隐藏消息会被忽略
+func parseChatGPTConversation(data []byte) (*importedChat, error) {
+	var conversation chatGPTConversation
+	if err := json.Unmarshal(data, &conversation); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChatImport, err)
+	}
+
+	current := conversation.CurrentNode
+	if conversation.Mapping[current] == nil {
+		current = latestChatGPTNode(conversation.Mapping)
+	}
+
+	var path []*chatGPTMessage
+	for id, steps := current, 0; id != "" && steps <= len(conversation.Mapping); steps++ {
+		node := conversation.Mapping[id]
+		if node == nil {
+			break
+		}
+		if node.Message != nil {
+			path = append(path, node.Message)
+		}
+		id = node.Parent
+	}
+
+	chat := &importedChat{
+		Source:    chatImportSourceChatGPT,
+		Title:     conversation.Title,
+		CreatedAt: unixSecondsTime(conversation.CreateTime),
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		message := path[i]
+		if message.Metadata.IsHidden || message.Metadata.IsUserSystemMsg {
+			continue
+		}
+		if message.Recipient != "" && message.Recipient != "all" {
+			continue
+		}
+		if message.Content.ContentType != "text" && message.Content.ContentType != "multimodal_text" {
+			continue
+		}
+		chat.Messages = append(chat.Messages, &importedMessage{
+			Role:      message.Author.Role,
+			Content:   chatGPTTextParts(message.Content.Parts),
+			ModelName: message.Metadata.ModelSlug,
+			CreatedAt: unixSecondsTime(message.CreateTime),
+		})
+	}
+	return chat, nil
+}
+
+// latestChatGPTNode 没有current_node时取最新的消息节点
+func latestChatGPTNode(mapping map[string]*chatGPTNode) string {
+	var (
+		latestId   string
+		latestTime float64
+	)
+	for id, node := range mapping {
+		if node.Message == nil {
+			continue
+		}
+		if latestId == "" || node.Message.CreateTime > latestTime {
+			latestId, latestTime = id, node.Message.CreateTime
+		}
+	}
+	return latestId
+}
+
+// chatGPTTextParts 拼接消息中的文本部分
+func chatGPTTextParts(parts []json.RawMessage) string {
+	var texts []string
+	for _, part := range parts {
+		var text string
+		if err := json.Unmarshal(part, &text); err == nil && text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// unixSecondsTime 将带小数的Unix秒数转换为时间，0表示未知
+func unixSecondsTime(seconds float64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// openAIMessage OpenAI格式的消息，content可以是字符串或内容片段数组
+type openAIMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// parseOpenAIMessages 解析OpenAI格式的消息数组，只导入文本内容
+func parseOpenAIMessages(title string, items []json.RawMessage) (*importedChat, error) {
+	chat := &importedChat{
+		Source: chatImportSourceOpenAI,
+		Title:  title,
+	}
+	for i, item := range items {
+		var message openAIMessage
+		if err := json.Unmarshal(item, &message); err != nil {
+			return nil, fmt.Errorf("%w: 第%d条消息: %v", ErrInvalidChatImport, i+1, err)
+		}
+		if message.Role == "" {
+			return nil, fmt.Errorf("%w: 第%d条消息缺少role", ErrInvalidChatImport, i+1)
+		}
+		chat.Messages = append(chat.Messages, &importedMessage{
+			Role:    message.Role,
+			Content: openAIMessageText(message.Content),
+		})
+	}
+	return chat, nil
+}
+
+// openAIMessageText 提取消息内容中的文本
+func openAIMessageText(content json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return ""
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
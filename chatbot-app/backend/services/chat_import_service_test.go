@@ -0,0 +1,273 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// importedContents 返回会话中各消息的角色和内容，便于比较
+func importedContents(messages []*importedMessage) []string {
+	contents := make([]string, 0, len(messages))
+	for _, message := range messages {
+		contents = append(contents, message.Role+": "+message.Content)
+	}
+	return contents
+}
+
+func TestParseChatGPTConversation(t *testing.T) {
+	// a为根节点，b之后有c和d两个分支，current_node指向d分支的末尾e
+	mapping := `{
+		"root": {"id": "root", "message": null, "parent": ""},
+		"a": {"id": "a", "parent": "root", "message": {"author": {"role": "system"}, "create_time": 1, "content": {"content_type": "text", "parts": ["系统提示"]}, "metadata": {"is_visually_hidden_from_conversation": true}}},
+		"b": {"id": "b", "parent": "a", "message": {"author": {"role": "user"}, "create_time": 2, "content": {"content_type": "text", "parts": ["你好"]}}},
+		"c": {"id": "c", "parent": "b", "message": {"author": {"role": "assistant"}, "create_time": 5, "content": {"content_type": "text", "parts": ["旧回复"]}}},
+		"d": {"id": "d", "parent": "b", "message": {"author": {"role": "assistant"}, "create_time": 3, "content": {"content_type": "code", "parts": ["print(1)"]}, "recipient": "python"}},
+		"e": {"id": "e", "parent": "d", "message": {"author": {"role": "assistant"}, "create_time": 4, "content": {"content_type": "multimodal_text", "parts": [{"asset_pointer": "file"}, "新回复"]}, "metadata": {"model_slug": "gpt-4o"}}}
+	}`
+
+	tests := []struct {
+		name        string
+		currentNode string
+		contents    []string
+	}{
+		{
+			name:        "沿current_node回溯",
+			currentNode: "e",
+			contents:    []string{"user: 你好", "assistant: 新回复"},
+		},
+		{
+			name:        "current_node不存在时取最新节点",
+			currentNode: "missing",
+			contents:    []string{"user: 你好", "assistant: 旧回复"},
+		},
+		{
+			name:        "没有current_node时取最新节点",
+			currentNode: "",
+			contents:    []string{"user: 你好", "assistant: 旧回复"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := `{"title": "测试", "create_time": 1700000000.5, "current_node": "` + tt.currentNode + `", "mapping": ` + mapping + `}`
+			chat, err := parseChatGPTConversation([]byte(data))
+			if err != nil {
+				t.Fatalf("解析失败: %v", err)
+			}
+			if chat.Source != chatImportSourceChatGPT || chat.Title != "测试" {
+				t.Errorf("会话 = %+v", chat)
+			}
+			if chat.CreatedAt.Unix() != 1700000000 {
+				t.Errorf("创建时间 = %v", chat.CreatedAt)
+			}
+			if contents := importedContents(chat.Messages); !reflect.DeepEqual(contents, tt.contents) {
+				t.Errorf("消息 = %v, 期望 %v", contents, tt.contents)
+			}
+		})
+	}
+}
+
+func TestParseChatGPTConversationCycle(t *testing.T) {
+	// parent形成环时不应死循环
+	data := `{"current_node": "a", "mapping": {
+		"a": {"id": "a", "parent": "b", "message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["回复"]}}},
+		"b": {"id": "b", "parent": "a", "message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["问题"]}}}
+	}}`
+	chat, err := parseChatGPTConversation([]byte(data))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if len(chat.Messages) > 3 {
+		t.Errorf("消息数量 = %d", len(chat.Messages))
+	}
+}
+
+func TestNormalizeImportedMessages(t *testing.T) {
+	messages := []*importedMessage{
+		{Role: "system", Content: "系统提示"},
+		{Role: "user", Content: "  第一段  "},
+		{Role: "user", Content: "第二段"},
+		{Role: "assistant", Content: "   "},
+		{Role: "tool", Content: "工具结果"},
+		{Role: "assistant", Content: "回复一"},
+		{Role: "assistant", Content: "回复二", ModelName: "gpt-4o"},
+		{Role: "user", Content: "追问"},
+	}
+
+	normalized := normalizeImportedMessages(messages)
+	expected := []string{
+		"user: 第一段\n\n第二段",
+		"assistant: 回复一\n\n回复二",
+		"user: 追问",
+	}
+	if contents := importedContents(normalized); !reflect.DeepEqual(contents, expected) {
+		t.Fatalf("消息 = %q, 期望 %q", contents, expected)
+	}
+	if normalized[1].ModelName != "gpt-4o" {
+		t.Errorf("合并后的模型名称 = %q, 期望 gpt-4o", normalized[1].ModelName)
+	}
+	if normalizeImportedMessages(nil) != nil {
+		t.Errorf("没有消息时应返回空")
+	}
+}
+
+func TestParseChatImportJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		chats    int
+		source   string
+		contents []string
+	}{
+		{
+			name:     "OpenAI消息数组",
+			data:     `[{"role": "user", "content": "你好"}, {"role": "assistant", "content": [{"type": "text", "text": "你好！"}]}]`,
+			chats:    1,
+			source:   chatImportSourceOpenAI,
+			contents: []string{"user: 你好", "assistant: 你好！"},
+		},
+		{
+			name:     "OpenAI带标题",
+			data:     `{"title": "问候", "messages": [{"role": "user", "content": "你好"}]}`,
+			chats:    1,
+			source:   chatImportSourceOpenAI,
+			contents: []string{"user: 你好"},
+		},
+		{
+			name:     "ChatGPT会话列表",
+			data:     `[{"title": "一", "mapping": {}}, {"title": "二", "mapping": {}}]`,
+			chats:    2,
+			source:   chatImportSourceChatGPT,
+			contents: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chats, err := parseChatImportJSON([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("解析失败: %v", err)
+			}
+			if len(chats) != tt.chats {
+				t.Fatalf("会话数量 = %d, 期望 %d", len(chats), tt.chats)
+			}
+			if chats[0].Source != tt.source {
+				t.Errorf("来源 = %q, 期望 %q", chats[0].Source, tt.source)
+			}
+			if contents := importedContents(chats[0].Messages); !reflect.DeepEqual(contents, tt.contents) {
+				t.Errorf("消息 = %v, 期望 %v", contents, tt.contents)
+			}
+		})
+	}
+}
+
+func TestParseChatImportInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "空文件", data: "  "},
+		{name: "非JSON", data: "hello"},
+		{name: "空数组", data: "[]"},
+		{name: "无法识别的对象", data: `{"foo": "bar"}`},
+		{name: "列表中有无法识别的会话", data: `[{"title": "一", "mapping": {}}, {"foo": 1}]`},
+		{name: "消息缺少role", data: `{"messages": [{"content": "你好"}]}`},
+		{name: "导出文件版本过高", data: `{"format": "` + CHAT_EXPORT_FORMAT + `", "version": 999}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseChatImport([]byte(tt.data)); !errors.Is(err, ErrInvalidChatImport) {
+				t.Errorf("错误 = %v, 期望 ErrInvalidChatImport", err)
+			}
+		})
+	}
+}
+
+// newImportZip 生成包含指定文件的zip压缩包
+func newImportZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseChatImportZip(t *testing.T) {
+	data := newImportZip(t, map[string]string{
+		"conversations.json": `[{"title": "一", "mapping": {}}]`,
+		"user.json":          `{"id": "user-1", "email": "a@example.com"}`,
+		"chat.html":          "<html></html>",
+	})
+	chats, err := parseChatImport(data)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if len(chats) != 1 || chats[0].Title != "一" {
+		t.Errorf("会话 = %+v", chats)
+	}
+
+	// 没有可识别的JSON文件
+	data = newImportZip(t, map[string]string{"user.json": `{"id": "user-1"}`})
+	if _, err := parseChatImport(data); !errors.Is(err, ErrInvalidChatImport) {
+		t.Errorf("错误 = %v, 期望 ErrInvalidChatImport", err)
+	}
+}
+
+func TestCheckChatImportLimits(t *testing.T) {
+	chats := []*importedChat{{Messages: make([]*importedMessage, 10)}, {Messages: make([]*importedMessage, 5)}}
+	if err := checkChatImportLimits(chats, 0, 0); err != nil {
+		t.Errorf("未超过上限时返回错误: %v", err)
+	}
+	if err := checkChatImportLimits(chats, CHAT_IMPORT_MAX_CHATS-1, 0); !errors.Is(err, ErrInvalidChatImport) {
+		t.Errorf("会话数量超过上限时错误 = %v", err)
+	}
+	if err := checkChatImportLimits(chats, 0, CHAT_IMPORT_MAX_MESSAGES-14); !errors.Is(err, ErrInvalidChatImport) {
+		t.Errorf("消息数量超过上限时错误 = %v", err)
+	}
+}
+
+func TestImportedMessageMetadata(t *testing.T) {
+	message := &importedMessage{
+		ModelName: "gpt-4o",
+		Metadata: json.RawMessage(`{"model_id": 9, "reasoning_content": "` + strings.Repeat("思", CHAT_IMPORT_METADATA_MAX_SIZE) +
+			`", "follow_ups": ["能举个例子吗？"]}`),
+	}
+	data, err := importedMessageMetadata(message, 3, chatImportSourceExport)
+	if err != nil {
+		t.Fatalf("生成元数据失败: %v", err)
+	}
+	if len(data) > CHAT_IMPORT_METADATA_MAX_SIZE {
+		t.Fatalf("元数据长度 = %d, 超过上限", len(data))
+	}
+
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &metadata); err != nil {
+		t.Fatalf("元数据不是合法JSON: %v", err)
+	}
+	expected := map[string]interface{}{
+		"model_id":      float64(3),
+		"source_model":  "gpt-4o",
+		"imported_from": chatImportSourceExport,
+		"follow_ups":    []interface{}{"能举个例子吗？"},
+	}
+	if !reflect.DeepEqual(metadata, expected) {
+		t.Errorf("元数据 = %v, 期望 %v", metadata, expected)
+	}
+}
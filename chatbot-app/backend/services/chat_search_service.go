@@ -0,0 +1,307 @@
+package services
+
+import (
+	"errors"
+	"html"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"chatbot-app/backend/database"
+)
+
+const (
+	// CHAT_SEARCH_SNIPPET_RADIUS 搜索结果摘要中关键词前后保留的字符数
+	CHAT_SEARCH_SNIPPET_RADIUS = 40
+	// CHAT_SEARCH_TITLE_LIMIT 标题匹配的会话最多返回的数量
+	CHAT_SEARCH_TITLE_LIMIT = 20
+	// chatSearchNgramSize 与MySQL ngram_token_size一致，短于该长度的关键词无法使用全文索引
+	chatSearchNgramSize = 2
+	// 搜索结果中关键词的高亮标签
+	chatSearchHighlightStart = "<em>"
+	chatSearchHighlightEnd   = "</em>"
+)
+
+// ChatSearchQuery 聊天搜索条件
+type ChatSearchQuery struct {
+	UserId    uint
+	Keyword   string     // 搜索关键词，多个关键词以空格分隔，需全部匹配
+	ModelId   uint       // 只搜索指定模型的回复，0表示不限
+	Role      string     // 只搜索指定角色的消息：user、assistant，为空表示不限
+	StartTime *time.Time // 消息创建时间下限
+	EndTime   *time.Time // 消息创建时间上限
+	Page      int
+	Limit     int
+}
+
+// ChatSearchChatHit 标题匹配的会话
+type ChatSearchChatHit struct {
+	ChatId    uint      `json:"chat_id"`
+	Title     string    `json:"title"` // 高亮后的标题，已转义HTML
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChatSearchMessageHit 内容匹配的消息
+type ChatSearchMessageHit struct {
+	ChatId    uint      `json:"chat_id"`
+	ChatTitle string    `json:"chat_title"`
+	MessageId uint      `json:"message_id"`
+	Role      string    `json:"role"`
+	ModelId   uint      `json:"model_id"`
+	Snippet   string    `json:"snippet"` // 关键词附近的高亮摘要，已转义HTML
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChatSearchResult 聊天搜索结果
+type ChatSearchResult struct {
+	Chats    []*ChatSearchChatHit    `json:"chats"`    // 标题匹配的会话，仅第一页返回
+	Messages []*ChatSearchMessageHit `json:"messages"` // 内容匹配的消息，按时间倒序分页
+	Total    int64                   `json:"total"`    // 匹配的消息总数
+}
+
+// ChatSearcher 聊天搜索引擎，默认基于MySQL全文索引，可通过SetChatSearcher替换为其他实现
+type ChatSearcher interface {
+	Search(query *ChatSearchQuery) (*ChatSearchResult, error)
+}
+
+var (
+	chatSearcher   ChatSearcher = &MySQLChatSearcher{}
+	chatSearcherMu sync.RWMutex
+)
+
+// SetChatSearcher 替换聊天搜索引擎
+func SetChatSearcher(searcher ChatSearcher) {
+	chatSearcherMu.Lock()
+	defer chatSearcherMu.Unlock()
+	chatSearcher = searcher
+}
+
+// GetChatSearcher 获取当前使用的聊天搜索引擎
+func GetChatSearcher() ChatSearcher {
+	chatSearcherMu.RLock()
+	defer chatSearcherMu.RUnlock()
+	return chatSearcher
+}
+
+// ValidateChatSearchQuery 校验搜索条件
+func ValidateChatSearchQuery(query *ChatSearchQuery) error {
+	if len(chatSearchTerms(query.Keyword)) == 0 {
+		return errors.New("请输入搜索关键词")
+	}
+	if query.Role != "" && query.Role != "user" && query.Role != "assistant" {
+		return errors.New("不支持的消息角色")
+	}
+	if query.StartTime != nil && query.EndTime != nil && query.StartTime.After(*query.EndTime) {
+		return errors.New("开始日期不能晚于结束日期")
+	}
+	return nil
+}
+
+// MySQLChatSearcher 基于MySQL ngram全文索引的搜索实现，依赖migrations/014_chat_search_fulltext.sql创建的索引
+type MySQLChatSearcher struct{}
+
+// messageSearchRow 消息搜索的查询结果
+type messageSearchRow struct {
+	MessageId uint
+	ChatId    uint
+	ChatTitle string
+	Role      string
+	ModelId   uint
+	Content   string
+	CreatedAt time.Time
+}
+
+// Search 按关键词搜索，长度足够的关键词使用全文索引，过短的关键词退化为LIKE
+func (s *MySQLChatSearcher) Search(query *ChatSearchQuery) (*ChatSearchResult, error) {
+	terms := chatSearchTerms(query.Keyword)
+	result := &ChatSearchResult{
+		Chats:    []*ChatSearchChatHit{},
+		Messages: []*ChatSearchMessageHit{},
+	}
+
+	messageQuery := database.DB.Table("message AS m").
+		Joins("JOIN chat AS c ON c.id = m.chat_id AND c.deleted_at IS NULL").
+		Where("c.user_id = ? AND m.deleted_at IS NULL", query.UserId)
+	messageQuery = applyChatSearchTerms(messageQuery, "m.content", terms)
+	if query.ModelId > 0 {
+		messageQuery = messageQuery.Where("m.model_id = ?", query.ModelId)
+	}
+	if query.Role != "" {
+		messageQuery = messageQuery.Where("m.role = ?", query.Role)
+	}
+	if query.StartTime != nil {
+		messageQuery = messageQuery.Where("m.created_at >= ?", *query.StartTime)
+	}
+	if query.EndTime != nil {
+		messageQuery = messageQuery.Where("m.created_at <= ?", *query.EndTime)
+	}
+
+	if err := messageQuery.Session(&gorm.Session{}).Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []messageSearchRow
+	if err := messageQuery.
+		Select("m.id AS message_id, m.chat_id, c.title AS chat_title, m.role, m.model_id, m.content, m.created_at").
+		Order("m.created_at DESC").Order("m.id DESC").
+		Offset((query.Page - 1) * query.Limit).
+		Limit(query.Limit).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result.Messages = append(result.Messages, &ChatSearchMessageHit{
+			ChatId:    row.ChatId,
+			ChatTitle: html.EscapeString(row.ChatTitle),
+			MessageId: row.MessageId,
+			Role:      row.Role,
+			ModelId:   row.ModelId,
+			Snippet:   highlightSearchTerms(row.Content, terms, CHAT_SEARCH_SNIPPET_RADIUS),
+			CreatedAt: row.CreatedAt,
+		})
+	}
+
+	// 标题匹配与消息过滤条件无关，只在第一页返回
+	if query.Page > 1 {
+		return result, nil
+	}
+	chatQuery := database.DB.Table("chat").
+		Where("user_id = ? AND deleted_at IS NULL", query.UserId)
+	chatQuery = applyChatSearchTerms(chatQuery, "title", terms)
+	if query.StartTime != nil {
+		chatQuery = chatQuery.Where("created_at >= ?", *query.StartTime)
+	}
+	if query.EndTime != nil {
+		chatQuery = chatQuery.Where("created_at <= ?", *query.EndTime)
+	}
+
+	var chats []struct {
+		Id        uint
+		Title     string
+		CreatedAt time.Time
+	}
+	if err := chatQuery.Select("id, title, created_at").
+		Order("pinned DESC").Order("id DESC").
+		Limit(CHAT_SEARCH_TITLE_LIMIT).
+		Scan(&chats).Error; err != nil {
+		return nil, err
+	}
+	for _, chat := range chats {
+		result.Chats = append(result.Chats, &ChatSearchChatHit{
+			ChatId:    chat.Id,
+			Title:     highlightSearchTerms(chat.Title, terms, 0),
+			CreatedAt: chat.CreatedAt,
+		})
+	}
+	return result, nil
+}
+
+// applyChatSearchTerms 为查询添加关键词条件
+func applyChatSearchTerms(query *gorm.DB, column string, terms []string) *gorm.DB {
+	var phrases []string
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < chatSearchNgramSize {
+			query = query.Where(column+" LIKE ?", "%"+escapeLike(term)+"%")
+			continue
+		}
+		// 布尔模式下以短语匹配，要求每个关键词都出现
+		phrases = append(phrases, `+"`+term+`"`)
+	}
+	if len(phrases) > 0 {
+		query = query.Where("MATCH("+column+") AGAINST(? IN BOOLEAN MODE)", strings.Join(phrases, " "))
+	}
+	return query
+}
+
+// chatSearchTerms 拆分关键词，去掉全文检索的操作符
+func chatSearchTerms(keyword string) []string {
+	cleaned := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`"+-<>()~*@`, r) {
+			return ' '
+		}
+		return r
+	}, keyword)
+
+	var terms []string
+	seen := make(map[string]bool)
+	for _, term := range strings.Fields(cleaned) {
+		lower := strings.ToLower(term)
+		if !seen[lower] {
+			seen[lower] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// escapeLike 转义LIKE中的通配符
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// highlightSearchTerms 截取第一个关键词附近的文本并高亮所有关键词，radius为0时不截取
+// 返回的文本已转义HTML，只有高亮标签可以直接渲染
+func highlightSearchTerms(text string, terms []string, radius int) string {
+	runes := []rune(text)
+	lowerRunes := []rune(strings.ToLower(text))
+	if len(lowerRunes) != len(runes) {
+		// 大小写转换改变了长度时按原文匹配
+		lowerRunes = runes
+	}
+
+	// 找出所有关键词出现的位置
+	type span struct{ start, end int }
+	var spans []span
+	for _, term := range terms {
+		termRunes := []rune(strings.ToLower(term))
+		if len(termRunes) == 0 {
+			continue
+		}
+		for i := 0; i+len(termRunes) <= len(lowerRunes); i++ {
+			if string(lowerRunes[i:i+len(termRunes)]) == string(termRunes) {
+				spans = append(spans, span{i, i + len(termRunes)})
+				i += len(termRunes) - 1
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	start, end := 0, len(runes)
+	if radius > 0 {
+		center := 0
+		if len(spans) > 0 {
+			center = spans[0].start
+		}
+		if center-radius > 0 {
+			start = center - radius
+		}
+		if center+radius*2 < end {
+			end = center + radius*2
+		}
+	}
+
+	var builder strings.Builder
+	if start > 0 {
+		builder.WriteString("...")
+	}
+	position := start
+	for _, s := range spans {
+		if s.start < position || s.end > end {
+			continue
+		}
+		builder.WriteString(html.EscapeString(string(runes[position:s.start])))
+		builder.WriteString(chatSearchHighlightStart)
+		builder.WriteString(html.EscapeString(string(runes[s.start:s.end])))
+		builder.WriteString(chatSearchHighlightEnd)
+		position = s.end
+	}
+	builder.WriteString(html.EscapeString(string(runes[position:end])))
+	if end < len(runes) {
+		builder.WriteString("...")
+	}
+	return builder.String()
+}
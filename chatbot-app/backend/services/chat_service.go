@@ -5,15 +5,18 @@ import (
 	"chatbot-app/backend/models"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"strings"
 	"time"
 )
 
 // ChatService 聊天服务
 type ChatService struct{}
 
-// CreateChat 创建聊天会话
+// CreateChat 创建聊天会话，未提供标题时使用默认标题，首轮回复后自动生成
 func (s *ChatService) CreateChat(chatType string, userId uint, title string) (*models.Chat, error) {
+	if strings.TrimSpace(title) == "" {
+		title = CHAT_DEFAULT_TITLE
+	}
 	chat := &models.Chat{
 		Type:      chatType,
 		UserId:    userId,
@@ -29,17 +32,103 @@ func (s *ChatService) CreateChat(chatType string, userId uint, title string) (*m
 	return chat, nil
 }
 
-// GetUserChatList 获取用户的所有聊天会话
-func (s *ChatService) GetUserChatList(userId uint) ([]models.Chat, error) {
-	var chats []models.Chat
-	if err := database.DB.Where("user_id = ?", userId).Order("id DESC").Find(&chats).Error; err != nil {
+// ChatListFilter 聊天会话列表过滤条件
+type ChatListFilter struct {
+	Archived *bool // 为空时不区分是否归档
+}
+
+// ChatUpdate 聊天会话可修改的字段，为空的字段不修改
+type ChatUpdate struct {
+	Title    *string
+	Pinned   *bool
+	Archived *bool
+}
+
+// GetUserChatList 分页获取用户的聊天会话，置顶的会话排在前面，其余按创建时间倒序
+func (s *ChatService) GetUserChatList(userId uint, filter *ChatListFilter, page *CursorPagination) ([]models.Chat, *CursorPageInfo, error) {
+	query := database.DB.Model(&models.Chat{}).Where("user_id = ?", userId)
+	if filter != nil && filter.Archived != nil {
+		query = query.Where("archived = ?", *filter.Archived)
+	}
+
+	return paginateByCursor(query, page, []cursorKey{
+		{Column: "pinned", Desc: true},
+		{Column: "id", Desc: true},
+	}, func(chat *models.Chat) []int64 {
+		return []int64{boolCursorValue(chat.Pinned), int64(chat.Id)}
+	})
+}
+
+// UpdateChat 修改聊天会话的标题、置顶和归档状态
+func (s *ChatService) UpdateChat(chatId, userId uint, update *ChatUpdate) (*models.Chat, error) {
+	chat, err := s.GetChatById(chatId, userId)
+	if err != nil {
 		return nil, err
 	}
-	fmt.Println(chats)
 
+	updates := map[string]interface{}{}
+	if update.Title != nil {
+		title := strings.TrimSpace(*update.Title)
+		if title == "" {
+			return nil, errors.New("标题不能为空")
+		}
+		updates["title"] = title
+		updates["title_edited"] = true
+	}
+	if update.Pinned != nil {
+		updates["pinned"] = *update.Pinned
+	}
+	if update.Archived != nil {
+		updates["archived"] = *update.Archived
+	}
+	if len(updates) == 0 {
+		return nil, errors.New("没有需要更新的字段")
+	}
+
+	if err := database.DB.Model(chat).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return chat, nil
+}
+
+// DeleteChat 删除聊天会话，删除后进入回收站，可以恢复
+func (s *ChatService) DeleteChat(chatId, userId uint) error {
+	result := database.DB.Where("id = ? AND user_id = ?", chatId, userId).Delete(&models.Chat{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("聊天会话不存在")
+	}
+	return nil
+}
+
+// GetDeletedChatList 获取回收站中的聊天会话，最近删除的排在前面
+func (s *ChatService) GetDeletedChatList(userId uint) ([]models.Chat, error) {
+	var chats []models.Chat
+	if err := database.DB.Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", userId).
+		Order("deleted_at DESC").
+		Find(&chats).Error; err != nil {
+		return nil, err
+	}
 	return chats, nil
 }
 
+// RestoreChat 从回收站恢复聊天会话
+func (s *ChatService) RestoreChat(chatId, userId uint) (*models.Chat, error) {
+	result := database.DB.Unscoped().Model(&models.Chat{}).
+		Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", chatId, userId).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("回收站中没有该聊天会话")
+	}
+	return s.GetChatById(chatId, userId)
+}
+
 // GetChatById 根据Id获取聊天会话
 func (s *ChatService) GetChatById(chatId, userId uint) (*models.Chat, error) {
 	var chat models.Chat
@@ -49,8 +138,8 @@ func (s *ChatService) GetChatById(chatId, userId uint) (*models.Chat, error) {
 	return &chat, nil
 }
 
-// AddMessage 添加消息到聊天会话
-func (s *ChatService) AddMessage(chat *models.Chat, role, content string) (*models.Message, error) {
+// AddMessage 添加消息到聊天会话，parentId为上一条消息的Id，新消息成为该分支上选中的消息
+func (s *ChatService) AddMessage(chat *models.Chat, parentId uint, role, content string) (*models.Message, error) {
 	// 验证聊天会话是否存在
 	//var chat models.Chat
 	//if err := database.DB.First(&chat, chatId).Error; err != nil {
@@ -62,26 +151,50 @@ func (s *ChatService) AddMessage(chat *models.Chat, role, content string) (*mode
 		ChatId:    chat.Id,
 		Role:      role,
 		Content:   content,
+		ParentId:  parentId,
+		Active:    true,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	if err := database.DB.Create(message).Error; err != nil {
+	if err := s.createBranchMessage(message); err != nil {
 		return nil, err
 	}
 
 	return message, nil
 }
 
-// GetChatMessages 获取聊天会话的所有消息
+// GetChatMessages 获取聊天会话所有分支的消息，按创建顺序排列
 func (s *ChatService) GetChatMessages(chatId uint) ([]models.Message, error) {
 	var messages []models.Message
-	if err := database.DB.Where("chat_id = ?", chatId).Order("created_at ASC").Find(&messages).Error; err != nil {
+	if err := database.DB.Preload("Files").Where("chat_id = ?", chatId).Order("id ASC").Find(&messages).Error; err != nil {
 		return nil, err
 	}
 	return messages, nil
 }
 
+// GetMessage 获取聊天会话中的消息
+func (s *ChatService) GetMessage(chatId uint, messageId uint) (*models.Message, error) {
+	var message models.Message
+	if err := database.DB.Preload("Files").Where("id = ? AND chat_id = ?", messageId, chatId).First(&message).Error; err != nil {
+		return nil, errors.New("消息不存在")
+	}
+	return &message, nil
+}
+
+// GetRegenerateSource 获取重新生成AI回复时对应的用户消息，即该回复的父消息
+func (s *ChatService) GetRegenerateSource(reply *models.Message) (*models.Message, error) {
+	if reply.Role != "assistant" {
+		return nil, errors.New("只能重新生成AI回复")
+	}
+
+	userMessage, err := s.GetMessage(reply.ChatId, reply.ParentId)
+	if err != nil || userMessage.Role != "user" {
+		return nil, errors.New("找不到该回复对应的用户消息")
+	}
+	return userMessage, nil
+}
+
 // AddMessageWithMetadata 添加带元数据的消息到聊天会话
 func (s *ChatService) AddMessageWithMetadata(chatId uint, role, content string, metadata map[string]interface{}) (*models.Message, error) {
 	// 验证聊天会话是否存在
@@ -114,7 +227,8 @@ func (s *ChatService) AddMessageWithMetadata(chatId uint, role, content string,
 }
 
 // AddMessageWithModelMetadata 添加带有模型元数据的消息
-func (s *ChatService) AddMessageWithModelMetadata(chatId uint, role, content string, modelId uint, metadataJSON string) (*models.Message, error) {
+// parentId为回复对应的用户消息Id，同一用户消息之前的回复会保留为未选中的旧版本
+func (s *ChatService) AddMessageWithModelMetadata(chatId uint, role, content string, modelId uint, parentId uint, metadataJSON string) (*models.Message, error) {
 	// 验证聊天会话是否存在
 	var chat models.Chat
 	if err := database.DB.First(&chat, chatId).Error; err != nil {
@@ -147,12 +261,15 @@ func (s *ChatService) AddMessageWithModelMetadata(chatId uint, role, content str
 		ChatId:    chatId,
 		Role:      role,
 		Content:   content,
+		ModelId:   modelId,
 		Metadata:  string(metadataBytes),
+		ParentId:  parentId,
+		Active:    true,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	if err := database.DB.Create(message).Error; err != nil {
+	if err := s.createBranchMessage(message); err != nil {
 		return nil, err
 	}
 
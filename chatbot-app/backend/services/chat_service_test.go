@@ -0,0 +1,75 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"chatbot-app/backend/database"
+	"chatbot-app/backend/models"
+)
+
+// openTestDB 连接TEST_MYSQL_DSN指定的、已执行过migrations的测试库，未设置时跳过测试
+func openTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("未设置TEST_MYSQL_DSN，跳过需要MySQL的测试")
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("连接MySQL失败: %v", err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+}
+
+func TestAddMessageWithLongMetadata(t *testing.T) {
+	openTestDB(t)
+
+	chat := &models.Chat{Type: "chat", UserId: 1, Title: "元数据测试"}
+	if err := database.DB.Create(chat).Error; err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	t.Cleanup(func() {
+		database.DB.Unscoped().Where("chat_id = ?", chat.Id).Delete(&models.Message{})
+		database.DB.Unscoped().Delete(chat)
+	})
+
+	// 思考过程和过程信息远超过255字节
+	extra := map[string]interface{}{
+		"reasoning_content": strings.Repeat("先分析用户的问题，", 100),
+		"follow_ups":        []string{"还有其他方法吗？", "能举个例子吗？"},
+	}
+	extraJSON, err := json.Marshal(extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := &ChatService{}
+	message, err := service.AddMessageWithModelMetadata(chat.Id, "assistant", "回复", 1, 0, string(extraJSON))
+	if err != nil {
+		t.Fatalf("保存消息失败: %v", err)
+	}
+	if len(message.Metadata) <= 255 {
+		t.Fatalf("元数据长度 = %d, 应超过255字节", len(message.Metadata))
+	}
+
+	var saved models.Message
+	if err := database.DB.First(&saved, message.Id).Error; err != nil {
+		t.Fatalf("读取消息失败: %v", err)
+	}
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(saved.Metadata), &metadata); err != nil {
+		t.Fatalf("保存后的元数据不是合法JSON: %v", err)
+	}
+	if metadata["reasoning_content"] != extra["reasoning_content"] {
+		t.Errorf("思考过程被截断，长度 = %d", len(metadata["reasoning_content"].(string)))
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"chatbot-app/backend/database"
+	"chatbot-app/backend/utils"
+)
+
+// CHAT_STOP_CHANNEL 停止生成通知频道，多实例部署时由处理该会话的实例取消生成
+const CHAT_STOP_CHANNEL = "chat:stop"
+
+// activeStream 进行中的流式回复
+type activeStream struct {
+	cancel context.CancelFunc
+}
+
+// ChatStreamRegistry 记录各会话进行中的流式回复，用于用户主动停止生成
+type ChatStreamRegistry struct {
+	mu      sync.Mutex
+	streams map[uint]*activeStream
+}
+
+var (
+	chatStreamRegistry     *ChatStreamRegistry
+	chatStreamRegistryOnce sync.Once
+)
+
+// GetChatStreamRegistry 获取全局流式回复注册表
+func GetChatStreamRegistry() *ChatStreamRegistry {
+	chatStreamRegistryOnce.Do(func() {
+		chatStreamRegistry = &ChatStreamRegistry{
+			streams: make(map[uint]*activeStream),
+		}
+	})
+	return chatStreamRegistry
+}
+
+// Start 订阅停止生成通知，直到ctx结束
+func (r *ChatStreamRegistry) Start(ctx context.Context) {
+	if database.RedisClient == nil {
+		return
+	}
+
+	pubsub := database.RedisClient.Subscribe(ctx, CHAT_STOP_CHANNEL)
+	go func() {
+		defer pubsub.Close()
+		for msg := range pubsub.Channel() {
+			chatId, err := strconv.ParseUint(msg.Payload, 10, 64)
+			if err != nil {
+				continue
+			}
+			r.cancelLocal(uint(chatId))
+		}
+	}()
+}
+
+// Begin 登记会话的流式回复，返回的ctx在父ctx结束或用户停止生成时结束，回复结束后须调用done
+func (r *ChatStreamRegistry) Begin(parent context.Context, chatId uint) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	stream := &activeStream{cancel: cancel}
+
+	r.mu.Lock()
+	r.streams[chatId] = stream
+	r.mu.Unlock()
+
+	return ctx, func() {
+		cancel()
+		r.mu.Lock()
+		// 同一会话可能已开始新的回复，只移除自己登记的记录
+		if r.streams[chatId] == stream {
+			delete(r.streams, chatId)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Stop 停止会话进行中的流式回复，Redis可用时通知所有实例
+func (r *ChatStreamRegistry) Stop(chatId uint) {
+	if database.RedisClient != nil {
+		payload := strconv.FormatUint(uint64(chatId), 10)
+		err := database.RedisClient.Publish(context.Background(), CHAT_STOP_CHANNEL, payload).Err()
+		if err == nil {
+			return
+		}
+		utils.LogWarn("发布停止生成通知失败，仅停止本实例", map[string]interface{}{
+			"chat_id": chatId,
+			"error":   err.Error(),
+		})
+	}
+	r.cancelLocal(chatId)
+}
+
+// cancelLocal 取消本实例中会话进行中的流式回复
+func (r *ChatStreamRegistry) cancelLocal(chatId uint) {
+	r.mu.Lock()
+	stream, ok := r.streams[chatId]
+	r.mu.Unlock()
+
+	if ok {
+		stream.cancel()
+		utils.LogInfo("已停止生成", map[string]interface{}{
+			"chat_id": chatId,
+		})
+	}
+}
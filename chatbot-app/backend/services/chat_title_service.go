@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"chatbot-app/backend/config"
+	"chatbot-app/backend/database"
+	"chatbot-app/backend/models"
+)
+
+const (
+	// CHAT_DEFAULT_TITLE 创建会话时未提供标题使用的默认标题
+	CHAT_DEFAULT_TITLE = "新对话"
+	// CHAT_TITLE_MAX_LEN 自动生成标题的最大字符数
+	CHAT_TITLE_MAX_LEN = 30
+	// chatTitleContentMaxLen 生成标题时对话内容截取的最大字符数
+	chatTitleContentMaxLen = 500
+)
+
+// chatTitlePrompt 生成标题的提示词
+const chatTitlePrompt = `请为下面的对话生成一个简洁的标题，概括对话主题。
+要求：使用与对话相同的语言；不超过20个字；只输出标题本身，不要加引号、标点或任何解释。
+
+用户：%s
+
+助手：%s`
+
+// ChatTitleService 会话标题自动生成服务
+type ChatTitleService struct {
+	aiService      *AiService
+	aiModelService *AIModelService
+}
+
+// NewChatTitleService 创建会话标题服务
+func NewChatTitleService(aiService *AiService) *ChatTitleService {
+	return &ChatTitleService{
+		aiService:      aiService,
+		aiModelService: &AIModelService{},
+	}
+}
+
+// ShouldGenerate 判断会话是否需要自动生成标题：用户未修改过标题，且当前分支上只有第一条AI回复。
+// 重新生成的旧版本回复和未选中的分支不计入
+func (s *ChatTitleService) ShouldGenerate(chatId uint) bool {
+	var chat models.Chat
+	if err := database.DB.Select("id", "title_edited").First(&chat, chatId).Error; err != nil || chat.TitleEdited {
+		return false
+	}
+
+	var messages []models.Message
+	if err := database.DB.Select("id", "parent_id", "active", "role").
+		Where("chat_id = ?", chatId).
+		Order("id ASC").
+		Find(&messages).Error; err != nil {
+		return false
+	}
+	return countActiveReplies(messages) == 1
+}
+
+// countActiveReplies 统计当前分支上的AI回复数量
+func countActiveReplies(messages []models.Message) int {
+	count := 0
+	for _, message := range newMessageTree(messages).activePath() {
+		if message.Role == "assistant" {
+			count++
+		}
+	}
+	return count
+}
+
+// GenerateTitle 根据首轮对话生成标题并保存，用户在生成期间修改过标题时不覆盖
+// 返回保存后的标题，未保存时返回空字符串
+func (s *ChatTitleService) GenerateTitle(chatId uint, userId uint, question string, answer string) (string, error) {
+	aiModel, err := s.titleModel()
+	if err != nil {
+		return "", err
+	}
+
+	prompt := fmt.Sprintf(chatTitlePrompt, truncateRunes(question, chatTitleContentMaxLen), truncateRunes(answer, chatTitleContentMaxLen))
+
+	// 不关联聊天会话，避免Coze智能体把标题请求写入会话上下文
+	response, _, err := s.aiService.GenerateResponse(aiModel, prompt, nil, userId, 0)
+	if err != nil {
+		return "", err
+	}
+
+	title := cleanChatTitle(response)
+	if title == "" {
+		return "", errors.New("模型未返回有效标题")
+	}
+
+	result := database.DB.Model(&models.Chat{}).
+		Where("id = ? AND title_edited = ?", chatId, false).
+		Update("title", title)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", nil
+	}
+	return title, nil
+}
+
+// titleModel 获取生成标题使用的模型，优先使用AI_TITLE_MODEL配置的模型
+func (s *ChatTitleService) titleModel() (*models.AIModel, error) {
+	if name := config.GetConfig().AI.TitleModel; name != "" {
+		aiModel, err := s.aiModelService.GetModelByName(name)
+		if err != nil {
+			return nil, err
+		}
+		if !aiModel.Enabled {
+			return nil, errors.New("标题生成模型已停用")
+		}
+		return aiModel, nil
+	}
+	return s.aiModelService.GetDefaultModel("chat")
+}
+
+// cleanChatTitle 去掉模型输出中的多余内容，只保留第一行并截断
+func cleanChatTitle(response string) string {
+	title := strings.TrimSpace(response)
+	if index := strings.IndexAny(title, "\r\n"); index >= 0 {
+		title = title[:index]
+	}
+	title = strings.TrimPrefix(title, "标题：")
+	title = strings.TrimPrefix(title, "标题:")
+	title = strings.Trim(title, " \t\"'“”‘’《》「」#*。.")
+	return truncateRunes(title, CHAT_TITLE_MAX_LEN)
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+
+	"chatbot-app/backend/models"
+)
+
+func TestCountActiveReplies(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []models.Message
+		count    int
+	}{
+		{
+			name:     "没有消息",
+			messages: nil,
+			count:    0,
+		},
+		{
+			name: "首轮对话",
+			messages: []models.Message{
+				{Id: 1, Role: "user", Active: true},
+				{Id: 2, ParentId: 1, Role: "assistant", Active: true},
+			},
+			count: 1,
+		},
+		{
+			name: "重新生成首条回复",
+			messages: []models.Message{
+				{Id: 1, Role: "user", Active: true},
+				{Id: 2, ParentId: 1, Role: "assistant", Active: false},
+				{Id: 3, ParentId: 1, Role: "assistant", Active: true},
+			},
+			count: 1,
+		},
+		{
+			name: "编辑首条消息后的新分支",
+			messages: []models.Message{
+				{Id: 1, Role: "user", Active: false},
+				{Id: 2, ParentId: 1, Role: "assistant", Active: true},
+				{Id: 3, ParentId: 2, Role: "user", Active: true},
+				{Id: 4, ParentId: 3, Role: "assistant", Active: true},
+				{Id: 5, Role: "user", Active: true},
+				{Id: 6, ParentId: 5, Role: "assistant", Active: true},
+			},
+			count: 1,
+		},
+		{
+			name: "第二轮对话",
+			messages: []models.Message{
+				{Id: 1, Role: "user", Active: true},
+				{Id: 2, ParentId: 1, Role: "assistant", Active: true},
+				{Id: 3, ParentId: 2, Role: "user", Active: true},
+				{Id: 4, ParentId: 3, Role: "assistant", Active: true},
+			},
+			count: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if count := countActiveReplies(tt.messages); count != tt.count {
+				t.Errorf("回复数量 = %d, 期望 %d", count, tt.count)
+			}
+		})
+	}
+}
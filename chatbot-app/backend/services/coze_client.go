@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+
+	"chatbot-app/backend/models"
+	"chatbot-app/backend/utils"
+	"chatbot-app/backend/utils/coze"
+)
+
+func init() {
+	// Coze客户端依赖会话映射、工作流参数和本地工具等业务服务，注册到utils的客户端工厂
+	utils.RegisterClientProvider(utils.ProviderCoze, NewCozeClient)
+}
+
+// CozeClient Coze智能体和工作流客户端，实现utils.AIClient接口
+type CozeClient struct {
+	cozeService *CozeService
+}
+
+// NewCozeClient 根据模型配置创建Coze客户端
+func NewCozeClient(aiModel *models.AIModel) (utils.AIClient, error) {
+	cozeService, err := NewCozeService(aiModel)
+	if err != nil {
+		return nil, fmt.Errorf("创建Coze服务失败: %v", err)
+	}
+	return &CozeClient{cozeService: cozeService}, nil
+}
+
+// GenerateResponse 生成回复（非流式）
+func (c *CozeClient) GenerateResponse(req *utils.GenerateRequest) (string, *utils.TokenUsage, error) {
+	result, err := c.cozeService.GenerateResponse(req.ChatId, req.Prompt, toModelMessages(req.History), req.UserId, toRequestMeta(req))
+	if err != nil {
+		return "", nil, err
+	}
+	return result.Content, toTokenUsage(&result.Usage), nil
+}
+
+// GenerateStreamResponse 生成流式回复
+func (c *CozeClient) GenerateStreamResponse(req *utils.GenerateRequest, callback func(chunk string, isEnd bool, err error) bool) (*utils.TokenUsage, error) {
+	usage, err := c.cozeService.GenerateStreamResponse(req.ChatId, req.Prompt, toModelMessages(req.History), req.UserId, toRequestMeta(req), callback)
+	return toTokenUsage(usage), err
+}
+
+// toModelMessages 转换历史消息格式为Coze服务使用的消息
+func toModelMessages(history []utils.Message) []*models.Message {
+	messages := make([]*models.Message, 0, len(history))
+	for _, msg := range history {
+		messages = append(messages, &models.Message{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+	return messages
+}
+
+// toRequestMeta 提取生成请求中的附加信息
+func toRequestMeta(req *utils.GenerateRequest) *RequestMeta {
+	return &RequestMeta{
+		ClientIP:   req.ClientIP,
+		FormFields: req.FormFields,
+		Files:      req.Files,
+		OnEvent:    req.OnEvent,
+		Context:    req.Context,
+		Fork:       req.Fork,
+	}
+}
+
+// toTokenUsage 转换Coze统计的Token用量，未统计时返回nil
+func toTokenUsage(usage *coze.ChatUsage) *utils.TokenUsage {
+	if usage == nil || (usage.InputCount == 0 && usage.OutputCount == 0) {
+		return nil
+	}
+	return &utils.TokenUsage{
+		PromptTokens:     usage.InputCount,
+		CompletionTokens: usage.OutputCount,
+	}
+}
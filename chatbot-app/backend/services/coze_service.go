@@ -1,9 +1,18 @@
 package services
 
 import (
+	"chatbot-app/backend/database"
 	"chatbot-app/backend/models"
+	"chatbot-app/backend/utils"
 	"chatbot-app/backend/utils/coze"
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CozeService Coze智能体服务
@@ -40,76 +49,89 @@ func NewCozeService(aiModel *models.AIModel) (*CozeService, error) {
 	}, nil
 }
 
-// GenerateResponse 生成回复（非流式）
-func (s *CozeService) GenerateResponse(message string, history []*models.Message) (string, error) {
+// GenerateResponse 生成回复（非流式），返回回复内容和Token用量
+func (s *CozeService) GenerateResponse(chatID uint, message string, history []*models.Message, userID uint, meta *RequestMeta) (*coze.ChatResult, error) {
 	// 根据模型配置判断使用工作流模式还是对话模式
 	if s.aiModel != nil && s.aiModel.Class == "workflow" && s.aiModel.ClassId != "" {
-		workflowResp, err := s.client.RunWorkflow(message)
+		parameters, err := s.buildWorkflowParameters(newWorkflowParamContext(chatID, message, userID, history, meta))
+		if err != nil {
+			return nil, err
+		}
+		workflowResp, err := s.client.RunWorkflow(parameters)
 		if err != nil {
-			return "", fmt.Errorf("执行Coze工作流失败: %v", err)
+			return nil, fmt.Errorf("执行Coze工作流失败: %v", err)
 		}
 
-		// 从工作流响应中提取结果
-		if workflowResp != nil {
-			// 这里需要根据实际的coze-go库API来处理响应
-			// 暂时返回一个简单的成功消息
-			return fmt.Sprintf("Coze工作流执行成功，响应ID: %s", workflowResp.Data), nil
+		result := &coze.ChatResult{
+			Content: coze.ParseWorkflowOutput(workflowResp.Data),
 		}
-		return "工作流执行完成，但未返回有效结果", nil
+		if workflowResp.Usage != nil {
+			result.Usage = coze.ChatUsage{
+				InputCount:  workflowResp.Usage.InputCount,
+				OutputCount: workflowResp.Usage.OutputCount,
+				TokenCount:  workflowResp.Usage.TokenCount,
+			}
+		} else {
+			result.Usage.TokenCount = workflowResp.Token
+		}
+		return result, nil
 	}
 
-	// 使用对话模式（暂不支持非流式）
-	return "", fmt.Errorf("Coze非流式对话暂未实现，请使用流式模式")
-}
+	// 复用聊天会话对应的Coze会话
+	conversationID, isNew, err := s.getOrCreateConversation(chatID, userID, meta != nil && meta.Fork)
+	if err != nil {
+		return nil, err
+	}
 
-// GenerateStreamResponse 生成流式回复
-func (s *CozeService) GenerateStreamResponse(message string, history []*models.Message, userID uint, callback func(chunk string, isEnd bool, err error) bool) error {
-	// 创建会话
-	conversationID, err := s.client.CreateConversation()
+	result, err := s.client.SendMessageAndWait(
+		conversationID,
+		userID,
+		buildBotMessageList(message, history, isNew, meta),
+		func(toolCalls []*coze.ToolCall) []*coze.ToolOutput {
+			return s.executeToolCalls(chatID, userID, toolCalls)
+		},
+	)
 	if err != nil {
-		return fmt.Errorf("创建Coze会话失败: %v", err)
+		return nil, fmt.Errorf("Coze对话失败: %v", err)
 	}
+	return result, nil
+}
+
+// GenerateStreamResponse 生成流式回复，返回Coze统计的Token用量，未返回用量时为nil
+func (s *CozeService) GenerateStreamResponse(chatID uint, message string, history []*models.Message, userID uint, meta *RequestMeta, callback func(chunk string, isEnd bool, err error) bool) (*coze.ChatUsage, error) {
+	var usage *coze.ChatUsage
 
 	// 根据模型配置判断使用工作流模式还是对话模式
 	if s.aiModel != nil && s.aiModel.Class == "workflow" && s.aiModel.ClassId != "" {
-		var workflowEnded bool // 添加标志防止重复结束
-		return s.client.RunWorkflowStream(message, func(eventType string, data interface{}) {
-			switch eventType {
-			case "message_delta":
-				if dataMap, ok := data.(map[string]string); ok {
-					if content, exists := dataMap["content"]; exists {
-						if !callback(content, false, nil) {
-							return
-						}
-					}
-				}
-			case "workflow_complated", "workflow_end":
-				// 防止重复结束回调
-				if !workflowEnded {
-					workflowEnded = true
-					callback("", true, nil)
-				}
-			case "workflow_error":
-				if !workflowEnded {
-					workflowEnded = true
-					if dataMap, ok := data.(map[string]string); ok {
-						if errorContent, exists := dataMap["content"]; exists {
-							callback("", false, fmt.Errorf("工作流错误: %s", errorContent))
-							return
-						}
-					}
-					callback("", false, fmt.Errorf("工作流执行失败"))
-				}
-			}
-		})
+		parameters, err := s.buildWorkflowParameters(newWorkflowParamContext(chatID, message, userID, history, meta))
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithCancel(meta.context())
+		defer cancel()
+		err = s.client.RunWorkflowStream(ctx, parameters, s.workflowEventHandler(meta, cancel, callback, func(u *coze.ChatUsage) {
+			usage = u
+		}))
+		return usage, err
 	}
 
-	// 使用对话流式模式
+	// 复用聊天会话对应的Coze会话，Coze侧会保留记忆和变量
+	conversationID, isNew, err := s.getOrCreateConversation(chatID, userID, meta != nil && meta.Fork)
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用对话流式模式，回调要求停止或请求结束时取消Coze侧的对话
+	ctx, cancel := context.WithCancel(meta.context())
+	defer cancel()
+
 	var conversationEnded bool // 添加标志防止重复结束
-	return s.client.SendMessageStreamWithCallback(
+	err = s.client.SendMessageStreamWithCallback(
+		ctx,
 		conversationID,
 		userID,
-		history,
+		buildBotMessageList(message, history, isNew, meta),
 		func(eventType string, data interface{}) {
 			switch eventType {
 			case "message_delta":
@@ -117,12 +139,20 @@ func (s *CozeService) GenerateStreamResponse(message string, history []*models.M
 					if content, exists := dataMap["content"]; exists {
 						if contentStr, ok := content.(string); ok {
 							if !callback(contentStr, false, nil) {
+								cancel()
 								return
 							}
 						}
 					}
 				}
+			case "reasoning_delta", "follow_up", "verbose":
+				forwardChatEvent(meta, eventType, data)
 			case "chat_completed", "conversation_end":
+				if dataMap, ok := data.(map[string]interface{}); ok {
+					if usageMap, ok := dataMap["usage"].(map[string]interface{}); ok {
+						usage = parseChatUsage(usageMap)
+					}
+				}
 				// 防止重复结束回调
 				if !conversationEnded {
 					conversationEnded = true
@@ -141,12 +171,227 @@ func (s *CozeService) GenerateStreamResponse(message string, history []*models.M
 				}
 			}
 		},
+		func(toolCalls []*coze.ToolCall) []*coze.ToolOutput {
+			return s.executeToolCalls(chatID, userID, toolCalls)
+		},
 	)
+	return usage, err
+}
+
+// forwardChatEvent 将智能体的推理过程、推荐问题和过程信息通过meta.OnEvent通知调用方
+// reasoning、follow_up事件的数据为文本，verbose事件的数据为*models.MessageTrace
+func forwardChatEvent(meta *RequestMeta, eventType string, data interface{}) {
+	if meta == nil || meta.OnEvent == nil {
+		return
+	}
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return
+	}
+	content, _ := dataMap["content"].(string)
+
+	switch eventType {
+	case "reasoning_delta":
+		meta.OnEvent("reasoning", content)
+	case "follow_up":
+		meta.OnEvent("follow_up", content)
+	case "verbose":
+		traceType, _ := dataMap["type"].(string)
+		meta.OnEvent("verbose", &models.MessageTrace{
+			Type:    traceType,
+			Content: content,
+		})
+	}
+}
+
+// parseChatUsage 解析对话完成事件中的Token用量
+func parseChatUsage(usageMap map[string]interface{}) *coze.ChatUsage {
+	usage := &coze.ChatUsage{}
+	usage.InputCount, _ = usageMap["input_count"].(int)
+	usage.OutputCount, _ = usageMap["output_count"].(int)
+	usage.TokenCount, _ = usageMap["token_count"].(int)
+	return usage
+}
+
+// buildBotMessageList 构造发送给智能体的消息列表
+// 已有Coze会话时只发送本轮用户消息，新会话时带上本地历史作为上下文
+func buildBotMessageList(message string, history []*models.Message, isNew bool, meta *RequestMeta) []*models.Message {
+	messageList := []*models.Message{}
+	if isNew {
+		messageList = append(messageList, history...)
+	}
+	userMessage := &models.Message{
+		Role:    "user",
+		Content: message,
+	}
+	if meta != nil {
+		userMessage.Files = meta.Files
+	}
+	return append(messageList, userMessage)
+}
+
+// workflowEventHandler 将工作流流式事件转换为回调，中断事件通过meta.OnEvent通知调用方
+// 回调要求停止时调用cancel结束流式输出，收到Token用量时调用onUsage
+func (s *CozeService) workflowEventHandler(meta *RequestMeta, cancel context.CancelFunc, callback func(chunk string, isEnd bool, err error) bool, onUsage func(usage *coze.ChatUsage)) func(eventType string, data interface{}) {
+	var workflowEnded bool // 添加标志防止重复结束
+	return func(eventType string, data interface{}) {
+		switch eventType {
+		case "message_delta":
+			if dataMap, ok := data.(map[string]string); ok {
+				if content, exists := dataMap["content"]; exists {
+					if !callback(content, false, nil) {
+						cancel()
+						return
+					}
+				}
+			}
+		case "workflow_complated", "workflow_end":
+			// 防止重复结束回调
+			if !workflowEnded {
+				workflowEnded = true
+				callback("", true, nil)
+			}
+		case "workflow_error":
+			if !workflowEnded {
+				workflowEnded = true
+				if dataMap, ok := data.(map[string]string); ok {
+					if errorContent, exists := dataMap["content"]; exists {
+						callback("", false, fmt.Errorf("工作流错误: %s", errorContent))
+						return
+					}
+				}
+				callback("", false, fmt.Errorf("工作流执行失败"))
+			}
+		case "usage":
+			if usage, ok := data.(*coze.ChatUsage); ok {
+				onUsage(usage)
+			}
+		case "workflow_interrupt":
+			// 工作流等待用户输入，通知调用方保存中断以便恢复
+			if interrupt, ok := data.(*coze.WorkflowInterrupt); ok && meta != nil && meta.OnEvent != nil {
+				interrupt.WorkflowID = s.GetWorkflowID()
+				meta.OnEvent(eventType, interrupt)
+			}
+		}
+	}
+}
+
+// ResumeWorkflowStream 以用户的回答恢复中断的工作流，继续流式输出，返回Coze统计的Token用量
+func (s *CozeService) ResumeWorkflowStream(interrupt *coze.WorkflowInterrupt, answer string, meta *RequestMeta, callback func(chunk string, isEnd bool, err error) bool) (*coze.ChatUsage, error) {
+	ctx, cancel := context.WithCancel(meta.context())
+	defer cancel()
+
+	var usage *coze.ChatUsage
+	err := s.client.ResumeWorkflowStream(ctx, interrupt, answer, s.workflowEventHandler(meta, cancel, callback, func(u *coze.ChatUsage) {
+		usage = u
+	}))
+	return usage, err
+}
+
+// RunWorkflowAsync 异步执行工作流，返回执行Id和实际提交的输入参数
+func (s *CozeService) RunWorkflowAsync(chatID uint, message string, userID uint, meta *RequestMeta) (string, map[string]interface{}, error) {
+	if !s.IsWorkflowMode() {
+		return "", nil, errors.New("当前模型不是工作流")
+	}
+
+	// 异步执行不关联对话记录，{{history}}占位符渲染为空
+	parameters, err := s.buildWorkflowParameters(newWorkflowParamContext(chatID, message, userID, nil, meta))
+	if err != nil {
+		return "", nil, err
+	}
+
+	executeID, err := s.client.RunWorkflowAsync(parameters)
+	if err != nil {
+		return "", nil, err
+	}
+	return executeID, parameters, nil
+}
+
+// GetWorkflowRunResult 查询异步执行的工作流结果
+func (s *CozeService) GetWorkflowRunResult(workflowID string, executeID string) (*coze.WorkflowRunResult, error) {
+	return s.client.GetWorkflowRunResult(workflowID, executeID)
+}
+
+// UploadFile 上传本地文件到Coze，返回Coze文件Id
+func (s *CozeService) UploadFile(filePath string, fileName string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	return s.client.UploadWithName(file, fileName)
 }
 
 // GetConversationID 创建新的会话ID
 func (s *CozeService) GetConversationID() (string, error) {
-	return s.client.CreateConversation()
+	return s.client.CreateConversation(nil)
+}
+
+// getOrCreateConversation 获取聊天会话对应的Coze会话Id，不存在时创建并保存
+// reset为true时总是新建Coze会话并替换原有映射，用于对话分叉后Coze侧上下文已与当前分支不一致的情况
+// 返回的isNew表示是否为新创建的Coze会话
+func (s *CozeService) getOrCreateConversation(chatID uint, userID uint, reset bool) (string, bool, error) {
+	botID := s.GetBotID()
+
+	if chatID != 0 && !reset {
+		var mapping models.CozeConversation
+		err := database.DB.Where("chat_id = ? AND bot_id = ?", chatID, botID).First(&mapping).Error
+		if err == nil {
+			return mapping.ConversationId, false, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", false, fmt.Errorf("查询Coze会话失败: %v", err)
+		}
+	}
+
+	conversationID, err := s.client.CreateConversation(map[string]string{
+		"user_id": strconv.FormatUint(uint64(userID), 10),
+		"chat_id": strconv.FormatUint(uint64(chatID), 10),
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("创建Coze会话失败: %v", err)
+	}
+
+	if chatID != 0 {
+		mapping := &models.CozeConversation{
+			ChatId:         chatID,
+			BotId:          botID,
+			ConversationId: conversationID,
+		}
+		if reset {
+			// 分叉后以新会话为准
+			err := database.DB.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "chat_id"}, {Name: "bot_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"conversation_id", "updated_at"}),
+			}).Create(mapping).Error
+			if err != nil {
+				utils.LogError("保存Coze会话映射失败", err, map[string]interface{}{
+					"chat_id":         chatID,
+					"bot_id":          botID,
+					"conversation_id": conversationID,
+				})
+			}
+			return conversationID, true, nil
+		}
+
+		// 并发请求可能同时创建，以先写入的为准
+		result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(mapping)
+		if result.Error != nil {
+			utils.LogError("保存Coze会话映射失败", result.Error, map[string]interface{}{
+				"chat_id":         chatID,
+				"bot_id":          botID,
+				"conversation_id": conversationID,
+			})
+		} else if result.RowsAffected == 0 {
+			var existing models.CozeConversation
+			if err := database.DB.Where("chat_id = ? AND bot_id = ?", chatID, botID).First(&existing).Error; err == nil {
+				return existing.ConversationId, false, nil
+			}
+		}
+	}
+
+	return conversationID, true, nil
 }
 
 // IsWorkflowMode 检查是否为工作流模式
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"chatbot-app/backend/database"
+	"chatbot-app/backend/models"
+	"chatbot-app/backend/utils"
+	"chatbot-app/backend/utils/coze"
+)
+
+// 同步时模型显示名称的最大长度，与ai_model.display_name字段长度一致
+const COZE_SYNC_DISPLAY_NAME_MAX_LEN = 100
+
+// CozeSyncService 将Coze工作空间中的智能体、工作流同步到ai_model表
+type CozeSyncService struct{}
+
+// CozeSyncResult 同步结果
+type CozeSyncResult struct {
+	Created  []string `json:"created"`  // 新增的模型名称
+	Updated  []string `json:"updated"`  // 名称或描述有变化的模型名称
+	Disabled []string `json:"disabled"` // 上游已删除而被停用的模型名称
+	Skipped  []string `json:"skipped"`  // 管理员已删除而不再创建的模型名称
+}
+
+// Sync 拉取工作空间中已发布的智能体和工作流并同步到ai_model表
+// 新对象创建为启用状态；已有模型只更新显示名称和描述，不改动管理员设置的其他参数；
+// 上游已不存在的同步创建的模型会被停用，重新发布后需由管理员手动启用；管理员删除的同步模型不会重新创建
+func (s *CozeSyncService) Sync() (*CozeSyncResult, error) {
+	client, err := coze.New()
+	if err != nil {
+		return nil, fmt.Errorf("初始化Coze客户端失败: %v", err)
+	}
+
+	// 任意一类拉取失败都直接返回，避免把拉取失败误判为上游已删除
+	bots, err := client.ListPublishedBots()
+	if err != nil {
+		return nil, err
+	}
+	workflows, err := client.ListPublishedWorkflows()
+	if err != nil {
+		return nil, err
+	}
+	upstream := map[string][]*coze.SpaceObject{
+		"bot":      bots,
+		"workflow": workflows,
+	}
+
+	// 包含已删除的模型：名称有唯一索引，管理员删除的同步模型再次创建会冲突
+	var existingList []models.AIModel
+	if err := database.DB.Unscoped().Where("provider = ? AND class IN ?", "coze", []string{"bot", "workflow"}).
+		Find(&existingList).Error; err != nil {
+		return nil, fmt.Errorf("查询Coze模型失败: %v", err)
+	}
+	existing := make(map[string]*models.AIModel, len(existingList))
+	deleted := make(map[string]bool)
+	for i := range existingList {
+		aiModel := &existingList[i]
+		if aiModel.DeletedAt.Valid {
+			deleted[aiModel.Name] = true
+			continue
+		}
+		existing[cozeSyncKey(aiModel.Class, aiModel.ClassId)] = aiModel
+	}
+
+	result := &CozeSyncResult{Created: []string{}, Updated: []string{}, Disabled: []string{}, Skipped: []string{}}
+	seen := make(map[string]bool)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for class, objectList := range upstream {
+			for _, object := range objectList {
+				key := cozeSyncKey(class, object.ID)
+				seen[key] = true
+				displayName := truncateRunes(object.Name, COZE_SYNC_DISPLAY_NAME_MAX_LEN)
+
+				aiModel, ok := existing[key]
+				if !ok {
+					// 管理员删除过的同步模型视为不再需要，不恢复也不重新创建
+					if name := cozeSyncModelName(class, object.ID); deleted[name] {
+						result.Skipped = append(result.Skipped, name)
+						continue
+					}
+					aiModel = &models.AIModel{
+						Name:        cozeSyncModelName(class, object.ID),
+						DisplayName: displayName,
+						Provider:    "coze",
+						Type:        "chat",
+						URL:         client.Config.APIURL,
+						Enabled:     true,
+						Description: object.Description,
+						Class:       class,
+						ClassId:     object.ID,
+					}
+					if err := tx.Create(aiModel).Error; err != nil {
+						return fmt.Errorf("创建模型%s失败: %v", aiModel.Name, err)
+					}
+					result.Created = append(result.Created, aiModel.Name)
+					continue
+				}
+
+				if aiModel.DisplayName == displayName && aiModel.Description == object.Description {
+					continue
+				}
+				if err := tx.Model(aiModel).Updates(map[string]interface{}{
+					"display_name": displayName,
+					"description":  object.Description,
+				}).Error; err != nil {
+					return fmt.Errorf("更新模型%s失败: %v", aiModel.Name, err)
+				}
+				result.Updated = append(result.Updated, aiModel.Name)
+			}
+		}
+
+		// 只停用同步创建的模型，管理员手动添加的模型（如对话流、其他空间的智能体）不在同步范围内
+		for key, aiModel := range existing {
+			if seen[key] || !aiModel.Enabled || aiModel.Name != cozeSyncModelName(aiModel.Class, aiModel.ClassId) {
+				continue
+			}
+			if err := tx.Model(aiModel).Update("enabled", false).Error; err != nil {
+				return fmt.Errorf("停用模型%s失败: %v", aiModel.Name, err)
+			}
+			result.Disabled = append(result.Disabled, aiModel.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Created)+len(result.Updated)+len(result.Disabled) > 0 {
+		GetModelRegistry().Invalidate(0)
+	}
+
+	utils.LogInfo("Coze模型同步完成", map[string]interface{}{
+		"bots":      len(bots),
+		"workflows": len(workflows),
+		"created":   result.Created,
+		"updated":   result.Updated,
+		"disabled":  result.Disabled,
+		"skipped":   result.Skipped,
+	})
+	return result, nil
+}
+
+// cozeSyncModelName 同步创建的模型名称
+func cozeSyncModelName(class string, classId string) string {
+	return fmt.Sprintf("coze-%s-%s", class, classId)
+}
+
+// cozeSyncKey 按大分类和Coze对象Id定位模型
+func cozeSyncKey(class string, classId string) string {
+	return class + ":" + classId
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
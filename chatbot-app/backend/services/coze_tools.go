@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"chatbot-app/backend/utils"
+	"chatbot-app/backend/utils/coze"
+)
+
+// COZE_TOOL_TIMEOUT 单个本地工具的执行超时时间
+const COZE_TOOL_TIMEOUT = 30 * time.Second
+
+// CozeToolCall 智能体发起的一次本地工具调用
+type CozeToolCall struct {
+	Name      string // 工具名称，与Coze中配置的端插件方法名一致
+	Arguments string // 调用参数(JSON)
+	UserId    uint   // 当前用户
+	ChatId    uint   // 当前聊天会话
+}
+
+// CozeToolHandler 本地工具处理函数，返回的字符串作为工具输出提交给Coze
+type CozeToolHandler func(ctx context.Context, call *CozeToolCall) (string, error)
+
+var (
+	cozeTools   = make(map[string]CozeToolHandler)
+	cozeToolsMu sync.RWMutex
+)
+
+// RegisterCozeTool 注册本地工具，同名工具会被覆盖
+func RegisterCozeTool(name string, handler CozeToolHandler) {
+	cozeToolsMu.Lock()
+	defer cozeToolsMu.Unlock()
+	cozeTools[name] = handler
+}
+
+// getCozeTool 获取已注册的本地工具
+func getCozeTool(name string) (CozeToolHandler, bool) {
+	cozeToolsMu.RLock()
+	defer cozeToolsMu.RUnlock()
+	handler, ok := cozeTools[name]
+	return handler, ok
+}
+
+func init() {
+	// 内置工具：获取服务器当前时间
+	RegisterCozeTool("get_current_time", func(ctx context.Context, call *CozeToolCall) (string, error) {
+		now := time.Now()
+		data, err := json.Marshal(map[string]interface{}{
+			"datetime":  now.Format("2006-01-02 15:04:05"),
+			"timezone":  now.Location().String(),
+			"timestamp": now.Unix(),
+		})
+		return string(data), err
+	})
+}
+
+// toolErrorOutput 工具执行失败时返回给智能体的输出
+func toolErrorOutput(msg string) string {
+	data, _ := json.Marshal(map[string]string{"error": msg})
+	return string(data)
+}
+
+// executeToolCalls 执行智能体要求的本地工具调用
+// 每个调用都会返回输出，失败时以错误信息作为输出，避免对话一直等待
+func (s *CozeService) executeToolCalls(chatID uint, userID uint, toolCalls []*coze.ToolCall) []*coze.ToolOutput {
+	outputs := make([]*coze.ToolOutput, 0, len(toolCalls))
+	for _, toolCall := range toolCalls {
+		output := s.executeToolCall(&CozeToolCall{
+			Name:      toolCall.Name,
+			Arguments: toolCall.Arguments,
+			UserId:    userID,
+			ChatId:    chatID,
+		})
+		outputs = append(outputs, &coze.ToolOutput{
+			ToolCallID: toolCall.ID,
+			Output:     output,
+		})
+	}
+	return outputs
+}
+
+// executeToolCall 执行单个本地工具调用
+func (s *CozeService) executeToolCall(call *CozeToolCall) (output string) {
+	handler, ok := getCozeTool(call.Name)
+	if !ok {
+		utils.LogWarn("未注册的Coze工具", map[string]interface{}{
+			"tool":    call.Name,
+			"chat_id": call.ChatId,
+		})
+		return toolErrorOutput(fmt.Sprintf("未知的工具: %s", call.Name))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			utils.LogError("执行Coze工具异常", fmt.Errorf("%v", r), map[string]interface{}{
+				"tool": call.Name,
+			})
+			output = toolErrorOutput("工具执行异常")
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), COZE_TOOL_TIMEOUT)
+	defer cancel()
+
+	startTime := time.Now()
+	result, err := handler(ctx, call)
+	if err != nil {
+		utils.LogError("执行Coze工具失败", err, map[string]interface{}{
+			"tool":      call.Name,
+			"chat_id":   call.ChatId,
+			"arguments": call.Arguments,
+		})
+		return toolErrorOutput(err.Error())
+	}
+
+	utils.LogInfo("执行Coze工具完成", map[string]interface{}{
+		"tool":     call.Name,
+		"chat_id":  call.ChatId,
+		"duration": time.Since(startTime).Milliseconds(),
+	})
+	return result
+}
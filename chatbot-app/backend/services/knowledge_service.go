@@ -0,0 +1,168 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"chatbot-app/backend/utils"
+	"chatbot-app/backend/utils/coze"
+)
+
+const (
+	// KNOWLEDGE_MAX_FILE_SIZE 知识库单个文档大小上限
+	KNOWLEDGE_MAX_FILE_SIZE = 20 << 20
+	// KNOWLEDGE_POLL_INTERVAL 文档处理进度轮询间隔
+	KNOWLEDGE_POLL_INTERVAL = 5 * time.Second
+	// KNOWLEDGE_POLL_TIMEOUT 文档处理进度轮询超时时间
+	KNOWLEDGE_POLL_TIMEOUT = 10 * time.Minute
+)
+
+// KnowledgeService Coze知识库管理服务
+type KnowledgeService struct{}
+
+// client 创建Coze客户端
+func (s *KnowledgeService) client() (*coze.Client, error) {
+	client, err := coze.New()
+	if err != nil {
+		return nil, fmt.Errorf("初始化Coze客户端失败: %v", err)
+	}
+	return client, nil
+}
+
+// CreateKnowledge 创建知识库
+func (s *KnowledgeService) CreateKnowledge(name string, description string, formatType int) (string, error) {
+	if formatType != coze.KNOWLEDGE_FORMAT_DOCUMENT && formatType != coze.KNOWLEDGE_FORMAT_SPREADSHEET && formatType != coze.KNOWLEDGE_FORMAT_IMAGE {
+		return "", errors.New("不支持的知识库类型")
+	}
+
+	client, err := s.client()
+	if err != nil {
+		return "", err
+	}
+	return client.CreateKnowledge(name, description, formatType)
+}
+
+// ListKnowledge 分页查询知识库
+func (s *KnowledgeService) ListKnowledge(name string, page int, size int) ([]*coze.Knowledge, int, error) {
+	client, err := s.client()
+	if err != nil {
+		return nil, 0, err
+	}
+	return client.ListKnowledge(name, page, size)
+}
+
+// DeleteKnowledge 删除知识库
+func (s *KnowledgeService) DeleteKnowledge(knowledgeID string) error {
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+	return client.DeleteKnowledge(knowledgeID)
+}
+
+// UploadDocument 上传文档到知识库，并在后台轮询处理进度
+func (s *KnowledgeService) UploadDocument(knowledgeID string, formatType int, fileName string, fileSize int64, file io.Reader) (*coze.KnowledgeDocument, error) {
+	if fileSize > KNOWLEDGE_MAX_FILE_SIZE {
+		return nil, fmt.Errorf("文件大小不能超过%dMB", KNOWLEDGE_MAX_FILE_SIZE>>20)
+	}
+
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := client.UploadDocument(knowledgeID, formatType, fileName, file)
+	if err != nil {
+		return nil, err
+	}
+
+	utils.LogInfo("知识库文档已上传", map[string]interface{}{
+		"knowledge_id": knowledgeID,
+		"document_id":  document.ID,
+		"name":         fileName,
+	})
+
+	if document.Status == coze.DOCUMENT_STATUS_PROCESSING {
+		go s.watchDocument(knowledgeID, document.ID)
+	}
+	return document, nil
+}
+
+// watchDocument 轮询文档处理进度直到完成、失败或超时
+func (s *KnowledgeService) watchDocument(knowledgeID string, documentID string) {
+	deadline := time.Now().Add(KNOWLEDGE_POLL_TIMEOUT)
+	for time.Now().Before(deadline) {
+		time.Sleep(KNOWLEDGE_POLL_INTERVAL)
+
+		progressList, err := s.GetDocumentProgress(knowledgeID, []string{documentID})
+		if err != nil {
+			utils.LogWarn("查询知识库文档处理进度失败", map[string]interface{}{
+				"knowledge_id": knowledgeID,
+				"document_id":  documentID,
+				"error":        err.Error(),
+			})
+			continue
+		}
+		if len(progressList) == 0 {
+			continue
+		}
+
+		progress := progressList[0]
+		switch progress.Status {
+		case coze.DOCUMENT_STATUS_COMPLETED:
+			utils.LogInfo("知识库文档处理完成", map[string]interface{}{
+				"knowledge_id": knowledgeID,
+				"document_id":  documentID,
+			})
+			return
+		case coze.DOCUMENT_STATUS_FAILED:
+			utils.LogError("知识库文档处理失败", errors.New(progress.StatusDescript), map[string]interface{}{
+				"knowledge_id": knowledgeID,
+				"document_id":  documentID,
+			})
+			return
+		}
+	}
+
+	utils.LogWarn("知识库文档处理超时", map[string]interface{}{
+		"knowledge_id": knowledgeID,
+		"document_id":  documentID,
+	})
+}
+
+// ListDocuments 分页查询知识库文档
+func (s *KnowledgeService) ListDocuments(knowledgeID string, page int, size int) ([]*coze.KnowledgeDocument, int, error) {
+	client, err := s.client()
+	if err != nil {
+		return nil, 0, err
+	}
+	return client.ListDocuments(knowledgeID, page, size)
+}
+
+// DeleteDocuments 删除知识库文档
+func (s *KnowledgeService) DeleteDocuments(documentIDs []string) error {
+	if len(documentIDs) == 0 {
+		return errors.New("请选择要删除的文档")
+	}
+
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+	return client.DeleteDocuments(documentIDs)
+}
+
+// GetDocumentProgress 查询文档处理进度
+func (s *KnowledgeService) GetDocumentProgress(knowledgeID string, documentIDs []string) ([]*coze.DocumentProgress, error) {
+	if len(documentIDs) == 0 {
+		return nil, errors.New("请指定文档Id")
+	}
+
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+	return client.GetDocumentProgress(knowledgeID, documentIDs)
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"chatbot-app/backend/database"
+	"chatbot-app/backend/models"
+	"chatbot-app/backend/utils"
+)
+
+const (
+	// MODEL_REGISTRY_CACHE_KEY Redis中缓存的模型列表
+	MODEL_REGISTRY_CACHE_KEY = "ai_model:registry"
+	// MODEL_REGISTRY_CHANNEL 模型变更通知频道
+	MODEL_REGISTRY_CHANNEL = "ai_model:changed"
+	// MODEL_REGISTRY_CACHE_TTL Redis缓存有效期
+	MODEL_REGISTRY_CACHE_TTL = 10 * time.Minute
+	// MODEL_REGISTRY_REFRESH_INTERVAL 兜底刷新间隔，防止丢失变更通知
+	MODEL_REGISTRY_REFRESH_INTERVAL = time.Minute
+)
+
+// ModelRegistry 进程内模型注册表
+// 模型配置缓存在内存中，通过Redis发布订阅在多个实例间同步失效
+type ModelRegistry struct {
+	mu        sync.RWMutex
+	modelMap  map[uint]*models.AIModel
+	loaded    bool
+	listeners []func()
+}
+
+var (
+	modelRegistry     *ModelRegistry
+	modelRegistryOnce sync.Once
+)
+
+// GetModelRegistry 获取全局模型注册表
+func GetModelRegistry() *ModelRegistry {
+	modelRegistryOnce.Do(func() {
+		modelRegistry = &ModelRegistry{
+			modelMap: make(map[uint]*models.AIModel),
+		}
+	})
+	return modelRegistry
+}
+
+// Start 同步已生效的价格后加载模型，并订阅变更通知，直到ctx结束
+func (r *ModelRegistry) Start(ctx context.Context) {
+	if err := (&AIModelService{}).syncEffectivePrices(); err != nil {
+		utils.LogWarn("同步模型生效价格失败", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if err := r.Reload(); err != nil {
+		utils.LogError("加载模型注册表失败", err)
+	}
+
+	if database.RedisClient != nil {
+		go r.subscribe(ctx)
+	}
+	go r.refreshLoop(ctx)
+}
+
+// subscribe 订阅模型变更通知
+func (r *ModelRegistry) subscribe(ctx context.Context) {
+	pubsub := database.RedisClient.Subscribe(ctx, MODEL_REGISTRY_CHANNEL)
+	defer pubsub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-pubsub.Channel():
+			if !ok {
+				return
+			}
+			utils.LogInfo("收到模型变更通知，重新加载模型注册表", map[string]interface{}{
+				"model_id": msg.Payload,
+			})
+			if err := r.reloadFromDB(); err != nil {
+				utils.LogError("重新加载模型注册表失败", err)
+			}
+		}
+	}
+}
+
+// refreshLoop 定时刷新，作为发布订阅的兜底；刷新前将到期的预设价格同步到模型表
+func (r *ModelRegistry) refreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(MODEL_REGISTRY_REFRESH_INTERVAL)
+	defer ticker.Stop()
+
+	service := &AIModelService{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.syncEffectivePrices(); err != nil {
+				utils.LogWarn("同步模型生效价格失败", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			if err := r.Reload(); err != nil {
+				utils.LogError("定时刷新模型注册表失败", err)
+			}
+		}
+	}
+}
+
+// Reload 重新加载模型，优先读取Redis缓存
+func (r *ModelRegistry) Reload() error {
+	if modelList, ok := r.loadFromCache(); ok {
+		r.replace(modelList)
+		return nil
+	}
+	return r.reloadFromDB()
+}
+
+// reloadFromDB 从数据库加载模型并写入Redis缓存
+func (r *ModelRegistry) reloadFromDB() error {
+	var modelList []models.AIModel
+	if err := database.DB.Find(&modelList).Error; err != nil {
+		return err
+	}
+
+	r.replace(modelList)
+	r.saveToCache(modelList)
+	return nil
+}
+
+// loadFromCache 从Redis读取模型缓存
+func (r *ModelRegistry) loadFromCache() ([]models.AIModel, bool) {
+	if database.RedisClient == nil {
+		return nil, false
+	}
+
+	data, err := database.RedisClient.Get(context.Background(), MODEL_REGISTRY_CACHE_KEY).Bytes()
+	if err != nil {
+		return nil, false
+	}
+
+	var modelList []models.AIModel
+	if err := json.Unmarshal(data, &modelList); err != nil {
+		return nil, false
+	}
+	return modelList, true
+}
+
+// saveToCache 将模型写入Redis缓存
+func (r *ModelRegistry) saveToCache(modelList []models.AIModel) {
+	if database.RedisClient == nil {
+		return
+	}
+
+	data, err := json.Marshal(modelList)
+	if err != nil {
+		return
+	}
+	if err := database.RedisClient.Set(context.Background(), MODEL_REGISTRY_CACHE_KEY, data, MODEL_REGISTRY_CACHE_TTL).Err(); err != nil {
+		utils.LogWarn("写入模型注册表缓存失败", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// replace 替换内存中的模型并通知监听者
+func (r *ModelRegistry) replace(modelList []models.AIModel) {
+	modelMap := make(map[uint]*models.AIModel, len(modelList))
+	for i := range modelList {
+		aiModel := modelList[i]
+		modelMap[aiModel.Id] = &aiModel
+	}
+
+	r.mu.Lock()
+	r.modelMap = modelMap
+	r.loaded = true
+	listeners := append([]func(){}, r.listeners...)
+	r.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener()
+	}
+}
+
+// ensureLoaded 未加载时同步加载一次
+func (r *ModelRegistry) ensureLoaded() error {
+	r.mu.RLock()
+	loaded := r.loaded
+	r.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+	return r.Reload()
+}
+
+// OnChange 注册模型变更监听函数
+func (r *ModelRegistry) OnChange(listener func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, listener)
+}
+
+// Get 根据Id获取模型副本
+func (r *ModelRegistry) Get(id uint) (*models.AIModel, error) {
+	if err := r.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	aiModel, ok := r.modelMap[id]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, errors.New("模型不存在")
+	}
+
+	modelCopy := *aiModel
+	return &modelCopy, nil
+}
+
+// put 将回源数据库读到的模型加入内存，注册表尚未加载时忽略，等待下次整体加载
+func (r *ModelRegistry) put(aiModel models.AIModel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.loaded {
+		return
+	}
+	r.modelMap[aiModel.Id] = &aiModel
+}
+
+// List 获取所有模型副本，按Id排序
+func (r *ModelRegistry) List() ([]models.AIModel, error) {
+	if err := r.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	modelList := make([]models.AIModel, 0, len(r.modelMap))
+	for _, aiModel := range r.modelMap {
+		modelList = append(modelList, *aiModel)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(modelList, func(i, j int) bool {
+		return modelList[i].Id < modelList[j].Id
+	})
+	return modelList, nil
+}
+
+// Invalidate 模型变更后调用，刷新本实例并通知其他实例
+func (r *ModelRegistry) Invalidate(modelId uint) {
+	ctx := context.Background()
+
+	if database.RedisClient != nil {
+		if err := database.RedisClient.Del(ctx, MODEL_REGISTRY_CACHE_KEY).Err(); err != nil {
+			utils.LogWarn("删除模型注册表缓存失败", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	if err := r.reloadFromDB(); err != nil {
+		utils.LogError("刷新模型注册表失败", err, map[string]interface{}{
+			"model_id": modelId,
+		})
+	}
+
+	if database.RedisClient != nil {
+		payload := strconv.FormatUint(uint64(modelId), 10)
+		if err := database.RedisClient.Publish(ctx, MODEL_REGISTRY_CHANNEL, payload).Err(); err != nil {
+			utils.LogWarn("发布模型变更通知失败", map[string]interface{}{
+				"model_id": modelId,
+				"error":    err.Error(),
+			})
+		}
+	}
+}
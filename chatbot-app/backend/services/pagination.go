@@ -0,0 +1,178 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// CURSOR_DIRECTION_NEXT 沿列表顺序向后翻页（默认）
+	CURSOR_DIRECTION_NEXT = "next"
+	// CURSOR_DIRECTION_PREV 向前翻页，返回游标之前的数据
+	CURSOR_DIRECTION_PREV = "prev"
+)
+
+// ErrInvalidCursor 分页游标无法解析或不属于当前列表
+var ErrInvalidCursor = errors.New("无效的分页游标")
+
+// CursorPagination 游标分页参数
+type CursorPagination struct {
+	Cursor    string // 上次返回的next_cursor或prev_cursor，为空时从第一页开始
+	Limit     int    // 每页数量
+	Direction string // 翻页方向：next（默认）、prev
+}
+
+// CursorPageInfo 游标分页结果
+type CursorPageInfo struct {
+	NextCursor string `json:"next_cursor"` // 下一页游标，为空表示没有更多数据
+	PrevCursor string `json:"prev_cursor"` // 上一页游标，为空表示已是第一页
+	HasMore    bool   `json:"has_more"`    // 是否还有下一页
+}
+
+// cursorKey 游标分页的排序列，所有排序列组合起来必须唯一，通常以主键结尾
+type cursorKey struct {
+	Column string
+	Desc   bool
+}
+
+// paginateByCursor 按排序列做键集分页：以游标中记录的排序值作为查询条件，避免OFFSET扫描，
+// 翻页期间插入或删除数据也不会重复或遗漏。keyOf返回一行数据各排序列的值，用于生成游标。
+// page为nil时不分页，按同样的顺序返回全部数据
+func paginateByCursor[T any](query *gorm.DB, page *CursorPagination, keys []cursorKey, keyOf func(row *T) []int64) ([]T, *CursorPageInfo, error) {
+	if page == nil {
+		rows := []T{}
+		if err := orderByKeys(query, keys, false).Find(&rows).Error; err != nil {
+			return nil, nil, err
+		}
+		return rows, &CursorPageInfo{}, nil
+	}
+
+	values, err := decodeCursor(page.Cursor, len(keys))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 向前翻页时反转排序方向查询，取出后再恢复原顺序
+	prev := values != nil && page.Direction == CURSOR_DIRECTION_PREV
+	if values != nil {
+		condition, args := keysetCondition(keys, values, prev)
+		query = query.Where(condition, args...)
+	}
+	query = orderByKeys(query, keys, prev)
+
+	// 多取一条判断是否还有更多数据
+	var rows []T
+	if err := query.Limit(page.Limit + 1).Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	rows, info := buildCursorPage(rows, page.Limit, values != nil, prev, keyOf)
+	return rows, info, nil
+}
+
+// buildCursorPage 根据多取一条的查询结果生成当前页和前后页游标，
+// hasCursor表示请求带有游标，prev为true时rows按反向顺序查出
+func buildCursorPage[T any](rows []T, limit int, hasCursor bool, prev bool, keyOf func(row *T) []int64) ([]T, *CursorPageInfo) {
+	hasExtra := len(rows) > limit
+	if hasExtra {
+		rows = rows[:limit]
+	}
+	if prev {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	info := &CursorPageInfo{}
+	if len(rows) == 0 {
+		return []T{}, info
+	}
+	first := encodeCursor(keyOf(&rows[0]))
+	last := encodeCursor(keyOf(&rows[len(rows)-1]))
+	if prev {
+		// 从后面的页翻回来，后面一定还有数据
+		info.HasMore = true
+		info.NextCursor = last
+		if hasExtra {
+			info.PrevCursor = first
+		}
+	} else {
+		info.HasMore = hasExtra
+		if hasExtra {
+			info.NextCursor = last
+		}
+		if hasCursor {
+			info.PrevCursor = first
+		}
+	}
+	return rows, info
+}
+
+// orderByKeys 按排序列排序，reverse为true时反转每一列的方向
+func orderByKeys(query *gorm.DB, keys []cursorKey, reverse bool) *gorm.DB {
+	for _, key := range keys {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: key.Column}, Desc: key.Desc != reverse})
+	}
+	return query
+}
+
+// keysetCondition 生成位于游标之后（reverse为true时为之前）的查询条件，
+// 如(a, b)按a DESC, b DESC排序时生成：a < ? OR (a = ? AND b < ?)
+func keysetCondition(keys []cursorKey, values []int64, reverse bool) (string, []interface{}) {
+	var (
+		parts []string
+		args  []interface{}
+	)
+	for i, key := range keys {
+		var conditions []string
+		var partArgs []interface{}
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, keys[j].Column+" = ?")
+			partArgs = append(partArgs, values[j])
+		}
+		operator := ">"
+		if key.Desc != reverse {
+			operator = "<"
+		}
+		conditions = append(conditions, key.Column+" "+operator+" ?")
+		partArgs = append(partArgs, values[i])
+
+		parts = append(parts, "("+strings.Join(conditions, " AND ")+")")
+		args = append(args, partArgs...)
+	}
+	return "(" + strings.Join(parts, " OR ") + ")", args
+}
+
+// encodeCursor 将排序值编码为游标
+func encodeCursor(values []int64) string {
+	data, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor 解析游标中的排序值，游标为空时返回nil
+func decodeCursor(cursor string, size int) ([]int64, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var values []int64
+	if err := json.Unmarshal(data, &values); err != nil || len(values) != size {
+		return nil, ErrInvalidCursor
+	}
+	return values, nil
+}
+
+// boolCursorValue 将布尔排序列转换为游标中的值
+func boolCursorValue(value bool) int64 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// pageRow 测试用的数据行，排序值依次对应cursorKey
+type pageRow struct {
+	values []int64
+}
+
+func pageRowKey(row *pageRow) []int64 {
+	return row.values
+}
+
+// compareKeys 按排序列比较两行，a排在b之前时返回负数
+func compareKeys(keys []cursorKey, a, b []int64) int {
+	for i, key := range keys {
+		if a[i] == b[i] {
+			continue
+		}
+		less := a[i] < b[i]
+		if key.Desc {
+			less = !less
+		}
+		if less {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// fetchPage 在内存中模拟paginateByCursor的查询：按keysetCondition过滤、按orderByKeys排序并多取一条
+func fetchPage(t *testing.T, all []pageRow, keys []cursorKey, page *CursorPagination) ([]pageRow, *CursorPageInfo) {
+	t.Helper()
+	values, err := decodeCursor(page.Cursor, len(keys))
+	if err != nil {
+		t.Fatalf("解析游标失败: %v", err)
+	}
+	prev := values != nil && page.Direction == CURSOR_DIRECTION_PREV
+
+	var rows []pageRow
+	for _, row := range all {
+		if values != nil {
+			cmp := compareKeys(keys, row.values, values)
+			if (!prev && cmp <= 0) || (prev && cmp >= 0) {
+				continue
+			}
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		cmp := compareKeys(keys, rows[i].values, rows[j].values)
+		if prev {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	if len(rows) > page.Limit+1 {
+		rows = rows[:page.Limit+1]
+	}
+	return buildCursorPage(rows, page.Limit, values != nil, prev, pageRowKey)
+}
+
+func TestCursorPaginationRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		keys  []cursorKey
+		rows  []pageRow
+		limit int
+	}{
+		{
+			name:  "单列倒序",
+			keys:  []cursorKey{{Column: "id", Desc: true}},
+			rows:  []pageRow{{[]int64{1}}, {[]int64{2}}, {[]int64{3}}, {[]int64{4}}, {[]int64{5}}, {[]int64{6}}, {[]int64{7}}},
+			limit: 3,
+		},
+		{
+			name:  "置顶倒序加Id倒序",
+			keys:  []cursorKey{{Column: "pinned", Desc: true}, {Column: "id", Desc: true}},
+			rows:  []pageRow{{[]int64{0, 1}}, {[]int64{1, 2}}, {[]int64{0, 3}}, {[]int64{1, 4}}, {[]int64{0, 5}}, {[]int64{0, 6}}},
+			limit: 2,
+		},
+		{
+			name:  "升序与倒序混合",
+			keys:  []cursorKey{{Column: "score", Desc: false}, {Column: "id", Desc: true}},
+			rows:  []pageRow{{[]int64{2, 1}}, {[]int64{1, 2}}, {[]int64{2, 3}}, {[]int64{1, 4}}, {[]int64{3, 5}}, {[]int64{1, 6}}, {[]int64{2, 7}}},
+			limit: 3,
+		},
+		{
+			name:  "恰好整页",
+			keys:  []cursorKey{{Column: "id", Desc: false}},
+			rows:  []pageRow{{[]int64{1}}, {[]int64{2}}, {[]int64{3}}, {[]int64{4}}},
+			limit: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := append([]pageRow{}, tt.rows...)
+			sort.SliceStable(expected, func(i, j int) bool {
+				return compareKeys(tt.keys, expected[i].values, expected[j].values) < 0
+			})
+
+			// 沿next_cursor翻到最后一页，拼起来应与完整排序结果一致
+			var (
+				pages   [][]pageRow
+				infos   []*CursorPageInfo
+				visited []pageRow
+			)
+			page := &CursorPagination{Limit: tt.limit, Direction: CURSOR_DIRECTION_NEXT}
+			for {
+				rows, info := fetchPage(t, tt.rows, tt.keys, page)
+				pages = append(pages, rows)
+				infos = append(infos, info)
+				visited = append(visited, rows...)
+				if !info.HasMore {
+					if info.NextCursor != "" {
+						t.Errorf("最后一页不应返回next_cursor")
+					}
+					break
+				}
+				if len(pages) > len(tt.rows) {
+					t.Fatalf("翻页没有结束")
+				}
+				page = &CursorPagination{Cursor: info.NextCursor, Limit: tt.limit, Direction: CURSOR_DIRECTION_NEXT}
+			}
+			if !reflect.DeepEqual(visited, expected) {
+				t.Fatalf("向后翻页结果 = %v, 期望 %v", visited, expected)
+			}
+			if infos[0].PrevCursor != "" {
+				t.Errorf("第一页不应返回prev_cursor")
+			}
+
+			// 从最后一页沿prev_cursor翻回，每一页应与向后翻页时相同
+			for i := len(pages) - 1; i > 0; i-- {
+				page := &CursorPagination{Cursor: infos[i].PrevCursor, Limit: tt.limit, Direction: CURSOR_DIRECTION_PREV}
+				rows, info := fetchPage(t, tt.rows, tt.keys, page)
+				if !reflect.DeepEqual(rows, pages[i-1]) {
+					t.Fatalf("第%d页向前翻页结果 = %v, 期望 %v", i, rows, pages[i-1])
+				}
+				if !info.HasMore || info.NextCursor == "" {
+					t.Errorf("向前翻页后应能继续向后翻页")
+				}
+				if (i-1 > 0) != (info.PrevCursor != "") {
+					t.Errorf("第%d页prev_cursor = %q", i-1, info.PrevCursor)
+				}
+
+				// 向前翻回的页上的next_cursor应指向原来的下一页
+				next, _ := fetchPage(t, tt.rows, tt.keys, &CursorPagination{Cursor: info.NextCursor, Limit: tt.limit, Direction: CURSOR_DIRECTION_NEXT})
+				if !reflect.DeepEqual(next, pages[i]) {
+					t.Fatalf("第%d页next_cursor指向 %v, 期望 %v", i-1, next, pages[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBuildCursorPageEmpty(t *testing.T) {
+	rows, info := buildCursorPage([]pageRow{}, 10, true, false, pageRowKey)
+	if rows == nil || len(rows) != 0 {
+		t.Errorf("空页应返回空切片，得到 %v", rows)
+	}
+	if *info != (CursorPageInfo{}) {
+		t.Errorf("空页不应返回游标，得到 %+v", info)
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		keys      []cursorKey
+		values    []int64
+		reverse   bool
+		condition string
+		args      []interface{}
+	}{
+		{
+			name:      "单列倒序",
+			keys:      []cursorKey{{Column: "id", Desc: true}},
+			values:    []int64{10},
+			condition: "((id < ?))",
+			args:      []interface{}{int64(10)},
+		},
+		{
+			name:      "单列倒序反向",
+			keys:      []cursorKey{{Column: "id", Desc: true}},
+			values:    []int64{10},
+			reverse:   true,
+			condition: "((id > ?))",
+			args:      []interface{}{int64(10)},
+		},
+		{
+			name:      "两列倒序",
+			keys:      []cursorKey{{Column: "pinned", Desc: true}, {Column: "id", Desc: true}},
+			values:    []int64{1, 5},
+			condition: "((pinned < ?) OR (pinned = ? AND id < ?))",
+			args:      []interface{}{int64(1), int64(1), int64(5)},
+		},
+		{
+			name:      "升序与倒序混合",
+			keys:      []cursorKey{{Column: "score", Desc: false}, {Column: "id", Desc: true}},
+			values:    []int64{3, 7},
+			condition: "((score > ?) OR (score = ? AND id < ?))",
+			args:      []interface{}{int64(3), int64(3), int64(7)},
+		},
+		{
+			name:      "升序与倒序混合反向",
+			keys:      []cursorKey{{Column: "score", Desc: false}, {Column: "id", Desc: true}},
+			values:    []int64{3, 7},
+			reverse:   true,
+			condition: "((score < ?) OR (score = ? AND id > ?))",
+			args:      []interface{}{int64(3), int64(3), int64(7)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, args := keysetCondition(tt.keys, tt.values, tt.reverse)
+			if condition != tt.condition {
+				t.Errorf("条件 = %q, 期望 %q", condition, tt.condition)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("参数 = %v, 期望 %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		size    int
+		values  []int64
+		invalid bool
+	}{
+		{name: "空游标", cursor: "", size: 1, values: nil},
+		{name: "单值", cursor: encodeCursor([]int64{42}), size: 1, values: []int64{42}},
+		{name: "多值", cursor: encodeCursor([]int64{1, 99}), size: 2, values: []int64{1, 99}},
+		{name: "数量不一致", cursor: encodeCursor([]int64{1, 99}), size: 1, invalid: true},
+		{name: "非Base64", cursor: "!!!", size: 1, invalid: true},
+		{name: "非JSON", cursor: base64.RawURLEncoding.EncodeToString([]byte("abc")), size: 1, invalid: true},
+		{name: "非整数", cursor: base64.RawURLEncoding.EncodeToString([]byte(`["a"]`)), size: 1, invalid: true},
+		{name: "空数组", cursor: encodeCursor([]int64{}), size: 1, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := decodeCursor(tt.cursor, tt.size)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidCursor) {
+					t.Fatalf("错误 = %v, 期望 ErrInvalidCursor", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("解析失败: %v", err)
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("结果 = %v, 期望 %v", values, tt.values)
+			}
+		})
+	}
+}
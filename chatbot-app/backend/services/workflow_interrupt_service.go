@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+
+	"chatbot-app/backend/database"
+	"chatbot-app/backend/models"
+	"chatbot-app/backend/utils"
+	"chatbot-app/backend/utils/coze"
+)
+
+const (
+	// WORKFLOW_INTERRUPT_STATUS_PENDING 等待用户回答
+	WORKFLOW_INTERRUPT_STATUS_PENDING = "pending"
+	// WORKFLOW_INTERRUPT_STATUS_RESUMED 已恢复执行
+	WORKFLOW_INTERRUPT_STATUS_RESUMED = "resumed"
+)
+
+// WorkflowInterruptService 工作流中断服务
+type WorkflowInterruptService struct{}
+
+// SaveInterrupt 保存工作流中断，question为工作流提出的问题，messageId为问题对应的AI消息
+func (s *WorkflowInterruptService) SaveInterrupt(chatId uint, userId uint, modelId uint, interrupt *coze.WorkflowInterrupt, question string, messageId uint) (*models.WorkflowInterrupt, error) {
+	record := &models.WorkflowInterrupt{
+		ChatId:        chatId,
+		UserId:        userId,
+		ModelId:       modelId,
+		WorkflowId:    interrupt.WorkflowID,
+		EventId:       interrupt.EventID,
+		InterruptType: interrupt.InterruptType,
+		NodeTitle:     interrupt.NodeTitle,
+		Question:      question,
+		MessageId:     messageId,
+		Status:        WORKFLOW_INTERRUPT_STATUS_PENDING,
+	}
+	if err := database.DB.Create(record).Error; err != nil {
+		return nil, err
+	}
+
+	utils.LogInfo("工作流等待用户输入", map[string]interface{}{
+		"interrupt_id": record.Id,
+		"chat_id":      chatId,
+		"workflow_id":  record.WorkflowId,
+		"node_title":   record.NodeTitle,
+	})
+	return record, nil
+}
+
+// GetPendingInterrupt 获取会话中等待回答的中断，interruptId为0时取最近的一条
+func (s *WorkflowInterruptService) GetPendingInterrupt(chatId uint, userId uint, interruptId uint) (*models.WorkflowInterrupt, error) {
+	query := database.DB.Where("chat_id = ? AND user_id = ? AND status = ?", chatId, userId, WORKFLOW_INTERRUPT_STATUS_PENDING)
+	if interruptId != 0 {
+		query = query.Where("id = ?", interruptId)
+	}
+
+	var record models.WorkflowInterrupt
+	if err := query.Order("id DESC").First(&record).Error; err != nil {
+		return nil, errors.New("没有等待回答的工作流")
+	}
+	return &record, nil
+}
+
+// ClaimInterrupt 将中断标记为已恢复，并发恢复同一中断时只有一个请求能成功
+func (s *WorkflowInterruptService) ClaimInterrupt(id uint) error {
+	result := database.DB.Model(&models.WorkflowInterrupt{}).
+		Where("id = ? AND status = ?", id, WORKFLOW_INTERRUPT_STATUS_PENDING).
+		Update("status", WORKFLOW_INTERRUPT_STATUS_RESUMED)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("该工作流已恢复执行")
+	}
+	return nil
+}
+
+// ReleaseInterrupt 恢复执行失败时将中断重新标记为等待回答
+func (s *WorkflowInterruptService) ReleaseInterrupt(id uint) {
+	if err := database.DB.Model(&models.WorkflowInterrupt{}).Where("id = ?", id).
+		Update("status", WORKFLOW_INTERRUPT_STATUS_PENDING).Error; err != nil {
+		utils.LogError("重置工作流中断状态失败", err, map[string]interface{}{
+			"interrupt_id": id,
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"chatbot-app/backend/models"
+	"chatbot-app/backend/utils"
+	"chatbot-app/backend/utils/coze"
+)
+
+// RequestMeta 一次对话请求的附加信息
+type RequestMeta struct {
+	ClientIP   string                 // 客户端IP
+	FormFields map[string]interface{} // 用户提交的表单字段
+	Files      []models.ChatFile      // 本轮消息携带的附件，需已上传到Coze
+	// OnEvent 文本以外的事件回调（如工作流中断、推理过程、推荐问题），可为空
+	OnEvent func(eventType string, data interface{})
+	// Context 请求上下文，结束时停止生成并取消Coze侧的对话，可为空
+	Context context.Context
+	// Fork 本轮接在历史消息的分支上（编辑消息、重新生成、切换分支），需新建Coze会话并以本地历史作为上下文
+	Fork bool
+	// JSONMode 要求模型以JSON格式输出
+	JSONMode bool
+}
+
+// context 返回请求上下文，未设置时返回Background
+func (meta *RequestMeta) context() context.Context {
+	if meta == nil || meta.Context == nil {
+		return context.Background()
+	}
+	return meta.Context
+}
+
+// ModelApiParameters 模型的API参数配置，对应AIModel.ApiParameters
+type ModelApiParameters struct {
+	// WorkflowParameters Coze工作流输入参数模板，支持占位符：
+	// {{user_id}} {{client_ip}} {{chat_id}} {{message}} {{form.字段名}}
+	// {{history}} 最近的对话记录，[{"role":"user","content":"..."}]形式的数组
+	// {{history_text}} 最近的对话记录，"用户: ...\n助手: ..."形式的文本
+	// {{env.WORKFLOW_XXX}} 环境变量，用于传入凭据等不宜写入数据库的值
+	WorkflowParameters map[string]interface{} `json:"workflow_parameters"`
+	// HistoryTurns 对话记录占位符包含的最近轮数，一问一答为一轮，不配置时使用默认值
+	HistoryTurns int `json:"history_turns"`
+}
+
+// WORKFLOW_DEFAULT_HISTORY_TURNS 对话记录占位符默认包含的轮数
+const WORKFLOW_DEFAULT_HISTORY_TURNS = 5
+
+// WORKFLOW_ENV_PREFIX {{env.变量名}}占位符只能读取以此为前缀的环境变量，避免模板读出数据库密码等其他配置
+const WORKFLOW_ENV_PREFIX = "WORKFLOW_"
+
+// historyTurns 对话记录占位符包含的轮数
+func (params *ModelApiParameters) historyTurns() int {
+	if params.HistoryTurns > 0 {
+		return params.HistoryTurns
+	}
+	return WORKFLOW_DEFAULT_HISTORY_TURNS
+}
+
+// defaultWorkflowParameters 未配置模板时的默认工作流参数
+var defaultWorkflowParameters = map[string]interface{}{
+	"input": "{{message}}",
+}
+
+// WORKFLOW_PARAM_REDACTED 保存执行记录时替换敏感参数的值
+const WORKFLOW_PARAM_REDACTED = "******"
+
+// placeholderPattern 匹配{{name}}形式的占位符
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9_.]+)\s*\}\}`)
+
+// ParseModelApiParameters 解析模型的API参数配置
+func ParseModelApiParameters(aiModel *models.AIModel) (*ModelApiParameters, error) {
+	params := &ModelApiParameters{}
+	if aiModel == nil || strings.TrimSpace(aiModel.ApiParameters) == "" || aiModel.ApiParameters == "null" {
+		return params, nil
+	}
+	if err := json.Unmarshal([]byte(aiModel.ApiParameters), params); err != nil {
+		return nil, fmt.Errorf("模型API参数格式错误: %v", err)
+	}
+	return params, nil
+}
+
+// WorkflowParamContext 渲染工作流参数模板所需的数据
+type WorkflowParamContext struct {
+	UserId       uint
+	ChatId       uint
+	Message      string
+	ClientIP     string
+	Form         map[string]interface{}
+	History      []*models.Message // 本轮之前的对话记录，按时间正序
+	HistoryTurns int               // 对话记录占位符包含的轮数，渲染时按模型配置设置
+}
+
+// lookup 查找占位符对应的值
+func (ctx *WorkflowParamContext) lookup(name string) (interface{}, bool) {
+	switch name {
+	case "user_id":
+		return strconv.FormatUint(uint64(ctx.UserId), 10), true
+	case "chat_id":
+		return strconv.FormatUint(uint64(ctx.ChatId), 10), true
+	case "message":
+		return ctx.Message, true
+	case "client_ip":
+		return ctx.ClientIP, true
+	case "history":
+		history := ctx.recentHistory()
+		list := make([]interface{}, 0, len(history))
+		for _, msg := range history {
+			list = append(list, map[string]interface{}{
+				"role":    msg.Role,
+				"content": msg.Content,
+			})
+		}
+		return list, true
+	case "history_text":
+		var builder strings.Builder
+		for _, msg := range ctx.recentHistory() {
+			role := "用户"
+			if msg.Role == "assistant" {
+				role = "助手"
+			}
+			builder.WriteString(role + ": " + msg.Content + "\n")
+		}
+		return strings.TrimSuffix(builder.String(), "\n"), true
+	}
+	if field, ok := strings.CutPrefix(name, "form."); ok {
+		value, exists := ctx.Form[field]
+		return value, exists
+	}
+	if key, ok := strings.CutPrefix(name, "env."); ok && strings.HasPrefix(key, WORKFLOW_ENV_PREFIX) {
+		value := os.Getenv(key)
+		return value, value != ""
+	}
+	return nil, false
+}
+
+// recentHistory 返回最近HistoryTurns轮的用户和助手消息
+func (ctx *WorkflowParamContext) recentHistory() []*models.Message {
+	history := make([]*models.Message, 0, len(ctx.History))
+	for _, msg := range ctx.History {
+		if msg.Role == "user" || msg.Role == "assistant" {
+			history = append(history, msg)
+		}
+	}
+	if limit := ctx.HistoryTurns * 2; limit > 0 && len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	return history
+}
+
+// newWorkflowParamContext 根据请求信息创建模板渲染数据
+func newWorkflowParamContext(chatID uint, message string, userID uint, history []*models.Message, meta *RequestMeta) *WorkflowParamContext {
+	ctx := &WorkflowParamContext{
+		UserId:  userID,
+		ChatId:  chatID,
+		Message: message,
+		History: history,
+	}
+	if meta != nil {
+		ctx.ClientIP = meta.ClientIP
+		ctx.Form = meta.FormFields
+	}
+	return ctx
+}
+
+// RenderWorkflowParameters 根据模型配置的模板渲染工作流输入参数
+func RenderWorkflowParameters(aiModel *models.AIModel, ctx *WorkflowParamContext) (map[string]interface{}, error) {
+	params, err := ParseModelApiParameters(aiModel)
+	if err != nil {
+		return nil, err
+	}
+
+	template := params.WorkflowParameters
+	if len(template) == 0 {
+		template = defaultWorkflowParameters
+	}
+	ctx.HistoryTurns = params.historyTurns()
+
+	rendered := make(map[string]interface{}, len(template))
+	for key, value := range template {
+		result, err := renderTemplateValue(value, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("渲染工作流参数%s失败: %v", key, err)
+		}
+		// 未提供的可选表单字段不传给工作流
+		if result == nil {
+			continue
+		}
+		rendered[key] = result
+	}
+	return rendered, nil
+}
+
+// renderTemplateValue 递归渲染模板值
+func renderTemplateValue(value interface{}, ctx *WorkflowParamContext) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return renderTemplateString(v, ctx)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered, err := renderTemplateValue(item, ctx)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = rendered
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			rendered, err := renderTemplateValue(item, ctx)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, rendered)
+		}
+		return result, nil
+	default:
+		return v, nil
+	}
+}
+
+// renderTemplateString 渲染字符串模板
+// 整个字符串只有一个占位符时保留原始类型，否则按字符串拼接
+func renderTemplateString(template string, ctx *WorkflowParamContext) (interface{}, error) {
+	trimmed := strings.TrimSpace(template)
+	if match := placeholderPattern.FindStringSubmatch(trimmed); match != nil && match[0] == trimmed {
+		value, ok := ctx.lookup(match[1])
+		if !ok {
+			if strings.HasPrefix(match[1], "form.") {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("未知的占位符: %s", match[1])
+		}
+		return value, nil
+	}
+
+	var renderErr error
+	result := placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		value, ok := ctx.lookup(name)
+		if !ok {
+			if !strings.HasPrefix(name, "form.") && renderErr == nil {
+				renderErr = fmt.Errorf("未知的占位符: %s", name)
+			}
+			return ""
+		}
+		if str, isString := value.(string); isString {
+			return str
+		}
+		data, _ := json.Marshal(value)
+		return string(data)
+	})
+	if renderErr != nil {
+		return nil, renderErr
+	}
+	return result, nil
+}
+
+// RedactWorkflowParameters 返回隐藏了敏感参数的副本，用于保存执行记录
+// 模板中引用了{{env.变量名}}的参数视为凭据，值替换为WORKFLOW_PARAM_REDACTED
+func RedactWorkflowParameters(aiModel *models.AIModel, parameters map[string]interface{}) map[string]interface{} {
+	var template map[string]interface{}
+	if params, err := ParseModelApiParameters(aiModel); err == nil {
+		template = params.WorkflowParameters
+	}
+
+	redacted := make(map[string]interface{}, len(parameters))
+	for key, value := range parameters {
+		if templateReferencesEnv(template[key]) {
+			value = WORKFLOW_PARAM_REDACTED
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// templateReferencesEnv 判断模板值中是否引用了环境变量
+func templateReferencesEnv(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(string(data), -1) {
+		if strings.HasPrefix(match[1], "env.") {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateWorkflowParameters 按工作流声明的输入参数校验渲染结果
+func ValidateWorkflowParameters(parameters map[string]interface{}, inputs map[string]*coze.WorkflowInput) error {
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	var missing []string
+	for name, input := range inputs {
+		if input == nil || !input.Required || input.DefaultValue != "" {
+			continue
+		}
+		value, ok := parameters[name]
+		if !ok || value == nil || value == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("缺少工作流必填参数: %s", strings.Join(missing, ", "))
+	}
+
+	var unknown []string
+	for name := range parameters {
+		if _, ok := inputs[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("工作流未声明参数: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// buildWorkflowParameters 渲染并校验工作流输入参数
+func (s *CozeService) buildWorkflowParameters(ctx *WorkflowParamContext) (map[string]interface{}, error) {
+	parameters, err := RenderWorkflowParameters(s.aiModel, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs, err := s.client.GetWorkflowInputs(s.GetWorkflowID())
+	if err != nil {
+		// 获取声明失败时不阻断请求，由Coze侧校验
+		utils.LogWarn("获取工作流输入声明失败，跳过参数校验", map[string]interface{}{
+			"workflow_id": s.GetWorkflowID(),
+			"error":       err.Error(),
+		})
+		return parameters, nil
+	}
+
+	if err := ValidateWorkflowParameters(parameters, inputs); err != nil {
+		return nil, err
+	}
+	return parameters, nil
+}
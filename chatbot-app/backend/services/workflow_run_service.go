@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"chatbot-app/backend/database"
+	"chatbot-app/backend/models"
+	"chatbot-app/backend/utils"
+	"chatbot-app/backend/utils/coze"
+)
+
+const (
+	// WORKFLOW_RUN_CHANNEL 工作流执行完成通知频道
+	WORKFLOW_RUN_CHANNEL = "workflow_run:finished"
+	// WORKFLOW_RUN_POLL_INTERVAL 后台轮询执行结果的间隔
+	WORKFLOW_RUN_POLL_INTERVAL = 5 * time.Second
+	// WORKFLOW_RUN_TIMEOUT 超过该时间仍未完成的执行记为超时
+	WORKFLOW_RUN_TIMEOUT = 24 * time.Hour
+	// WORKFLOW_RUN_POLL_BATCH_SIZE 每批查询的未完成执行数量
+	WORKFLOW_RUN_POLL_BATCH_SIZE = 100
+	// WORKFLOW_RUN_STATUS_TIMEOUT 执行超时状态
+	WORKFLOW_RUN_STATUS_TIMEOUT = "timeout"
+)
+
+// WorkflowRunService 工作流异步执行服务
+type WorkflowRunService struct{}
+
+// StartRun 异步执行工作流并保存执行记录
+func (s *WorkflowRunService) StartRun(aiModel *models.AIModel, userId uint, chatId uint, message string, meta *RequestMeta) (*models.WorkflowRun, error) {
+	cozeService, err := NewCozeService(aiModel)
+	if err != nil {
+		return nil, err
+	}
+
+	executeId, parameters, err := cozeService.RunWorkflowAsync(chatId, message, userId, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// 执行记录会返回给用户，凭据类参数不保存原值
+	inputs, _ := json.Marshal(RedactWorkflowParameters(aiModel, parameters))
+	run := &models.WorkflowRun{
+		UserId:     userId,
+		ChatId:     chatId,
+		ModelId:    aiModel.Id,
+		WorkflowId: cozeService.GetWorkflowID(),
+		ExecuteId:  executeId,
+		Status:     coze.WORKFLOW_RUN_STATUS_RUNNING,
+		Inputs:     string(inputs),
+	}
+	if err := database.DB.Create(run).Error; err != nil {
+		return nil, err
+	}
+
+	utils.LogInfo("工作流已异步执行", map[string]interface{}{
+		"run_id":      run.Id,
+		"workflow_id": run.WorkflowId,
+		"execute_id":  executeId,
+		"user_id":     userId,
+	})
+	return run, nil
+}
+
+// GetRun 获取用户的执行记录
+func (s *WorkflowRunService) GetRun(id uint, userId uint) (*models.WorkflowRun, error) {
+	var run models.WorkflowRun
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userId).First(&run).Error; err != nil {
+		return nil, errors.New("执行记录不存在")
+	}
+	return &run, nil
+}
+
+// GetUserRuns 分页获取用户的执行记录
+func (s *WorkflowRunService) GetUserRuns(userId uint, page int, limit int) ([]models.WorkflowRun, int64, error) {
+	var runs []models.WorkflowRun
+	var total int64
+
+	query := database.DB.Model(&models.WorkflowRun{}).Where("user_id = ?", userId)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&runs).Error; err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+// IsWorkflowRunFinished 执行是否已结束
+func IsWorkflowRunFinished(run *models.WorkflowRun) bool {
+	return run.Status != coze.WORKFLOW_RUN_STATUS_RUNNING
+}
+
+// WaitRun 等待执行结束，ctx结束时返回ctx的错误
+// 优先通过Redis订阅完成通知，同时定时查库兜底
+func (s *WorkflowRunService) WaitRun(ctx context.Context, id uint, userId uint) (*models.WorkflowRun, error) {
+	run, err := s.GetRun(id, userId)
+	if err != nil || IsWorkflowRunFinished(run) {
+		return run, err
+	}
+
+	var notify <-chan struct{}
+	if database.RedisClient != nil {
+		pubsub := database.RedisClient.Subscribe(ctx, WORKFLOW_RUN_CHANNEL)
+		defer pubsub.Close()
+
+		ch := make(chan struct{}, 1)
+		notify = ch
+		payload := strconv.FormatUint(uint64(id), 10)
+		go func() {
+			for msg := range pubsub.Channel() {
+				if msg.Payload == payload {
+					select {
+					case ch <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(WORKFLOW_RUN_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return run, ctx.Err()
+		case <-notify:
+		case <-ticker.C:
+		}
+
+		run, err = s.GetRun(id, userId)
+		if err != nil || IsWorkflowRunFinished(run) {
+			return run, err
+		}
+	}
+}
+
+// WorkflowRunWorker 后台轮询未完成的工作流执行
+type WorkflowRunWorker struct{}
+
+var (
+	workflowRunWorker     *WorkflowRunWorker
+	workflowRunWorkerOnce sync.Once
+)
+
+// GetWorkflowRunWorker 获取全局工作流执行轮询器
+func GetWorkflowRunWorker() *WorkflowRunWorker {
+	workflowRunWorkerOnce.Do(func() {
+		workflowRunWorker = &WorkflowRunWorker{}
+	})
+	return workflowRunWorker
+}
+
+// Start 启动后台轮询，直到ctx结束
+func (w *WorkflowRunWorker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(WORKFLOW_RUN_POLL_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.pollOnce()
+			}
+		}
+	}()
+}
+
+// pollOnce 查询所有未完成执行的最新状态，按Id分批遍历，避免较早的执行长期占满一批导致新执行得不到轮询
+// 每个执行使用其模型对应的Coze客户端查询，同一次轮询内按模型复用
+func (w *WorkflowRunWorker) pollOnce() {
+	cozeServices := make(map[uint]*CozeService)
+	var lastId uint
+	for {
+		var runs []models.WorkflowRun
+		if err := database.DB.Where("status = ? AND id > ?", coze.WORKFLOW_RUN_STATUS_RUNNING, lastId).
+			Order("id ASC").Limit(WORKFLOW_RUN_POLL_BATCH_SIZE).Find(&runs).Error; err != nil {
+			utils.LogError("查询未完成的工作流执行失败", err)
+			return
+		}
+		if len(runs) == 0 {
+			return
+		}
+
+		for i := range runs {
+			run := &runs[i]
+			cozeService, ok := cozeServices[run.ModelId]
+			if !ok {
+				var err error
+				if cozeService, err = w.runCozeService(run.ModelId); err != nil {
+					utils.LogError("轮询工作流执行结果失败", err, map[string]interface{}{
+						"run_id":   run.Id,
+						"model_id": run.ModelId,
+					})
+				}
+				// 创建失败时同样缓存，本次轮询不再重复创建
+				cozeServices[run.ModelId] = cozeService
+			}
+			w.pollRun(cozeService, run)
+		}
+		if len(runs) < WORKFLOW_RUN_POLL_BATCH_SIZE {
+			return
+		}
+		lastId = runs[len(runs)-1].Id
+	}
+}
+
+// runCozeService 按执行所属的模型创建Coze客户端，与发起执行时使用的配置一致
+func (w *WorkflowRunWorker) runCozeService(modelId uint) (*CozeService, error) {
+	aiModel, err := (&AIModelService{}).GetModelById(modelId)
+	if err != nil {
+		return nil, fmt.Errorf("获取工作流模型失败: %w", err)
+	}
+	return NewCozeService(aiModel)
+}
+
+// pollRun 查询单个执行的状态，结束时更新记录并发送通知；
+// cozeService为空（如模型已删除）时不查询，超时后直接标记为超时
+func (w *WorkflowRunWorker) pollRun(cozeService *CozeService, run *models.WorkflowRun) {
+	updates := map[string]interface{}{}
+
+	var (
+		result *coze.WorkflowRunResult
+		err    error
+	)
+	if cozeService != nil {
+		result, err = cozeService.GetWorkflowRunResult(run.WorkflowId, run.ExecuteId)
+	}
+	if err != nil {
+		utils.LogWarn("查询工作流执行结果失败", map[string]interface{}{
+			"run_id":     run.Id,
+			"execute_id": run.ExecuteId,
+			"error":      err.Error(),
+		})
+	} else if result != nil && result.Status != coze.WORKFLOW_RUN_STATUS_RUNNING {
+		updates["status"] = result.Status
+		updates["output"] = result.Output
+		updates["error_message"] = result.ErrorMessage
+		updates["debug_url"] = result.DebugURL
+		updates["token_count"] = result.TokenCount
+	}
+
+	if len(updates) == 0 {
+		if time.Since(run.CreatedAt) < WORKFLOW_RUN_TIMEOUT {
+			return
+		}
+		updates["status"] = WORKFLOW_RUN_STATUS_TIMEOUT
+		updates["error_message"] = "工作流执行超时"
+	}
+
+	now := time.Now()
+	updates["finished_at"] = &now
+
+	// 多实例同时轮询时只有一个实例能更新成功
+	updateResult := database.DB.Model(&models.WorkflowRun{}).
+		Where("id = ? AND status = ?", run.Id, coze.WORKFLOW_RUN_STATUS_RUNNING).
+		Updates(updates)
+	if updateResult.Error != nil {
+		utils.LogError("更新工作流执行记录失败", updateResult.Error, map[string]interface{}{
+			"run_id": run.Id,
+		})
+		return
+	}
+	if updateResult.RowsAffected == 0 {
+		return
+	}
+
+	utils.LogInfo("工作流异步执行结束", map[string]interface{}{
+		"run_id":     run.Id,
+		"execute_id": run.ExecuteId,
+		"status":     updates["status"],
+	})
+
+	w.recordUsage(run, result, updates["status"].(string), now)
+
+	if database.RedisClient != nil {
+		payload := strconv.FormatUint(uint64(run.Id), 10)
+		if err := database.RedisClient.Publish(context.Background(), WORKFLOW_RUN_CHANNEL, payload).Err(); err != nil {
+			utils.LogWarn("发布工作流执行完成通知失败", map[string]interface{}{
+				"run_id": run.Id,
+				"error":  err.Error(),
+			})
+		}
+	}
+}
+
+// recordUsage 执行结束时记录模型使用情况，按Coze统计的Token用量和结束时生效的价格计费
+// 执行失败时Coze同样会统计已消耗的Token，一并计费并记为错误
+func (w *WorkflowRunWorker) recordUsage(run *models.WorkflowRun, result *coze.WorkflowRunResult, status string, finishedAt time.Time) {
+	modelService := &AIModelService{}
+	duration := int(finishedAt.Sub(run.CreatedAt).Milliseconds())
+
+	var usage *models.AIModelUsage
+	switch status {
+	case coze.WORKFLOW_RUN_STATUS_SUCCESS, coze.WORKFLOW_RUN_STATUS_FAIL:
+		promptTokens, completionTokens := result.InputCount, result.OutputCount
+		// 未区分输入输出时按输出计费
+		if promptTokens == 0 && completionTokens == 0 {
+			completionTokens = result.TokenCount
+		}
+		usage = modelService.CreateModelUsageFromResponse(run.UserId, run.ModelId, run.ChatId, 0, run.Inputs, result.Output, promptTokens, completionTokens, duration)
+		if status == coze.WORKFLOW_RUN_STATUS_FAIL {
+			usage.Status = "error"
+			usage.ErrorMsg = "工作流执行失败: " + result.ErrorMessage
+		}
+	default:
+		usage = modelService.CreateModelUsageError(run.UserId, run.ModelId, run.ChatId, run.Inputs, "工作流执行超时")
+		usage.Duration = duration
+	}
+
+	if err := modelService.RecordModelUsage(usage); err != nil {
+		utils.LogError("记录工作流使用情况失败", err, map[string]interface{}{
+			"run_id": run.Id,
+		})
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,6 +12,8 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+
+	"chatbot-app/backend/models"
 )
 
 // Message 消息结构
@@ -27,14 +30,44 @@ type ChatCompletionOptions struct {
 	Stream           bool    `json:"stream,omitempty"`            // 是否启用流式响应
 	PresencePenalty  float64 `json:"presence_penalty,omitempty"`  // 影响模型不重复生成已经出现过的token的可能性
 	FrequencyPenalty float64 `json:"frequency_penalty,omitempty"` // 影响模型不重复生成某些频繁出现的token的可能性
+	ResponseFormat   string  `json:"response_format,omitempty"`   // 输出格式：text（默认）、json_object
+}
+
+// GenerateRequest 一次生成请求，客户端按需使用其中的字段
+type GenerateRequest struct {
+	Context    context.Context                          // 请求上下文，结束时停止生成，可为空
+	Prompt     string                                   // 本轮提问
+	History    []Message                                // 历史消息
+	UserId     uint                                     // 用户Id
+	ChatId     uint                                     // 聊天会话Id，0表示不关联会话
+	ClientIP   string                                   // 客户端IP
+	FormFields map[string]interface{}                   // 用户提交的表单字段
+	Files      []models.ChatFile                        // 本轮消息携带的附件
+	OnEvent    func(eventType string, data interface{}) // 文本以外的事件回调，可为空
+	Fork       bool                                     // 本轮接在历史消息的分支上，外部平台保存的会话上下文需要重建
+	JSONMode   bool                                     // 要求模型以JSON格式输出
+}
+
+// Ctx 返回请求上下文，未设置时返回Background
+func (req *GenerateRequest) Ctx() context.Context {
+	if req.Context == nil {
+		return context.Background()
+	}
+	return req.Context
+}
+
+// TokenUsage 一次请求实际消耗的Token
+type TokenUsage struct {
+	PromptTokens     int
+	CompletionTokens int
 }
 
 // AIClient AI客户端接口
 type AIClient interface {
-	// GenerateResponse 生成回复
-	GenerateResponse(prompt string, history []Message) (string, error)
-	// GenerateStreamResponse 生成流式回复
-	GenerateStreamResponse(prompt string, history []Message, callback func(chunk string, isEnd bool, err error) bool) error
+	// GenerateResponse 生成回复，提供商未返回用量时usage为nil
+	GenerateResponse(req *GenerateRequest) (string, *TokenUsage, error)
+	// GenerateStreamResponse 生成流式回复，提供商未返回用量时usage为nil
+	GenerateStreamResponse(req *GenerateRequest, callback func(chunk string, isEnd bool, err error) bool) (*TokenUsage, error)
 }
 
 // ZhipuClient 智谱AI客户端
@@ -65,39 +98,68 @@ func NewZhipuClient(apiKey, baseURL, model string, options *ChatCompletionOption
 }
 
 // GenerateResponse 实现AIClient接口，生成回复
-func (c *ZhipuClient) GenerateResponse(prompt string, history []Message) (string, error) {
-	// 构建消息列表
-	messages := make([]Message, 0, len(history)+1)
-	messages = append(messages, history...)
-	messages = append(messages, Message{
-		Role:    "user",
-		Content: prompt,
-	})
+func (c *ZhipuClient) GenerateResponse(req *GenerateRequest) (string, *TokenUsage, error) {
+	options := *c.Options
+	if req.JSONMode {
+		options.ResponseFormat = RESPONSE_FORMAT_JSON
+	}
 
 	// 调用聊天补全API
-	response, err := c.ChatCompletion(c.Model, messages, c.Options)
+	response, err := c.ChatCompletion(c.Model, buildZhipuMessages(req), &options)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	// 提取回复内容
 	if len(response.Choices) > 0 {
-		return response.Choices[0].Message.Content, nil
+		usage := &TokenUsage{
+			PromptTokens:     response.Usage.PromptTokens,
+			CompletionTokens: response.Usage.CompletionTokens,
+		}
+		return response.Choices[0].Message.Content, usage, nil
 	}
 
-	return "", fmt.Errorf("未收到有效回复")
+	return "", nil, fmt.Errorf("未收到有效回复")
+}
+
+// buildZhipuMessages 将历史消息和本轮提问组成消息列表
+func buildZhipuMessages(req *GenerateRequest) []Message {
+	messages := make([]Message, 0, len(req.History)+1)
+	messages = append(messages, req.History...)
+	messages = append(messages, Message{
+		Role:    "user",
+		Content: req.Prompt,
+	})
+	return messages
+}
+
+// RESPONSE_FORMAT_JSON 要求模型输出JSON对象
+const RESPONSE_FORMAT_JSON = "json_object"
+
+// ResponseFormat 输出格式
+type ResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// newResponseFormat 根据选项生成输出格式，未指定时返回nil
+func newResponseFormat(format string) *ResponseFormat {
+	if format == "" {
+		return nil
+	}
+	return &ResponseFormat{Type: format}
 }
 
 // ChatRequest 聊天请求结构
 type ChatRequest struct {
-	Model            string    `json:"model"`
-	Messages         []Message `json:"messages"`
-	MaxTokens        int       `json:"max_tokens,omitempty"`
-	Temperature      float64   `json:"temperature,omitempty"`
-	TopP             float64   `json:"top_p,omitempty"`
-	Stream           bool      `json:"stream,omitempty"`
-	PresencePenalty  float64   `json:"presence_penalty,omitempty"`
-	FrequencyPenalty float64   `json:"frequency_penalty,omitempty"`
+	Model            string          `json:"model"`
+	Messages         []Message       `json:"messages"`
+	MaxTokens        int             `json:"max_tokens,omitempty"`
+	Temperature      float64         `json:"temperature,omitempty"`
+	TopP             float64         `json:"top_p,omitempty"`
+	Stream           bool            `json:"stream,omitempty"`
+	PresencePenalty  float64         `json:"presence_penalty,omitempty"`
+	FrequencyPenalty float64         `json:"frequency_penalty,omitempty"`
+	ResponseFormat   *ResponseFormat `json:"response_format,omitempty"`
 }
 
 // ChatResponse 聊天响应结构
@@ -133,15 +195,7 @@ type StreamResponse struct {
 }
 
 // GenerateStreamResponse 实现流式回复
-func (c *ZhipuClient) GenerateStreamResponse(prompt string, history []Message, callback func(chunk string, isEnd bool, err error) bool) error {
-	// 构建消息列表
-	messages := make([]Message, 0, len(history)+1)
-	messages = append(messages, history...)
-	messages = append(messages, Message{
-		Role:    "user",
-		Content: prompt,
-	})
-
+func (c *ZhipuClient) GenerateStreamResponse(req *GenerateRequest, callback func(chunk string, isEnd bool, err error) bool) (*TokenUsage, error) {
 	// 创建流式请求选项
 	streamOptions := &ChatCompletionOptions{
 		MaxTokens:        c.Options.MaxTokens,
@@ -151,13 +205,16 @@ func (c *ZhipuClient) GenerateStreamResponse(prompt string, history []Message, c
 		FrequencyPenalty: c.Options.FrequencyPenalty,
 		Stream:           true, // 启用流式响应
 	}
+	if req.JSONMode {
+		streamOptions.ResponseFormat = RESPONSE_FORMAT_JSON
+	}
 
 	// 调用流式聊天补全API
-	return c.ChatCompletionStream(c.Model, messages, streamOptions, callback)
+	return c.ChatCompletionStream(req.Ctx(), c.Model, buildZhipuMessages(req), streamOptions, callback)
 }
 
-// ChatCompletionStream 流式聊天补全
-func (c *ZhipuClient) ChatCompletionStream(model string, messages []Message, options *ChatCompletionOptions, callback func(chunk string, isEnd bool, err error) bool) error {
+// ChatCompletionStream 流式聊天补全，ctx结束时停止接收，返回最后一个数据包中的Token用量
+func (c *ZhipuClient) ChatCompletionStream(ctx context.Context, model string, messages []Message, options *ChatCompletionOptions, callback func(chunk string, isEnd bool, err error) bool) (*TokenUsage, error) {
 	if model == "" {
 		model = "glm-4" // 默认使用GLM-4模型
 	}
@@ -182,23 +239,24 @@ func (c *ZhipuClient) ChatCompletionStream(model string, messages []Message, opt
 		Stream:           true, // 强制设置为流式
 		PresencePenalty:  options.PresencePenalty,
 		FrequencyPenalty: options.FrequencyPenalty,
+		ResponseFormat:   newResponseFormat(options.ResponseFormat),
 	}
 
 	reqBody, err := json.Marshal(chatReq)
 	if err != nil {
-		return fmt.Errorf("请求数据序列化失败: %v", err)
+		return nil, fmt.Errorf("请求数据序列化失败: %v", err)
 	}
 
 	// 生成Token
 	token, err := c.generateToken()
 	if err != nil {
-		return fmt.Errorf("生成Token失败: %v", err)
+		return nil, fmt.Errorf("生成Token失败: %v", err)
 	}
 
 	// 构建HTTP请求
-	req, err := http.NewRequest("POST", c.BaseURL, bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL, bytes.NewBuffer(reqBody))
 	if err != nil {
-		return fmt.Errorf("创建HTTP请求失败: %v", err)
+		return nil, fmt.Errorf("创建HTTP请求失败: %v", err)
 	}
 
 	// 设置请求头
@@ -211,27 +269,29 @@ func (c *ZhipuClient) ChatCompletionStream(model string, messages []Message, opt
 	client := &http.Client{Timeout: time.Second * 300} // 增加超时时间以支持流式响应
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("发送请求失败: %v", err)
+		return nil, fmt.Errorf("发送请求失败: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// 检查HTTP状态码
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API请求失败，状态码: %d，响应: %s", resp.StatusCode, string(respBody))
+		return nil, fmt.Errorf("API请求失败，状态码: %d，响应: %s", resp.StatusCode, string(respBody))
 	}
 
 	// 处理流式响应
-	return c.parseStreamResponse(resp.Body, callback)
+	return c.parseStreamResponse(ctx, resp.Body, callback)
 }
 
 // parseStreamResponse 解析流式响应
-func (c *ZhipuClient) parseStreamResponse(body io.Reader, callback func(chunk string, isEnd bool, err error) bool) error {
+// ctx结束（用户停止生成或客户端断开）导致读取中断时按正常结束处理，已生成的内容由调用方保存
+func (c *ZhipuClient) parseStreamResponse(ctx context.Context, body io.Reader, callback func(chunk string, isEnd bool, err error) bool) (*TokenUsage, error) {
 	const (
 		dataPrefix = "data: "
 		doneMarker = "[DONE]"
 	)
 
+	var usage *TokenUsage
 	scanner := bufio.NewScanner(body)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -262,6 +322,14 @@ func (c *ZhipuClient) parseStreamResponse(body io.Reader, callback func(chunk st
 				continue
 			}
 
+			// 最后一个数据包携带本次请求的Token用量
+			if streamResp.Usage != nil {
+				usage = &TokenUsage{
+					PromptTokens:     streamResp.Usage.PromptTokens,
+					CompletionTokens: streamResp.Usage.CompletionTokens,
+				}
+			}
+
 			// 提取内容并发送到回调函数
 			if len(streamResp.Choices) > 0 {
 				content := streamResp.Choices[0].Delta.Content
@@ -293,10 +361,14 @@ func (c *ZhipuClient) parseStreamResponse(body io.Reader, callback func(chunk st
 	}
 
 	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("读取流式响应失败: %v", err)
+		if ctx.Err() != nil {
+			callback("", true, nil)
+			return usage, nil
+		}
+		return usage, fmt.Errorf("读取流式响应失败: %v", err)
 	}
 
-	return nil
+	return usage, nil
 }
 
 // 生成JWT Token
@@ -356,6 +428,7 @@ func (c *ZhipuClient) ChatCompletion(model string, messages []Message, options *
 		Stream:           options.Stream,
 		PresencePenalty:  options.PresencePenalty,
 		FrequencyPenalty: options.FrequencyPenalty,
+		ResponseFormat:   newResponseFormat(options.ResponseFormat),
 	}
 
 	reqBody, err := json.Marshal(chatReq)
@@ -4,6 +4,7 @@ import (
 	"chatbot-app/backend/config"
 	"chatbot-app/backend/models"
 	"fmt"
+	"sync"
 )
 
 // 定义支持的AI提供商常量
@@ -14,6 +15,22 @@ const (
 	ProviderCoze = "coze"
 )
 
+// ClientProvider 根据模型配置创建AI客户端
+type ClientProvider func(model *models.AIModel) (AIClient, error)
+
+var (
+	clientProviders   = make(map[string]ClientProvider)
+	clientProvidersMu sync.RWMutex
+)
+
+// RegisterClientProvider 注册AI提供商的客户端
+// 依赖业务服务的客户端（如Coze）位于services包，utils不能直接引用，由services在初始化时注册
+func RegisterClientProvider(provider string, clientProvider ClientProvider) {
+	clientProvidersMu.Lock()
+	defer clientProvidersMu.Unlock()
+	clientProviders[provider] = clientProvider
+}
+
 // AIClientFactory AI客户端工厂
 type AIClientFactory struct {
 	// 配置实例
@@ -33,14 +50,20 @@ func (f *AIClientFactory) CreateClient(model *models.AIModel) (AIClient, error)
 		return nil, fmt.Errorf("模型配置不能为空")
 	}
 
+	// 优先使用其他包注册的客户端
+	clientProvidersMu.RLock()
+	provider, ok := clientProviders[model.Provider]
+	clientProvidersMu.RUnlock()
+	if ok {
+		return provider(model)
+	}
+
 	switch model.Provider {
 	case ProviderZhipu:
 		return f.createZhipuClient(model)
 	case ProviderOpenAI:
 		// TODO: 实现OpenAI客户端
 		return nil, fmt.Errorf("OpenAI客户端暂未实现")
-	case ProviderCoze:
-		return f.createCozeClient(model)
 	default:
 		return nil, fmt.Errorf("不支持的AI提供商: %s", model.Provider)
 	}
@@ -72,16 +95,6 @@ func (f *AIClientFactory) createZhipuClient(model *models.AIModel) (AIClient, er
 	return client, nil
 }
 
-// createCozeClient 创建Coze客户端
-func (f *AIClientFactory) createCozeClient(model *models.AIModel) (AIClient, error) {
-	// 创建Coze适配器，延迟初始化客户端
-	adapter := &CozeClientAdapter{
-		model: model,
-	}
-
-	return adapter, nil
-}
-
 // createOpenAIClient 创建OpenAI客户端（预留）
 // func (f *AIClientFactory) createOpenAIClient(model *models.AIModel) (AIClient, error) {
 // 	// 从配置获取API Key
@@ -123,20 +136,3 @@ func ConvertHistoryMessages(history []map[string]string) []Message {
 	}
 	return messages
 }
-
-// CozeClientAdapter Coze客户端适配器，实现AIClient接口
-type CozeClientAdapter struct {
-	model *models.AIModel
-}
-
-// GenerateResponse 生成回复
-func (adapter *CozeClientAdapter) GenerateResponse(prompt string, history []Message) (string, error) {
-	return "", fmt.Errorf("Coze非流式对话暂未实现，请使用流式模式")
-}
-
-// GenerateStreamResponse 生成流式回复
-func (adapter *CozeClientAdapter) GenerateStreamResponse(prompt string, history []Message, callback func(chunk string, isEnd bool, err error) bool) error {
-	// 注意：这里需要通过服务层来调用coze功能，避免循环导入
-	// 实际的coze调用应该在services层处理
-	return fmt.Errorf("Coze客户端适配器需要通过服务层调用，请使用CozeService")
-}
@@ -3,25 +3,25 @@ package coze
 import (
 	"chatbot-app/backend/models"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/coze-dev/coze-go"
 )
 
-func (conversation *Client) CreateConversation() (string, error) {
+// CreateConversation 创建Coze会话，metaData为会话的附加信息
+func (conversation *Client) CreateConversation(metaData map[string]string) (string, error) {
 	botID := conversation.BotID
 	if botID == "" {
 		botID = conversation.Config.BotID
 	}
 	ctx := context.Background()
-	metaData := map[string]string{
-		"user_id":    "157",
-		"user_phone": "13207171044",
-	}
 	resp, err := conversation.Api.Conversations.Create(ctx, &coze.CreateConversationsReq{BotID: botID, MetaData: metaData})
 	if err != nil {
 		return "", fmt.Errorf("创建对话失败: %v", err)
@@ -95,10 +95,221 @@ func (conversation *Client) SendMessageStream(conversationID string, message str
 	return nil, nil
 }
 
+// MAX_TOOL_CALL_ROUNDS 单次对话中最多提交工具结果的轮数，防止死循环
+const MAX_TOOL_CALL_ROUNDS = 10
+
+// ToolCall 智能体要求本地执行的工具调用
+type ToolCall struct {
+	ID        string // 工具调用Id，提交结果时使用
+	Name      string // 方法名称
+	Arguments string // 方法参数(JSON)
+}
+
+// ToolOutput 工具调用的执行结果
+type ToolOutput struct {
+	ToolCallID string
+	Output     string
+}
+
+// ToolCallHandler 执行工具调用并返回结果
+type ToolCallHandler func(toolCalls []*ToolCall) []*ToolOutput
+
 // SendMessageStreamWithCallback 发送流式消息并通过回调函数处理事件
-func (conversation *Client) SendMessageStreamWithCallback(conversationID string, userID uint, messageList []*models.Message, onMessage func(eventType string, data interface{})) error {
+// onToolCalls不为空时，智能体要求执行本地工具会调用它并将结果提交给Coze，继续在同一回调中输出回复；
+// ctx结束时取消Coze侧的对话并以canceled状态结束
+func (conversation *Client) SendMessageStreamWithCallback(ctx context.Context, conversationID string, userID uint, messageList []*models.Message, onMessage func(eventType string, data interface{}), onToolCalls ToolCallHandler) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*2)
+	defer cancel()
+	req := conversation.buildChatRequest(conversationID, userID, messageList)
+
+	resp, err := conversation.Api.Chat.Stream(ctx, req)
+	if err != nil {
+		return fmt.Errorf("创建流式对话失败: %v", err)
+	}
+
+	for round := 0; ; round++ {
+		pendingChat, err := conversation.handleChatStream(ctx, resp, onMessage, onToolCalls != nil)
+		if err != nil {
+			return err
+		}
+		if pendingChat == nil {
+			return nil
+		}
+		if round >= MAX_TOOL_CALL_ROUNDS {
+			return fmt.Errorf("工具调用轮数超过上限: %d", MAX_TOOL_CALL_ROUNDS)
+		}
+
+		// 执行本地工具并提交结果，继续接收后续回复
+		toolCalls := convertToolCalls(pendingChat)
+		onMessage("tool_calls", map[string]interface{}{
+			"chat_id":    pendingChat.ID,
+			"tool_calls": toolCalls,
+		})
+
+		resp, err = conversation.Api.Chat.StreamSubmitToolOutputs(ctx, &coze.SubmitToolOutputsChatReq{
+			ConversationID: pendingChat.ConversationID,
+			ChatID:         pendingChat.ID,
+			ToolOutputs:    convertToolOutputs(onToolCalls(toolCalls)),
+		})
+		if err != nil {
+			return fmt.Errorf("提交工具执行结果失败: %v", err)
+		}
+	}
+}
+
+// CHAT_POLL_INTERVAL 非流式对话轮询对话状态的间隔
+const CHAT_POLL_INTERVAL = time.Second
+
+// ChatUsage 一次对话消耗的Token
+type ChatUsage struct {
+	InputCount  int `json:"input_count"`
+	OutputCount int `json:"output_count"`
+	TokenCount  int `json:"token_count"`
+}
+
+// ChatResult 非流式对话的结果
+type ChatResult struct {
+	ConversationID string
+	ChatID         string
+	Content        string // 智能体的回复，多条回复按顺序拼接
+	Usage          ChatUsage
+}
+
+// SendMessageAndWait 发起非流式对话并等待对话结束，返回智能体的回复和Token用量
+// conversationID为空时Coze会创建临时会话；onToolCalls不为空时，智能体要求执行本地工具会调用它并提交结果
+func (conversation *Client) SendMessageAndWait(conversationID string, userID uint, messageList []*models.Message, onToolCalls ToolCallHandler) (*ChatResult, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
 	defer cancel()
+
+	resp, err := conversation.Api.Chat.Create(ctx, conversation.buildChatRequest(conversationID, userID, messageList))
+	if err != nil {
+		return nil, fmt.Errorf("创建对话失败: %v", err)
+	}
+	chat := resp.Chat
+
+	ticker := time.NewTicker(CHAT_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for round := 0; ; {
+		switch chat.Status {
+		case coze.ChatStatusCompleted:
+			return conversation.collectChatResult(ctx, &chat)
+		case coze.ChatStatusFailed:
+			if chat.LastError != nil {
+				return nil, fmt.Errorf("对话失败: code %d, msg %s", chat.LastError.Code, chat.LastError.Msg)
+			}
+			return nil, fmt.Errorf("对话执行失败")
+		case coze.ChatStatusCancelled:
+			return nil, fmt.Errorf("对话已取消")
+		case coze.ChatStatusRequiresAction:
+			action := chat.RequiredAction
+			if onToolCalls == nil || action == nil || action.SubmitToolOutputs == nil || len(action.SubmitToolOutputs.ToolCalls) == 0 {
+				conversation.cancelChat(chat.ConversationID, chat.ID)
+				return nil, fmt.Errorf("智能体需要执行本地工具，但未提供工具处理")
+			}
+			if round >= MAX_TOOL_CALL_ROUNDS {
+				conversation.cancelChat(chat.ConversationID, chat.ID)
+				return nil, fmt.Errorf("工具调用轮数超过上限: %d", MAX_TOOL_CALL_ROUNDS)
+			}
+			round++
+
+			submitResp, err := conversation.Api.Chat.SubmitToolOutputs(ctx, &coze.SubmitToolOutputsChatReq{
+				ConversationID: chat.ConversationID,
+				ChatID:         chat.ID,
+				ToolOutputs:    convertToolOutputs(onToolCalls(convertToolCalls(&chat))),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("提交工具执行结果失败: %v", err)
+			}
+			chat = submitResp.Chat
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			// 超时后取消Coze侧的对话，避免继续消耗Token
+			conversation.cancelChat(chat.ConversationID, chat.ID)
+			return nil, fmt.Errorf("等待对话结果超时")
+		case <-ticker.C:
+		}
+
+		retrieveResp, err := conversation.Api.Chat.Retrieve(ctx, &coze.RetrieveChatsReq{
+			ConversationID: chat.ConversationID,
+			ChatID:         chat.ID,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				conversation.cancelChat(chat.ConversationID, chat.ID)
+				return nil, fmt.Errorf("等待对话结果超时")
+			}
+			return nil, fmt.Errorf("查询对话状态失败: %v", err)
+		}
+		chat = retrieveResp.Chat
+	}
+}
+
+// collectChatResult 读取已完成对话的消息，拼接智能体的回复
+func (conversation *Client) collectChatResult(ctx context.Context, chat *coze.Chat) (*ChatResult, error) {
+	listResp, err := conversation.Api.Chat.Messages.List(ctx, &coze.ListChatsMessagesReq{
+		ConversationID: chat.ConversationID,
+		ChatID:         chat.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取对话消息失败: %v", err)
+	}
+
+	var answers []string
+	for _, message := range listResp.Messages {
+		if message.Type == coze.MessageTypeAnswer && message.Content != "" {
+			answers = append(answers, message.Content)
+		}
+	}
+
+	result := &ChatResult{
+		ConversationID: chat.ConversationID,
+		ChatID:         chat.ID,
+		Content:        strings.Join(answers, "\n\n"),
+	}
+	if chat.Usage != nil {
+		result.Usage = ChatUsage{
+			InputCount:  chat.Usage.InputCount,
+			OutputCount: chat.Usage.OutputCount,
+			TokenCount:  chat.Usage.TokenCount,
+		}
+	}
+	return result, nil
+}
+
+// abortChatStream 请求结束时取消Coze侧的对话，避免继续生成和计费
+// 主动取消时以canceled状态结束对话，超时返回错误
+func (conversation *Client) abortChatStream(ctx context.Context, conversationID string, chatID string, onMessage func(eventType string, data interface{})) error {
+	if chatID != "" {
+		conversation.cancelChat(conversationID, chatID)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("流式对话超时")
+	}
+	onMessage("conversation_end", map[string]string{
+		"status":  "canceled",
+		"chat_id": chatID,
+	})
+	return nil
+}
+
+// cancelChat 取消进行中的对话，失败时只记录日志
+func (conversation *Client) cancelChat(conversationID string, chatID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := conversation.Api.Chat.Cancel(ctx, &coze.CancelChatsReq{
+		ConversationID: conversationID,
+		ChatID:         chatID,
+	}); err != nil {
+		log.Printf("取消Coze对话失败: %v", err)
+	}
+}
+
+// buildChatRequest 将本地消息转换为Coze对话请求
+func (conversation *Client) buildChatRequest(conversationID string, userID uint, messageList []*models.Message) *coze.CreateChatsReq {
 	cozeMessageList := make([]*coze.Message, 0, len(messageList))
 	for _, message := range messageList {
 		var messageType coze.MessageType
@@ -107,6 +318,10 @@ func (conversation *Client) SendMessageStreamWithCallback(conversationID string,
 		} else if message.Role == "assistant" {
 			messageType = coze.MessageTypeAnswer
 		}
+		if message.Role == "user" && len(message.Files) > 0 {
+			cozeMessageList = append(cozeMessageList, buildObjectMessage(message))
+			continue
+		}
 		cozeMessageList = append(cozeMessageList, &coze.Message{
 			Role:    coze.MessageRole(message.Role),
 			Content: message.Content,
@@ -117,44 +332,116 @@ func (conversation *Client) SendMessageStreamWithCallback(conversationID string,
 	if botID == "" {
 		botID = conversation.Config.BotID
 	}
-	req := &coze.CreateChatsReq{
+	return &coze.CreateChatsReq{
 		BotID:          botID,
 		ConversationID: conversationID,
 		UserID:         strconv.FormatUint(uint64(userID), 10),
 		Messages:       cozeMessageList,
 	}
+}
 
-	resp, err := conversation.Api.Chat.Stream(ctx, req)
-	if err != nil {
-		return fmt.Errorf("创建流式对话失败: %v", err)
+// convertToolCalls 提取对话中要求执行的工具调用
+func convertToolCalls(chat *coze.Chat) []*ToolCall {
+	toolCalls := make([]*ToolCall, 0, len(chat.RequiredAction.SubmitToolOutputs.ToolCalls))
+	for _, toolCall := range chat.RequiredAction.SubmitToolOutputs.ToolCalls {
+		call := &ToolCall{ID: toolCall.ID}
+		if toolCall.Function != nil {
+			call.Name = toolCall.Function.Name
+			call.Arguments = toolCall.Function.Arguments
+		}
+		toolCalls = append(toolCalls, call)
 	}
+	return toolCalls
+}
+
+// convertToolOutputs 将工具执行结果转换为Coze的提交格式
+func convertToolOutputs(outputs []*ToolOutput) []*coze.ToolOutput {
+	toolOutputs := make([]*coze.ToolOutput, 0, len(outputs))
+	for _, output := range outputs {
+		toolOutputs = append(toolOutputs, &coze.ToolOutput{
+			ToolCallID: output.ToolCallID,
+			Output:     output.Output,
+		})
+	}
+	return toolOutputs
+}
+
+// buildObjectMessage 将带附件的用户消息转换为多模态消息，图片使用图片对象，其余使用文件对象
+func buildObjectMessage(message *models.Message) *coze.Message {
+	objects := make([]*coze.MessageObjectString, 0, len(message.Files)+1)
+	if message.Content != "" {
+		objects = append(objects, coze.NewTextMessageObject(message.Content))
+	}
+	for _, file := range message.Files {
+		if file.CozeFileId == "" {
+			continue
+		}
+		if strings.HasPrefix(file.MimeType, "image/") {
+			objects = append(objects, coze.NewImageMessageObjectByID(file.CozeFileId))
+		} else {
+			objects = append(objects, coze.NewFileMessageObjectByID(file.CozeFileId))
+		}
+	}
+	return coze.BuildUserQuestionObjects(objects, nil)
+}
+
+// handleChatStream 处理一次对话流的事件
+// 需要提交工具结果时返回对应的对话，流式对话正常结束或被取消时返回nil
+func (conversation *Client) handleChatStream(ctx context.Context, resp coze.Stream[coze.ChatEvent], onMessage func(eventType string, data interface{}), handleToolCalls bool) (*coze.Chat, error) {
 	defer resp.Close()
 
+	var pendingChat *coze.Chat
+	var conversationID, chatID string // 进行中的对话，取消时使用
 	for {
+		if ctx.Err() != nil {
+			return nil, conversation.abortChatStream(ctx, conversationID, chatID, onMessage)
+		}
+
 		event, err := resp.Recv()
 		if errors.Is(err, io.EOF) {
+			if pendingChat != nil {
+				return pendingChat, nil
+			}
 			// 流式对话结束
 			onMessage("conversation_end", map[string]string{
 				"status": "completed",
 				"log_id": resp.Response().LogID(),
 			})
-			break
+			return nil, nil
 		}
 
 		if err != nil {
-			return fmt.Errorf("流式对话失败: %v", err)
+			if ctx.Err() != nil {
+				return nil, conversation.abortChatStream(ctx, conversationID, chatID, onMessage)
+			}
+			return nil, fmt.Errorf("流式对话失败: %v", err)
+		}
+		if event.Chat != nil && event.Chat.ID != "" {
+			conversationID, chatID = event.Chat.ConversationID, event.Chat.ID
 		}
 
 		// 根据不同的事件类型调用回调函数
 		switch event.Event {
 		case coze.ChatEventConversationMessageDelta:
-			// 消息增量更新
+			// 消息增量更新，推理模型的思考过程在reasoning_content中单独返回
 			if event.Message != nil {
-				onMessage("message_delta", map[string]interface{}{
-					"content": event.Message.Content,
-					"role":    event.Message.Role,
-					"type":    event.Message.Type,
-				})
+				if event.Message.ReasoningContent != "" {
+					onMessage("reasoning_delta", map[string]interface{}{
+						"content": event.Message.ReasoningContent,
+					})
+				}
+				if event.Message.Content != "" {
+					onMessage("message_delta", map[string]interface{}{
+						"content": event.Message.Content,
+						"role":    event.Message.Role,
+						"type":    event.Message.Type,
+					})
+				}
+			}
+		case coze.ChatEventConversationMessageCompleted:
+			// 回复内容已通过增量推送，这里只转发推荐问题和过程信息
+			if event.Message != nil {
+				handleCompletedMessage(event.Message, onMessage)
 			}
 		case coze.ChatEventConversationChatCompleted:
 			// 对话完成
@@ -173,9 +460,14 @@ func (conversation *Client) SendMessageStreamWithCallback(conversationID string,
 				"error_msg":  event.Chat.LastError.Msg,
 			})
 		case coze.ChatEventConversationChatRequiresAction:
-			// 需要用户操作
+			// 需要执行本地工具
+			action := event.Chat.RequiredAction
+			if handleToolCalls && action != nil && action.SubmitToolOutputs != nil && len(action.SubmitToolOutputs.ToolCalls) > 0 {
+				pendingChat = event.Chat
+				continue
+			}
 			onMessage("requires_action", map[string]interface{}{
-				"action": event.Chat.RequiredAction,
+				"action": action,
 			})
 		default:
 			// 其他事件
@@ -185,6 +477,45 @@ func (conversation *Client) SendMessageStreamWithCallback(conversationID string,
 			})
 		}
 	}
+}
 
-	return nil
+// MESSAGE_TYPE_VERBOSE 智能体的过程信息消息，如知识库召回、回复结束标记，SDK未定义该类型
+const MESSAGE_TYPE_VERBOSE coze.MessageType = "verbose"
+
+// verboseGenerateAnswerFinish 回复结束标记，不转发给客户端
+const verboseGenerateAnswerFinish = "generate_answer_finish"
+
+// handleCompletedMessage 转发已完成消息中的推荐问题、插件调用和过程信息
+func handleCompletedMessage(message *coze.Message, onMessage func(eventType string, data interface{})) {
+	switch message.Type {
+	case coze.MessageTypeFollowUp:
+		onMessage("follow_up", map[string]interface{}{
+			"content": message.Content,
+		})
+	case coze.MessageTypeFunctionCall, coze.MessageTypeToolOutput, coze.MessageTypeToolResponse:
+		onMessage("verbose", map[string]interface{}{
+			"type":    string(message.Type),
+			"content": message.Content,
+		})
+	case MESSAGE_TYPE_VERBOSE:
+		// content为JSON，msg_type区分具体的过程类型
+		var verbose struct {
+			MsgType string `json:"msg_type"`
+			Data    string `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(message.Content), &verbose); err != nil || verbose.MsgType == "" {
+			onMessage("verbose", map[string]interface{}{
+				"type":    string(message.Type),
+				"content": message.Content,
+			})
+			return
+		}
+		if verbose.MsgType == verboseGenerateAnswerFinish {
+			return
+		}
+		onMessage("verbose", map[string]interface{}{
+			"type":    verbose.MsgType,
+			"content": verbose.Data,
+		})
+	}
 }
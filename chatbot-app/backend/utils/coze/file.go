@@ -42,3 +42,15 @@ func (client *Client) Upload(file io.Reader) (string, error) {
 
 	return uploadResp.FileInfo.ID, nil
 }
+
+// UploadWithName 以指定文件名上传文件到Coze，Coze根据扩展名识别文件类型
+func (client *Client) UploadWithName(file io.Reader, fileName string) (string, error) {
+	uploadResp, err := client.Api.Files.Upload(context.Background(), &coze.UploadFilesReq{
+		File: coze.NewUploadFile(file, fileName),
+	})
+	if err != nil {
+		return "", fmt.Errorf("上传文件失败: %v", err)
+	}
+
+	return uploadResp.FileInfo.ID, nil
+}
@@ -1,5 +1,302 @@
 package coze
 
-func (knowledge *Client) UpdateKnowledge(knowledgeID string, fileId string) error {
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+)
+
+// 知识库类型
+const (
+	KNOWLEDGE_FORMAT_DOCUMENT    = int(coze.DocumentFormatTypeDocument)    // 文本
+	KNOWLEDGE_FORMAT_SPREADSHEET = int(coze.DocumentFormatTypeSpreadsheet) // 表格
+	KNOWLEDGE_FORMAT_IMAGE       = int(coze.DocumentFormatTypeImage)       // 图片
+)
+
+// 文档处理状态
+const (
+	DOCUMENT_STATUS_PROCESSING = int(coze.DocumentStatusProcessing)
+	DOCUMENT_STATUS_COMPLETED  = int(coze.DocumentStatusCompleted)
+	DOCUMENT_STATUS_FAILED     = int(coze.DocumentStatusFailed)
+)
+
+// documentSourceFileID 通过文件上传接口得到的file_id创建文档
+const documentSourceFileID = 5
+
+// Knowledge 知识库信息
+type Knowledge struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	FormatType  int    `json:"format_type"`
+	Status      int    `json:"status"`
+	DocCount    int    `json:"doc_count"`
+	SliceCount  int    `json:"slice_count"`
+	HitCount    int    `json:"hit_count"`
+	CreateTime  int    `json:"create_time"`
+	UpdateTime  int    `json:"update_time"`
+}
+
+// KnowledgeDocument 知识库文档
+type KnowledgeDocument struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Size       int    `json:"size"`
+	CharCount  int    `json:"char_count"`
+	SliceCount int    `json:"slice_count"`
+	HitCount   int    `json:"hit_count"`
+	Status     int    `json:"status"`
+	CreateTime int    `json:"create_time"`
+	UpdateTime int    `json:"update_time"`
+}
+
+// DocumentProgress 文档处理进度
+type DocumentProgress struct {
+	DocumentID     string `json:"document_id"`
+	DocumentName   string `json:"document_name"`
+	Status         int    `json:"status"`
+	Progress       int    `json:"progress"`
+	RemainingTime  int    `json:"remaining_time"`
+	StatusDescript string `json:"status_descript"`
+}
+
+// CreateKnowledge 在工作空间中创建知识库，返回知识库Id
+func (knowledge *Client) CreateKnowledge(name string, description string, formatType int) (string, error) {
+	if knowledge.Config.SpaceID == "" {
+		return "", fmt.Errorf("未配置Coze工作空间Id，请设置COZE_SPACE_ID环境变量")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	resp, err := knowledge.Api.Datasets.Create(ctx, &coze.CreateDatasetsReq{
+		Name:        name,
+		SpaceID:     knowledge.Config.SpaceID,
+		FormatType:  coze.DocumentFormatType(formatType),
+		Description: description,
+	})
+	if err != nil {
+		return "", fmt.Errorf("创建知识库失败: %v", err)
+	}
+	return resp.DatasetID, nil
+}
+
+// ListKnowledge 分页查询工作空间中的知识库
+func (knowledge *Client) ListKnowledge(name string, page int, size int) ([]*Knowledge, int, error) {
+	if knowledge.Config.SpaceID == "" {
+		return nil, 0, fmt.Errorf("未配置Coze工作空间Id，请设置COZE_SPACE_ID环境变量")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req := coze.NewListDatasetsReq(knowledge.Config.SpaceID)
+	req.Name = name
+	req.PageNum = page
+	req.PageSize = size
+	paged, err := knowledge.Api.Datasets.List(ctx, req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询知识库失败: %v", err)
+	}
+
+	items := paged.Items()
+	list := make([]*Knowledge, 0, len(items))
+	for _, item := range items {
+		list = append(list, &Knowledge{
+			ID:          item.ID,
+			Name:        item.Name,
+			Description: item.Description,
+			FormatType:  int(item.FormatType),
+			Status:      int(item.Status),
+			DocCount:    item.DocCount,
+			SliceCount:  item.SliceCount,
+			HitCount:    item.HitCount,
+			CreateTime:  item.CreateTime,
+			UpdateTime:  item.UpdateTime,
+		})
+	}
+	return list, paged.Total(), nil
+}
+
+// DeleteKnowledge 删除知识库，知识库中的文档会一并删除
+func (knowledge *Client) DeleteKnowledge(knowledgeID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := knowledge.Api.Datasets.Delete(ctx, &coze.DeleteDatasetsReq{DatasetID: knowledgeID}); err != nil {
+		return fmt.Errorf("删除知识库失败: %v", err)
+	}
+	return nil
+}
+
+// UploadDocument 上传文档到知识库
+// 图片知识库先通过Upload上传文件再按file_id创建文档，文本和表格知识库只支持以Base64内容创建
+func (knowledge *Client) UploadDocument(knowledgeID string, formatType int, fileName string, file io.Reader) (*KnowledgeDocument, error) {
+	if formatType == KNOWLEDGE_FORMAT_IMAGE {
+		fileID, err := knowledge.Upload(file)
+		if err != nil {
+			return nil, err
+		}
+		sourceFileID, err := parseFileID(fileID)
+		if err != nil {
+			return nil, err
+		}
+		return knowledge.createDocument(knowledgeID, formatType, &coze.DocumentBase{
+			Name: fileName,
+			SourceInfo: &coze.DocumentSourceInfo{
+				SourceFileID:   sourceFileID,
+				DocumentSource: intPtr(documentSourceFileID),
+			},
+		})
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件内容失败: %v", err)
+	}
+	fileType := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	encoded := base64.StdEncoding.EncodeToString(content)
+	return knowledge.createDocument(knowledgeID, formatType, &coze.DocumentBase{
+		Name: fileName,
+		SourceInfo: &coze.DocumentSourceInfo{
+			FileBase64: &encoded,
+			FileType:   &fileType,
+		},
+	})
+}
+
+// createDocument 创建知识库文档，使用自动分段
+func (knowledge *Client) createDocument(knowledgeID string, formatType int, documentBase *coze.DocumentBase) (*KnowledgeDocument, error) {
+	datasetID, err := strconv.ParseInt(knowledgeID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("无效的知识库Id: %s", knowledgeID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	resp, err := knowledge.Api.Datasets.Documents.Create(ctx, &coze.CreateDatasetsDocumentsReq{
+		DatasetID:     datasetID,
+		DocumentBases: []*coze.DocumentBase{documentBase},
+		ChunkStrategy: &coze.DocumentChunkStrategy{ChunkType: 0},
+		FormatType:    coze.DocumentFormatType(formatType),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建知识库文档失败: %v", err)
+	}
+	if len(resp.DocumentInfos) == 0 {
+		return nil, fmt.Errorf("创建知识库文档失败: 未返回文档信息")
+	}
+	return convertDocument(resp.DocumentInfos[0]), nil
+}
+
+// ListDocuments 分页查询知识库中的文档
+func (knowledge *Client) ListDocuments(knowledgeID string, page int, size int) ([]*KnowledgeDocument, int, error) {
+	datasetID, err := strconv.ParseInt(knowledgeID, 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("无效的知识库Id: %s", knowledgeID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	paged, err := knowledge.Api.Datasets.Documents.List(ctx, &coze.ListDatasetsDocumentsReq{
+		DatasetID: datasetID,
+		Page:      page,
+		Size:      size,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询知识库文档失败: %v", err)
+	}
+
+	items := paged.Items()
+	list := make([]*KnowledgeDocument, 0, len(items))
+	for _, item := range items {
+		list = append(list, convertDocument(item))
+	}
+	return list, paged.Total(), nil
+}
+
+// DeleteDocuments 删除知识库文档
+func (knowledge *Client) DeleteDocuments(documentIDs []string) error {
+	ids := make([]int64, 0, len(documentIDs))
+	for _, documentID := range documentIDs {
+		id, err := strconv.ParseInt(documentID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("无效的文档Id: %s", documentID)
+		}
+		ids = append(ids, id)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := knowledge.Api.Datasets.Documents.Delete(ctx, &coze.DeleteDatasetsDocumentsReq{DocumentIDs: ids}); err != nil {
+		return fmt.Errorf("删除知识库文档失败: %v", err)
+	}
 	return nil
 }
+
+// GetDocumentProgress 查询文档的处理进度
+func (knowledge *Client) GetDocumentProgress(knowledgeID string, documentIDs []string) ([]*DocumentProgress, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	resp, err := knowledge.Api.Datasets.Process(ctx, &coze.ProcessDocumentsReq{
+		DatasetID:   knowledgeID,
+		DocumentIDs: documentIDs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询文档处理进度失败: %v", err)
+	}
+
+	list := make([]*DocumentProgress, 0, len(resp.Data))
+	for _, item := range resp.Data {
+		list = append(list, &DocumentProgress{
+			DocumentID:     item.DocumentID,
+			DocumentName:   item.DocumentName,
+			Status:         int(item.Status),
+			Progress:       item.Progress,
+			RemainingTime:  item.RemainingTime,
+			StatusDescript: item.StatusDescript,
+		})
+	}
+	return list, nil
+}
+
+// convertDocument 转换SDK返回的文档信息
+func convertDocument(document *coze.Document) *KnowledgeDocument {
+	return &KnowledgeDocument{
+		ID:         document.DocumentID,
+		Name:       document.Name,
+		Type:       document.Type,
+		Size:       document.Size,
+		CharCount:  document.CharCount,
+		SliceCount: document.SliceCount,
+		HitCount:   document.HitCount,
+		Status:     int(document.Status),
+		CreateTime: document.CreateTime,
+		UpdateTime: document.UpdateTime,
+	}
+}
+
+// parseFileID 将上传接口返回的文件Id转换为数字
+func parseFileID(fileID string) (*int64, error) {
+	id, err := strconv.ParseInt(fileID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("无效的文件Id: %s", fileID)
+	}
+	return &id, nil
+}
+
+func intPtr(v int) *int {
+	return &v
+}
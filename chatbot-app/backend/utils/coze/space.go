@@ -0,0 +1,89 @@
+package coze
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+)
+
+// SPACE_LIST_PAGE_SIZE 遍历工作空间时每页拉取的数量
+const SPACE_LIST_PAGE_SIZE = 50
+
+// SpaceObject 工作空间中已发布的智能体或工作流
+type SpaceObject struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ListPublishedBots 遍历工作空间中所有已发布的智能体
+func (c *Client) ListPublishedBots() ([]*SpaceObject, error) {
+	if c.Config.SpaceID == "" {
+		return nil, fmt.Errorf("未配置Coze工作空间Id，请设置COZE_SPACE_ID环境变量")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	paged, err := c.Api.Bots.List(ctx, &coze.ListBotsReq{
+		SpaceID:  c.Config.SpaceID,
+		PageNum:  1,
+		PageSize: SPACE_LIST_PAGE_SIZE,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询智能体列表失败: %v", err)
+	}
+
+	list := make([]*SpaceObject, 0)
+	for paged.Next() {
+		bot := paged.Current()
+		list = append(list, &SpaceObject{
+			ID:          bot.BotID,
+			Name:        bot.BotName,
+			Description: bot.Description,
+		})
+	}
+	if err := paged.Err(); err != nil {
+		return nil, fmt.Errorf("查询智能体列表失败: %v", err)
+	}
+	return list, nil
+}
+
+// ListPublishedWorkflows 遍历工作空间中所有已发布的工作流（不含对话流）
+func (c *Client) ListPublishedWorkflows() ([]*SpaceObject, error) {
+	if c.Config.SpaceID == "" {
+		return nil, fmt.Errorf("未配置Coze工作空间Id，请设置COZE_SPACE_ID环境变量")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	mode := coze.WorkflowModeWorkflow
+	status := coze.PublishStatusPublishedOnline
+	paged, err := c.Api.Workflows.List(ctx, &coze.ListWorkflowReq{
+		WorkspaceID:   &c.Config.SpaceID,
+		WorkflowMode:  &mode,
+		PublishStatus: &status,
+		PageNum:       1,
+		PageSize:      SPACE_LIST_PAGE_SIZE,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询工作流列表失败: %v", err)
+	}
+
+	list := make([]*SpaceObject, 0)
+	for paged.Next() {
+		workflow := paged.Current()
+		list = append(list, &SpaceObject{
+			ID:          workflow.WorkflowID,
+			Name:        workflow.WorkflowName,
+			Description: workflow.Description,
+		})
+	}
+	if err := paged.Err(); err != nil {
+		return nil, fmt.Errorf("查询工作流列表失败: %v", err)
+	}
+	return list, nil
+}
@@ -0,0 +1,299 @@
+package coze
+
+import (
+	"chatbot-app/backend/config"
+	"chatbot-app/backend/database"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coze-dev/coze-go"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// COZE_TOKEN_LOCK_KEY 刷新Token的分布式锁
+	COZE_TOKEN_LOCK_KEY = "coze:access_token:lock"
+	// TOKEN_LOCK_TTL 分布式锁的有效期，防止持有锁的实例崩溃后无法释放
+	TOKEN_LOCK_TTL = 15 * time.Second
+	// TOKEN_REFRESH_BEFORE 距离过期不足该时间时提前刷新
+	TOKEN_REFRESH_BEFORE = 3 * time.Minute
+	// TOKEN_REFRESH_CHECK_INTERVAL 后台检查Token有效期的间隔
+	TOKEN_REFRESH_CHECK_INTERVAL = time.Minute
+	// TOKEN_WAIT_TIMEOUT 其他实例正在刷新时等待新Token的最长时间
+	TOKEN_WAIT_TIMEOUT = 5 * time.Second
+)
+
+// ErrProviderDisabled Coze配置不完整，Coze模型不可用
+var ErrProviderDisabled = errors.New("Coze服务未启用")
+
+// releaseLockScript 只释放自己持有的锁
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// TokenManager Coze访问令牌管理器
+// Token缓存在Redis中供多个实例共享，刷新时加分布式锁避免同时请求新Token；
+// Redis不可用时退化为进程内缓存；进程内同一时间只有一个刷新，刷新期间不持有锁
+type TokenManager struct {
+	mu         sync.RWMutex
+	token      string
+	expiresAt  time.Time
+	refreshing chan struct{} // 正在刷新时不为空，刷新结束后关闭
+	refreshErr error         // 最近一次刷新的错误
+}
+
+var (
+	tokenManager     *TokenManager
+	tokenManagerOnce sync.Once
+)
+
+// GetTokenManager 获取全局Token管理器
+func GetTokenManager() *TokenManager {
+	tokenManagerOnce.Do(func() {
+		tokenManager = &TokenManager{}
+	})
+	return tokenManager
+}
+
+var (
+	cozeConfig     *config.CozeConfig
+	cozeConfigErr  error
+	cozeConfigOnce sync.Once
+)
+
+// loadConfig 读取并校验Coze配置，进程内只读取一次私钥文件，修改配置后需重启服务
+func loadConfig() (*config.CozeConfig, error) {
+	cozeConfigOnce.Do(func() {
+		cozeConfig = config.GetCozeConfig()
+		if err := cozeConfig.Validate(); err != nil {
+			cozeConfigErr = fmt.Errorf("%w: %v", ErrProviderDisabled, err)
+		}
+	})
+	return cozeConfig, cozeConfigErr
+}
+
+// CheckEnabled 检查Coze配置是否完整，不完整时返回包装了ErrProviderDisabled的错误
+func CheckEnabled() error {
+	_, err := loadConfig()
+	return err
+}
+
+// Start 后台定时检查Token有效期，即将过期时提前刷新，直到ctx结束
+func (m *TokenManager) Start(ctx context.Context) {
+	if err := CheckEnabled(); err != nil {
+		log.Printf("Coze Token后台刷新未启动: %v", err)
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(TOKEN_REFRESH_CHECK_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := m.Token(ctx); err != nil {
+					log.Printf("刷新Coze Token失败: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Token 获取有效的访问令牌，即将过期时自动刷新
+func (m *TokenManager) Token(ctx context.Context) (string, error) {
+	if err := CheckEnabled(); err != nil {
+		return "", err
+	}
+
+	// 进程内缓存未临近过期时直接使用
+	m.mu.RLock()
+	token, expiresAt := m.token, m.expiresAt
+	m.mu.RUnlock()
+	if token != "" && time.Until(expiresAt) > TOKEN_REFRESH_BEFORE {
+		return token, nil
+	}
+
+	m.mu.Lock()
+	if m.token != "" && time.Until(m.expiresAt) > TOKEN_REFRESH_BEFORE {
+		token := m.token
+		m.mu.Unlock()
+		return token, nil
+	}
+	done := m.refreshing
+	if done != nil {
+		// 其他请求正在刷新，旧Token尚未过期时直接使用，否则等待刷新结果
+		if m.token != "" && time.Now().Before(m.expiresAt) {
+			token := m.token
+			m.mu.Unlock()
+			return token, nil
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		return m.current()
+	}
+	done = make(chan struct{})
+	m.refreshing = done
+	m.mu.Unlock()
+
+	// 刷新不受单个请求取消的影响，等待中的其他请求也依赖这次刷新的结果
+	token, expiresAt, err := m.load(context.WithoutCancel(ctx))
+
+	m.mu.Lock()
+	if err == nil {
+		m.token, m.expiresAt = token, expiresAt
+	} else if m.token != "" && time.Now().Before(m.expiresAt) {
+		// 刷新失败但旧Token尚未过期时继续使用
+		log.Printf("刷新Coze Token失败，继续使用未过期的Token: %v", err)
+		err = nil
+	}
+	m.refreshErr = err
+	m.refreshing = nil
+	close(done)
+	m.mu.Unlock()
+
+	return m.current()
+}
+
+// current 返回刷新结束后的Token，没有未过期的Token时返回最近一次刷新的错误
+func (m *TokenManager) current() (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.token != "" && time.Now().Before(m.expiresAt) {
+		return m.token, nil
+	}
+	if m.refreshErr != nil {
+		return "", m.refreshErr
+	}
+	return "", errors.New("获取Coze Token失败")
+}
+
+// load 优先读取其他实例写入Redis的Token，没有可用的Token时刷新
+func (m *TokenManager) load(ctx context.Context) (string, time.Time, error) {
+	if token, expiresAt, ok := m.loadFromRedis(ctx); ok && time.Until(expiresAt) > TOKEN_REFRESH_BEFORE {
+		return token, expiresAt, nil
+	}
+	return m.refresh(ctx)
+}
+
+// refresh 在分布式锁保护下获取新Token
+// 未抢到锁时等待持锁实例写入的新Token，Redis不可用时直接获取
+func (m *TokenManager) refresh(ctx context.Context) (string, time.Time, error) {
+	if database.RedisClient == nil {
+		return fetchAccessToken(ctx)
+	}
+
+	lockValue := randomLockValue()
+	acquired, err := database.RedisClient.SetNX(ctx, COZE_TOKEN_LOCK_KEY, lockValue, TOKEN_LOCK_TTL).Result()
+	if err != nil {
+		log.Printf("Redis不可用，直接获取Coze Token: %v", err)
+		return fetchAccessToken(ctx)
+	}
+
+	if !acquired {
+		deadline := time.Now().Add(TOKEN_WAIT_TIMEOUT)
+		for time.Now().Before(deadline) {
+			time.Sleep(200 * time.Millisecond)
+			if token, expiresAt, ok := m.loadFromRedis(ctx); ok && time.Until(expiresAt) > TOKEN_REFRESH_BEFORE {
+				return token, expiresAt, nil
+			}
+		}
+		// 等待超时，可能持锁实例已异常，自行获取
+		return fetchAccessToken(ctx)
+	}
+	defer releaseLockScript.Run(context.Background(), database.RedisClient, []string{COZE_TOKEN_LOCK_KEY}, lockValue)
+
+	token, expiresAt, err := fetchAccessToken(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if err := database.RedisClient.Set(ctx, COZE_TOKEN_KEY, token, time.Until(expiresAt)).Err(); err != nil {
+		log.Printf("警告: 无法将token存储到Redis: %v", err)
+	}
+	return token, expiresAt, nil
+}
+
+// loadFromRedis 读取Redis中缓存的Token及其过期时间
+func (m *TokenManager) loadFromRedis(ctx context.Context) (string, time.Time, bool) {
+	if database.RedisClient == nil {
+		return "", time.Time{}, false
+	}
+
+	pipe := database.RedisClient.Pipeline()
+	getCmd := pipe.Get(ctx, COZE_TOKEN_KEY)
+	ttlCmd := pipe.TTL(ctx, COZE_TOKEN_KEY)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", time.Time{}, false
+	}
+
+	token := getCmd.Val()
+	ttl := ttlCmd.Val()
+	if token == "" || ttl <= 0 {
+		return "", time.Time{}, false
+	}
+	return token, time.Now().Add(ttl), true
+}
+
+// fetchAccessToken 通过JWT OAuth获取新的访问令牌
+func fetchAccessToken(ctx context.Context) (string, time.Time, error) {
+	cozeConfig, err := loadConfig()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	oauth, err := coze.NewJWTOAuthClient(coze.NewJWTOAuthClientParam{
+		PrivateKeyPEM: cozeConfig.PrivateKey,
+		ClientID:      cozeConfig.ClientID,
+		PublicKey:     cozeConfig.PublicKeyID,
+	}, coze.WithAuthBaseURL(cozeConfig.APIURL))
+	if err != nil {
+		// 提供更详细的错误信息
+		if strings.Contains(err.Error(), "private key") {
+			return "", time.Time{}, fmt.Errorf("私钥格式错误: %v\n建议检查:\n1. 私钥是否为PEM格式\n2. 私钥是否完整包含头尾标记\n3. 私钥内容是否正确", err)
+		}
+		return "", time.Time{}, fmt.Errorf("创建JWT OAuth客户端失败: %v", err)
+	}
+
+	resp, err := oauth.GetAccessToken(ctx, nil)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("获取AccessToken失败: %v", err)
+	}
+
+	// Coze返回的expires_in为过期时间戳，未返回时按默认有效期计算
+	expiresAt := time.Now().Add(time.Duration(TOKEN_EXPIRE_MINUTES) * time.Minute)
+	if resp.ExpiresIn > 1e9 {
+		expiresAt = time.Unix(resp.ExpiresIn, 0)
+	} else if resp.ExpiresIn > 0 {
+		expiresAt = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	log.Printf("已获取新的Coze Token，过期时间: %s", expiresAt.Format(time.DateTime))
+	return resp.AccessToken, expiresAt, nil
+}
+
+// randomLockValue 生成锁的持有者标识
+func randomLockValue() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
@@ -2,6 +2,7 @@ package coze
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -10,21 +11,17 @@ import (
 	"github.com/coze-dev/coze-go"
 )
 
-func (workflow *Client) RunWorkflow(message string) (*coze.RunWorkflowsResp, error) {
+// RunWorkflow 执行工作流，parameters为工作流开始节点的输入参数
+func (workflow *Client) RunWorkflow(parameters map[string]interface{}) (*coze.RunWorkflowsResp, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
 	defer cancel()
-	workflow_param := map[string]interface{}{
-		"ip":    "180.172.177.97",
-		"token": "user:normal:c9542333dd93486a98c1b8289d2de0c5",
-		"input": message,
-	}
 	workflowID := workflow.WorkflowID
 	if workflowID == "" {
 		workflowID = workflow.Config.WorkFlowID
 	}
 	workflowReq := &coze.RunWorkflowsReq{
 		WorkflowID: workflowID,
-		Parameters: workflow_param,
+		Parameters: parameters,
 		IsAsync:    false,
 	}
 
@@ -36,21 +33,126 @@ func (workflow *Client) RunWorkflow(message string) (*coze.RunWorkflowsResp, err
 	return resp, nil
 }
 
-func (workflow *Client) RunWorkflowStream(message string, onMessage func(eventType string, data interface{})) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
+// WORKFLOW_OUTPUT_KEY 工作流结束节点默认的输出变量名
+const WORKFLOW_OUTPUT_KEY = "output"
+
+// ParseWorkflowOutput 从工作流返回的数据中提取输出内容
+// 结束节点返回变量时data为JSON对象，优先取output变量，只有一个字符串变量时取该变量；
+// 结束节点直接返回文本或有多个变量时原样返回
+func ParseWorkflowOutput(data string) string {
+	var outputs map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &outputs); err != nil || len(outputs) == 0 {
+		return data
+	}
+
+	if output, ok := outputs[WORKFLOW_OUTPUT_KEY].(string); ok {
+		return output
+	}
+	if len(outputs) == 1 {
+		for _, value := range outputs {
+			if output, ok := value.(string); ok {
+				return output
+			}
+		}
+	}
+	return data
+}
+
+// 异步执行的工作流状态
+const (
+	WORKFLOW_RUN_STATUS_RUNNING = "running"
+	WORKFLOW_RUN_STATUS_SUCCESS = "success"
+	WORKFLOW_RUN_STATUS_FAIL    = "fail"
+)
+
+// WorkflowRunResult 异步执行的工作流结果
+type WorkflowRunResult struct {
+	Status       string // running、success、fail
+	Output       string // 工作流输出
+	ErrorCode    string
+	ErrorMessage string
+	DebugURL     string
+	TokenCount   int
+	InputCount   int // 输入消耗的Token数
+	OutputCount  int // 输出消耗的Token数
+}
+
+// RunWorkflowAsync 异步执行工作流，返回执行Id，结果通过GetWorkflowRunResult查询
+func (workflow *Client) RunWorkflowAsync(parameters map[string]interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	workflowID := workflow.WorkflowID
+	if workflowID == "" {
+		workflowID = workflow.Config.WorkFlowID
+	}
+	workflowReq := &coze.RunWorkflowsReq{
+		WorkflowID: workflowID,
+		Parameters: parameters,
+		IsAsync:    true,
+	}
+
+	resp, err := workflow.Api.Workflows.Runs.Create(ctx, workflowReq)
+	if err != nil {
+		return "", fmt.Errorf("异步执行工作流失败: %v", err)
+	}
+	if resp.ExecuteID == "" {
+		return "", fmt.Errorf("异步执行工作流失败: 未返回执行Id")
+	}
+
+	return resp.ExecuteID, nil
+}
+
+// GetWorkflowRunResult 查询异步执行的工作流结果
+func (workflow *Client) GetWorkflowRunResult(workflowID string, executeID string) (*WorkflowRunResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	workflow_param := map[string]interface{}{
-		"ip":    "180.172.177.97",
-		"token": "user:normal:c9542333dd93486a98c1b8289d2de0c5",
-		"input": message,
+
+	resp, err := workflow.Api.Workflows.Runs.Histories.Retrieve(ctx, &coze.RetrieveWorkflowsRunsHistoriesReq{
+		WorkflowID: workflowID,
+		ExecuteID:  executeID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询工作流执行结果失败: %v", err)
+	}
+	if len(resp.Histories) == 0 {
+		return nil, fmt.Errorf("查询工作流执行结果失败: 未找到执行记录")
+	}
+
+	history := resp.Histories[0]
+	result := &WorkflowRunResult{
+		Output:       history.Output,
+		ErrorCode:    history.ErrorCode,
+		ErrorMessage: history.ErrorMessage,
+		DebugURL:     history.DebugURL,
+	}
+	switch history.ExecuteStatus {
+	case coze.WorkflowExecuteStatusSuccess:
+		result.Status = WORKFLOW_RUN_STATUS_SUCCESS
+	case coze.WorkflowExecuteStatusFail:
+		result.Status = WORKFLOW_RUN_STATUS_FAIL
+	default:
+		result.Status = WORKFLOW_RUN_STATUS_RUNNING
 	}
+	if history.Usage != nil {
+		result.TokenCount = history.Usage.TokenCount
+		result.InputCount = history.Usage.InputCount
+		result.OutputCount = history.Usage.OutputCount
+	}
+	return result, nil
+}
+
+// RunWorkflowStream 流式执行工作流，parameters为工作流开始节点的输入参数
+// ctx结束时关闭流并以canceled状态结束
+func (workflow *Client) RunWorkflowStream(ctx context.Context, parameters map[string]interface{}, onMessage func(eventType string, data interface{})) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*2)
+	defer cancel()
 	workflowID := workflow.WorkflowID
 	if workflowID == "" {
 		workflowID = workflow.Config.WorkFlowID
 	}
 	workflowReq := &coze.RunWorkflowsReq{
 		WorkflowID: workflowID,
-		Parameters: workflow_param,
+		Parameters: parameters,
 		IsAsync:    false,
 	}
 
@@ -59,14 +161,51 @@ func (workflow *Client) RunWorkflowStream(message string, onMessage func(eventTy
 		return fmt.Errorf("发送消息失败: %v", err)
 	}
 
-	handleWorkflowStream(resp, onMessage)
+	handleWorkflowStream(ctx, resp, onMessage)
 
 	return nil
 }
 
-func handleWorkflowStream(resp coze.Stream[coze.WorkflowEvent], onMessage func(eventType string, data interface{})) {
+// WorkflowInterrupt 工作流中断事件，工作流等待用户输入时产生
+type WorkflowInterrupt struct {
+	WorkflowID    string
+	EventID       string // 恢复执行时回传
+	InterruptType int    // 恢复执行时回传
+	NodeTitle     string // 中断节点名称
+}
+
+// ResumeWorkflowStream 以用户的回答恢复中断的工作流，继续流式输出
+func (workflow *Client) ResumeWorkflowStream(ctx context.Context, interrupt *WorkflowInterrupt, resumeData string, onMessage func(eventType string, data interface{})) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*2)
+	defer cancel()
+
+	resp, err := workflow.Api.Workflows.Runs.Resume(ctx, &coze.ResumeRunWorkflowsReq{
+		WorkflowID:    interrupt.WorkflowID,
+		EventID:       interrupt.EventID,
+		ResumeData:    resumeData,
+		InterruptType: interrupt.InterruptType,
+	})
+	if err != nil {
+		return fmt.Errorf("恢复工作流失败: %v", err)
+	}
+
+	handleWorkflowStream(ctx, resp, onMessage)
+
+	return nil
+}
+
+func handleWorkflowStream(ctx context.Context, resp coze.Stream[coze.WorkflowEvent], onMessage func(eventType string, data interface{})) {
 	defer resp.Close()
 	for {
+		if ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// 请求已取消，关闭流
+			onMessage("workflow_end", map[string]string{
+				"status": "canceled",
+				"log_id": resp.Response().LogID(),
+			})
+			return
+		}
+
 		event, err := resp.Recv()
 		if errors.Is(err, io.EOF) {
 			// 流式结束
@@ -77,6 +216,9 @@ func handleWorkflowStream(resp coze.Stream[coze.WorkflowEvent], onMessage func(e
 			break
 		}
 		if err != nil {
+			if ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				continue
+			}
 			fmt.Printf("工作流接收事件失败: %v\n", err)
 			return
 		}
@@ -89,6 +231,14 @@ func handleWorkflowStream(resp coze.Stream[coze.WorkflowEvent], onMessage func(e
 				"log_id":  resp.Response().LogID(),
 				"content": event.Message.Content,
 			})
+			// 节点输出结束时携带Token用量
+			if event.Message.Usage != nil {
+				onMessage("usage", &ChatUsage{
+					InputCount:  event.Message.Usage.InputCount,
+					OutputCount: event.Message.Usage.OutputCount,
+					TokenCount:  event.Message.Usage.TokenCount,
+				})
+			}
 			fmt.Printf("步骤开始: %s\n", event.Message.Content)
 		case coze.WorkflowEventTypeError:
 			onMessage("workflow_error", map[string]string{
@@ -105,6 +255,15 @@ func handleWorkflowStream(resp coze.Stream[coze.WorkflowEvent], onMessage func(e
 			})
 			fmt.Println("流式响应结束")
 			return
+		case coze.WorkflowEventTypeInterrupt:
+			// 工作流等待用户输入，本次流式输出随后结束
+			if event.Interrupt != nil && event.Interrupt.InterruptData != nil {
+				onMessage("workflow_interrupt", &WorkflowInterrupt{
+					EventID:       event.Interrupt.InterruptData.EventID,
+					InterruptType: event.Interrupt.InterruptData.Type,
+					NodeTitle:     event.Interrupt.NodeTitle,
+				})
+			}
 		default:
 			fmt.Printf("未知事件: %v\n", event)
 		}
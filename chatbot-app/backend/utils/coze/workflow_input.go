@@ -0,0 +1,121 @@
+package coze
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WORKFLOW_INPUT_CACHE_TTL 工作流输入定义的缓存时间
+const WORKFLOW_INPUT_CACHE_TTL = 10 * time.Minute
+
+// WorkflowInput 工作流开始节点声明的输入参数
+type WorkflowInput struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Required     bool   `json:"required"`
+	Description  string `json:"description"`
+	DefaultValue string `json:"default_value"`
+}
+
+type workflowInputCacheItem struct {
+	inputs    map[string]*WorkflowInput
+	expiresAt time.Time
+}
+
+var (
+	workflowInputCache   = make(map[string]*workflowInputCacheItem)
+	workflowInputCacheMu sync.Mutex
+)
+
+// workflowInfoResp 工作流信息接口响应
+type workflowInfoResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Input struct {
+			Parameters map[string]*WorkflowInput `json:"parameters"`
+		} `json:"input"`
+	} `json:"data"`
+}
+
+// GetWorkflowInputs 获取工作流开始节点声明的输入参数，结果在进程内缓存
+// coze-go暂未提供该接口，这里直接调用OpenAPI
+func (workflow *Client) GetWorkflowInputs(workflowID string) (map[string]*WorkflowInput, error) {
+	if workflowID == "" {
+		workflowID = workflow.WorkflowID
+	}
+	if workflowID == "" {
+		workflowID = workflow.Config.WorkFlowID
+	}
+
+	workflowInputCacheMu.Lock()
+	item, ok := workflowInputCache[workflowID]
+	workflowInputCacheMu.Unlock()
+	if ok && time.Now().Before(item.expiresAt) {
+		return item.inputs, nil
+	}
+
+	token, err := GetToken()
+	if err != nil {
+		return nil, fmt.Errorf("获取Coze Token失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reqURL := fmt.Sprintf("%s/v1/workflows/%s?include_input_output=true",
+		strings.TrimRight(workflow.Config.APIURL, "/"), url.PathEscape(workflowID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("获取工作流信息失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取工作流信息失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取工作流信息失败，状态码: %d，响应: %s", resp.StatusCode, string(body))
+	}
+
+	var infoResp workflowInfoResp
+	if err := json.Unmarshal(body, &infoResp); err != nil {
+		return nil, fmt.Errorf("解析工作流信息失败: %v", err)
+	}
+	if infoResp.Code != 0 {
+		return nil, fmt.Errorf("获取工作流信息失败: code %d, msg %s", infoResp.Code, infoResp.Msg)
+	}
+
+	inputs := infoResp.Data.Input.Parameters
+	if inputs == nil {
+		inputs = make(map[string]*WorkflowInput)
+	}
+	for name, input := range inputs {
+		if input != nil {
+			input.Name = name
+		}
+	}
+
+	workflowInputCacheMu.Lock()
+	workflowInputCache[workflowID] = &workflowInputCacheItem{
+		inputs:    inputs,
+		expiresAt: time.Now().Add(WORKFLOW_INPUT_CACHE_TTL),
+	}
+	workflowInputCacheMu.Unlock()
+
+	return inputs, nil
+}